@@ -19,10 +19,105 @@ type System struct {
 
 	// AccessTokens format: "hash1:bans,reports,metrics;hash2:metrics;hash3"
 	// Tokens separated by semicolon (;), permissions by comma (,)
-	// Permissions: bans, reports, metrics, all
-	// If no permissions specified - all permissions granted.
+	// Permissions: bans, reports, metrics, aliases, pins, uploads, all
+	// If no permissions specified - all permissions except pins and uploads granted.
 	AccessTokens string `env:"SYSTEM_ACCESS_TOKENS" envDefault:""`
 	LogLevel     uint8  `env:"SYSTEM_LOG_LEVEL" envDefault:"1"` // 0 - debug, 1 - info, 2 - warn, 3 - error
+
+	// TrustedProxies format: "10.0.0.0/8,192.168.1.10", the client IP is taken from
+	// ClientIPHeader (X-Forwarded-For, X-Real-IP or Forwarded) only for requests from them
+	TrustedProxies string `env:"SYSTEM_TRUSTED_PROXIES" envDefault:""`
+	ClientIPHeader string `env:"SYSTEM_CLIENT_IP_HEADER" envDefault:"X-Forwarded-For"`
+}
+
+type Gateway struct {
+	// BagsDomain enables per-bag origins: <bagid>.<BagsDomain> serves the bag root.
+	// Bag ID is accepted in hex or in 52 characters base32 form, which fits DNS label limits.
+	// Requires a wildcard DNS record and certificate. Empty value disables it.
+	BagsDomain string `env:"GATEWAY_BAGS_DOMAIN" envDefault:""`
+	// Websites are bags always served as static websites: index.html for directories and 404.html for unknown paths.
+	// Format: "bagid1:spa/index.html;bagid2", the optional path is the SPA entry served for unknown paths.
+	Websites string `env:"GATEWAY_WEBSITES" envDefault:""`
+	// PublicURL is the scheme and host clients reach the gateway at, e.g. "https://mytonstorage.org".
+	// Links returned by the API are built from it, without it they are relative.
+	PublicURL string `env:"GATEWAY_PUBLIC_URL" envDefault:""`
+}
+
+type Bandwidth struct {
+	// SizeTiers format: "maxSize1:bytesPerSecond1;maxSize2:bytesPerSecond2", sizes in bytes.
+	// Files up to maxSize are served at most at bytesPerSecond per connection, 0 means unlimited.
+	// Files larger than the largest tier are not served.
+	SizeTiers string `env:"BANDWIDTH_SIZE_TIERS" envDefault:"52428800:0;1073741824:4194304;10737418240:1048576"`
+	// GlobalBytesPerSecond limits all file downloads together, 0 means unlimited
+	GlobalBytesPerSecond int64 `env:"BANDWIDTH_GLOBAL_BYTES_PER_SECOND" envDefault:"0"`
+}
+
+type RateLimits struct {
+	WindowSeconds int `env:"RATE_LIMIT_WINDOW_SECONDS" envDefault:"60"`
+	// Requests per window for one client IP, 0 disables the limit.
+	// Gateway applies to bag content, Reports to report submissions, Default to everything else.
+	Default int `env:"RATE_LIMIT_DEFAULT" envDefault:"100"`
+	Gateway int `env:"RATE_LIMIT_GATEWAY" envDefault:"300"`
+	Reports int `env:"RATE_LIMIT_REPORTS" envDefault:"10"`
+	// SharedStorage keeps counters in Postgres, so limits apply to all gateway instances together.
+	// Every limited request then waits for one increment query, at most 200ms.
+	SharedStorage bool `env:"RATE_LIMIT_SHARED_STORAGE" envDefault:"false"`
+}
+
+type Quotas struct {
+	Enabled bool `env:"QUOTAS_ENABLED" envDefault:"false"`
+	// Caps on bytes served, 0 means unlimited
+	IPHourlyBytes  uint64 `env:"QUOTAS_IP_HOURLY_BYTES" envDefault:"0"`
+	IPDailyBytes   uint64 `env:"QUOTAS_IP_DAILY_BYTES" envDefault:"0"`
+	BagHourlyBytes uint64 `env:"QUOTAS_BAG_HOURLY_BYTES" envDefault:"0"`
+	BagDailyBytes  uint64 `env:"QUOTAS_BAG_DAILY_BYTES" envDefault:"0"`
+}
+
+type Promotion struct {
+	// Enabled downloads often requested remote bags to the local daemon, they are removed with their files once cold
+	Enabled       bool `env:"PROMOTION_ENABLED" envDefault:"false"`
+	WindowSeconds int  `env:"PROMOTION_WINDOW_SECONDS" envDefault:"3600"`
+	// Bags requested at least HotThreshold times within the window are promoted,
+	// promoted bags requested fewer than ColdThreshold times are removed
+	HotThreshold  uint64 `env:"PROMOTION_HOT_THRESHOLD" envDefault:"100"`
+	ColdThreshold uint64 `env:"PROMOTION_COLD_THRESHOLD" envDefault:"10"`
+	// StorageBudgetBytes caps the total size of promoted bags, 0 means unlimited
+	StorageBudgetBytes   uint64 `env:"PROMOTION_STORAGE_BUDGET_BYTES" envDefault:"107374182400"`
+	CheckIntervalSeconds int    `env:"PROMOTION_CHECK_INTERVAL_SECONDS" envDefault:"60"`
+}
+
+type Uploads struct {
+	// Enabled accepts uploads of new bags from tokens with the uploads permission
+	Enabled bool `env:"UPLOADS_ENABLED" envDefault:"false"`
+	// StagingDir keeps uploaded files, DaemonDir is the same directory as mounted into the TON Storage daemon.
+	// Files of created bags stay in <StagingDir>/bags, the daemon seeds them from there.
+	StagingDir string `env:"UPLOADS_STAGING_DIR" envDefault:"/var/lib/mytonstorage-gateway/uploads"`
+	DaemonDir  string `env:"UPLOADS_DAEMON_DIR" envDefault:""`
+	// MaxRequestBytes limits one request, larger files are uploaded in chunks
+	MaxRequestBytes int    `env:"UPLOADS_MAX_REQUEST_BYTES" envDefault:"67108864"`
+	MaxBagBytes     uint64 `env:"UPLOADS_MAX_BAG_BYTES" envDefault:"10737418240"`
+	// Caps on the total size of bags created with a token, 0 means unlimited.
+	// TokenQuotas format: "hash1:bytes1;hash2:bytes2", other tokens get DefaultQuotaBytes.
+	DefaultQuotaBytes uint64 `env:"UPLOADS_DEFAULT_QUOTA_BYTES" envDefault:"10737418240"`
+	TokenQuotas       string `env:"UPLOADS_TOKEN_QUOTAS" envDefault:""`
+	// Unfinished sessions are removed after SessionTTLSeconds without new data
+	SessionTTLSeconds int `env:"UPLOADS_SESSION_TTL_SECONDS" envDefault:"86400"`
+}
+
+type Thumbnails struct {
+	// CacheDir keeps generated thumbnails, it can be cleaned up at any time
+	CacheDir string `env:"THUMBNAILS_CACHE_DIR" envDefault:"/tmp/mytonstorage-gateway/thumbnails"`
+	// MaxConcurrency limits images decoded at once, 0 means one per CPU
+	MaxConcurrency int `env:"THUMBNAILS_MAX_CONCURRENCY" envDefault:"0"`
+}
+
+type TONDNS struct {
+	Enabled         bool `env:"TON_DNS_ENABLED" envDefault:"false"`
+	CacheTTLSeconds int  `env:"TON_DNS_CACHE_TTL_SECONDS" envDefault:"300"`
+	MaxCacheEntries int  `env:"TON_DNS_CACHE_MAX_ENTRIES" envDefault:"10000"`
+	// StaticRecords format: "foundation.ton:bagid1;site.ton:bagid2".
+	// If set, domains are resolved from this list only, without connecting to liteservers.
+	StaticRecords string `env:"TON_DNS_STATIC_RECORDS" envDefault:""`
 }
 
 type TONStorage struct {
@@ -52,6 +147,14 @@ type Postgress struct {
 
 type Config struct {
 	System                System
+	Gateway               Gateway
+	TONDNS                TONDNS
+	Bandwidth             Bandwidth
+	Quotas                Quotas
+	Promotion             Promotion
+	Uploads               Uploads
+	RateLimits            RateLimits
+	Thumbnails            Thumbnails
 	TONStorage            TONStorage
 	RemoteTONStorageCache RemoteTONStorageCache
 	Metrics               Metrics
@@ -63,6 +166,30 @@ func loadConfig() *Config {
 	if err := env.Parse(&cfg.System); err != nil {
 		log.Fatalf("Failed to parse system config: %v", err)
 	}
+	if err := env.Parse(&cfg.Gateway); err != nil {
+		log.Fatalf("Failed to parse gateway config: %v", err)
+	}
+	if err := env.Parse(&cfg.TONDNS); err != nil {
+		log.Fatalf("Failed to parse TON DNS config: %v", err)
+	}
+	if err := env.Parse(&cfg.Bandwidth); err != nil {
+		log.Fatalf("Failed to parse bandwidth config: %v", err)
+	}
+	if err := env.Parse(&cfg.Quotas); err != nil {
+		log.Fatalf("Failed to parse quotas config: %v", err)
+	}
+	if err := env.Parse(&cfg.RateLimits); err != nil {
+		log.Fatalf("Failed to parse rate limits config: %v", err)
+	}
+	if err := env.Parse(&cfg.Promotion); err != nil {
+		log.Fatalf("Failed to parse promotion config: %v", err)
+	}
+	if err := env.Parse(&cfg.Uploads); err != nil {
+		log.Fatalf("Failed to parse uploads config: %v", err)
+	}
+	if err := env.Parse(&cfg.Thumbnails); err != nil {
+		log.Fatalf("Failed to parse thumbnails config: %v", err)
+	}
 	if err := env.Parse(&cfg.TONStorage); err != nil {
 		log.Fatalf("Failed to parse TONStorage config: %v", err)
 	}
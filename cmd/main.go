@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -14,11 +15,19 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	remotetonstorage "mytonstorage-gateway/pkg/clients/remote-ton-storage"
+	tondns "mytonstorage-gateway/pkg/clients/ton-dns"
 	tonstorage "mytonstorage-gateway/pkg/clients/ton-storage"
 	"mytonstorage-gateway/pkg/httpServer"
 	filesRepository "mytonstorage-gateway/pkg/repositories/files"
+	"mytonstorage-gateway/pkg/repositories/ratelimit"
+	aliasesService "mytonstorage-gateway/pkg/services/aliases"
 	filesService "mytonstorage-gateway/pkg/services/files"
+	pinsService "mytonstorage-gateway/pkg/services/pins"
+	promotionService "mytonstorage-gateway/pkg/services/promotion"
+	quotasService "mytonstorage-gateway/pkg/services/quotas"
 	reportsService "mytonstorage-gateway/pkg/services/reports"
+	thumbnailsService "mytonstorage-gateway/pkg/services/thumbnails"
+	uploadsService "mytonstorage-gateway/pkg/services/uploads"
 	htmlTemplates "mytonstorage-gateway/pkg/templates"
 )
 
@@ -113,14 +122,91 @@ func run() (err error) {
 		}
 	}()
 
+	var dnsResolver tondns.Resolver
+	if config.TONDNS.Enabled {
+		ttl := time.Duration(config.TONDNS.CacheTTLSeconds) * time.Second
+		if config.TONDNS.StaticRecords != "" {
+			records := make(map[string]string)
+			for _, r := range strings.Split(config.TONDNS.StaticRecords, ";") {
+				if domain, bagID, ok := strings.Cut(r, ":"); ok {
+					records[strings.TrimSpace(domain)] = strings.TrimSpace(bagID)
+				}
+			}
+
+			dnsResolver = tondns.NewStaticResolver(records, ttl)
+		} else {
+			var lr *tondns.LiteclientResolver
+			lr, err = tondns.NewLiteclientResolver(context.Background(), "", ttl)
+			if err != nil {
+				logger.Error("failed to create TON DNS resolver", slog.String("error", err.Error()))
+				return
+			}
+			defer lr.Close()
+
+			dnsResolver = lr
+		}
+
+		dnsResolver = tondns.NewCache(dnsResolver, config.TONDNS.MaxCacheEntries)
+	}
+
 	// Services
+	// Pins and promotion both add and remove bags on the daemon, the lock keeps a pinned bag from being demoted
+	bagsLock := &sync.Mutex{}
+
+	var promotionSvc promotionService.Promotion
+	if config.Promotion.Enabled {
+		promotionSvc = promotionService.NewService(filesRepo, storage, rstorage, promotionService.Settings{
+			Window:        time.Duration(config.Promotion.WindowSeconds) * time.Second,
+			HotThreshold:  config.Promotion.HotThreshold,
+			ColdThreshold: config.Promotion.ColdThreshold,
+			BudgetBytes:   config.Promotion.StorageBudgetBytes,
+		}, promotionService.NewMetrics(config.Metrics.Namespace, config.Metrics.WorkersSubsystem), bagsLock, logger)
+	}
+
 	filesSvc := filesService.NewService(filesRepo, storage, rstorage, logger)
-	filesSvc = filesService.NewCacheMiddleware(filesSvc)
+	filesSvc = filesService.NewCacheMiddleware(filesSvc, promotionSvc)
 
 	reportsSvc := reportsService.NewService(filesRepo, logger)
 	// TODO:
 	// reportsSvc = reportsService.NewCacheMiddleware(reportsSvc)
 
+	aliasesSvc := aliasesService.NewService(filesRepo, logger)
+
+	pinsSvc := pinsService.NewService(filesRepo, storage, bagsLock, logger)
+
+	var quotasSvc quotasService.Quotas
+	if config.Quotas.Enabled {
+		quotasSvc = quotasService.NewService(filesRepo, quotasService.Limits{
+			IPHourly:  config.Quotas.IPHourlyBytes,
+			IPDaily:   config.Quotas.IPDailyBytes,
+			BagHourly: config.Quotas.BagHourlyBytes,
+			BagDaily:  config.Quotas.BagDailyBytes,
+		}, logger)
+	}
+
+	var uploadsSvc uploadsService.Uploads
+	if config.Uploads.Enabled {
+		uploadsSvc = uploadsService.NewService(filesRepo, storage, uploadsService.Settings{
+			StagingDir:   config.Uploads.StagingDir,
+			DaemonDir:    config.Uploads.DaemonDir,
+			MaxBagSize:   config.Uploads.MaxBagBytes,
+			DefaultQuota: config.Uploads.DefaultQuotaBytes,
+			TokenQuotas:  strings.Split(config.Uploads.TokenQuotas, ";"),
+			SessionTTL:   time.Duration(config.Uploads.SessionTTLSeconds) * time.Second,
+		}, logger)
+
+		if err = uploadsSvc.Load(context.Background()); err != nil {
+			logger.Error("failed to load upload sessions", slog.String("error", err.Error()))
+			return
+		}
+	}
+
+	thumbnailsSvc, err := thumbnailsService.NewService(config.Thumbnails.CacheDir, config.Thumbnails.MaxConcurrency, logger)
+	if err != nil {
+		logger.Error("failed to initialize thumbnails", slog.String("error", err.Error()))
+		return
+	}
+
 	templatesSvc, err := htmlTemplates.New("../templates")
 	if err != nil {
 		logger.Error("failed to initialize templates", slog.String("error", err.Error()))
@@ -129,13 +215,50 @@ func run() (err error) {
 
 	// HTTP Server
 	accessTokens := strings.Split(config.System.AccessTokens, ";")
-	app := fiber.New()
+	trustedProxies := strings.Split(config.System.TrustedProxies, ",")
+	websites := strings.Split(config.Gateway.Websites, ";")
+	sizeTiers := strings.Split(config.Bandwidth.SizeTiers, ";")
+	rateCounter := ratelimit.NewMemory()
+	if config.RateLimits.SharedStorage {
+		rateCounter = ratelimit.NewFallback(ratelimit.NewPostgres(connPool), rateCounter, logger)
+	}
+	defer rateCounter.Close()
+
+	rateLimits := httpServer.RateLimits{
+		Window:  time.Duration(config.RateLimits.WindowSeconds) * time.Second,
+		Default: config.RateLimits.Default,
+		Gateway: config.RateLimits.Gateway,
+		Reports: config.RateLimits.Reports,
+	}
+
+	// Upload routes read larger bodies than the default limit after the token is checked,
+	// so bodies are streamed then. Multipart forms are parsed by the upload handlers only.
+	app := fiber.New(fiber.Config{
+		StreamRequestBody:            config.Uploads.Enabled,
+		DisablePreParseMultipartForm: true,
+	})
 	server := httpServer.New(
 		app,
 		filesSvc,
 		reportsSvc,
 		templatesSvc,
+		dnsResolver,
+		quotasSvc,
+		thumbnailsSvc,
+		aliasesSvc,
+		pinsSvc,
+		uploadsSvc,
+		config.Uploads.MaxRequestBytes,
 		accessTokens,
+		trustedProxies,
+		config.System.ClientIPHeader,
+		config.Gateway.BagsDomain,
+		config.Gateway.PublicURL,
+		websites,
+		sizeTiers,
+		config.Bandwidth.GlobalBytesPerSecond,
+		rateLimits,
+		rateCounter,
 		config.Metrics.Namespace,
 		config.Metrics.ServerSubsystem,
 		logger,
@@ -152,6 +275,24 @@ func run() (err error) {
 		}
 	}()
 
+	quotasCtx, stopQuotas := context.WithCancel(context.Background())
+	defer stopQuotas()
+	if quotasSvc != nil {
+		go quotasSvc.Run(quotasCtx, time.Hour)
+	}
+
+	promotionCtx, stopPromotion := context.WithCancel(context.Background())
+	defer stopPromotion()
+	if promotionSvc != nil {
+		go promotionSvc.Run(promotionCtx, time.Duration(config.Promotion.CheckIntervalSeconds)*time.Second)
+	}
+
+	uploadsCtx, stopUploads := context.WithCancel(context.Background())
+	defer stopUploads()
+	if uploadsSvc != nil {
+		go uploadsSvc.Run(uploadsCtx, time.Minute)
+	}
+
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
@@ -28,8 +28,9 @@ var ErrNotFound = errors.New("not found")
 var ErrTimeout = errors.New("timeout")
 
 type Client interface {
-	StreamFile(ctx context.Context, bagID, path string) (s FileStream, err error)
+	StreamFile(ctx context.Context, bagID, path string, rng *ByteRange) (s FileStream, err error)
 	ListFiles(ctx context.Context, bagID string) (BagInfo, error)
+	GetPieces(ctx context.Context, bagID string, pieces []uint32) ([]Piece, error)
 	Close()
 }
 
@@ -38,6 +39,12 @@ type BagInfo struct {
 	TotalSize   uint64
 	PeersCount  int
 	Files       []tonapi.File
+
+	// Torrent header info, BagSize includes the header of HeaderSize bytes
+	PieceSize  uint32
+	BagSize    uint64
+	HeaderSize uint64
+	MerkleHash string
 }
 
 type FileStream struct {
@@ -46,6 +53,19 @@ type FileStream struct {
 	PeersCount int
 }
 
+// Piece is the piece data with its merkle proof against the bag merkle hash as a serialized cell.
+type Piece struct {
+	Index uint32
+	Data  []byte
+	Proof []byte
+}
+
+// ByteRange is an inclusive range of bytes within a file.
+type ByteRange struct {
+	Start uint64
+	End   uint64
+}
+
 type client struct {
 	netMgr     adnl.NetManager
 	dhtGateway *adnl.Gateway
@@ -66,7 +86,9 @@ type client struct {
 	store *VirtualStorage
 }
 
-func (c *client) StreamFile(ctx context.Context, bagID, path string) (FileStream, error) {
+// StreamFile streams the file content. If rng is not nil, only the pieces covering
+// the requested range are fetched and only the bytes of the range are returned.
+func (c *client) StreamFile(ctx context.Context, bagID, path string, rng *ByteRange) (FileStream, error) {
 	start := time.Now()
 	torrent, downloader, err := c.getTorrent(ctx, bagID)
 	if err != nil {
@@ -91,8 +113,16 @@ func (c *client) StreamFile(ctx context.Context, bagID, path string) (FileStream
 		return FileStream{}, err
 	}
 
-	pieces := make([]uint32, 0, (fileInfo.ToPiece-fileInfo.FromPiece)+1)
-	for p := fileInfo.FromPiece; p <= fileInfo.ToPiece; p++ {
+	span, err := piecesSpan(fileInfo, torrent.Info.PieceSize, rng)
+	if err != nil {
+		if c.metrics != nil {
+			c.metrics.streamFileReqs.WithLabelValues("error").Inc()
+		}
+		return FileStream{}, err
+	}
+
+	pieces := make([]uint32, 0, (span.toPiece-span.fromPiece)+1)
+	for p := span.fromPiece; p <= span.toPiece; p++ {
 		pieces = append(pieces, p)
 	}
 
@@ -117,7 +147,7 @@ func (c *client) StreamFile(ctx context.Context, bagID, path string) (FileStream
 		defer fetch.Stop()
 		defer pw.Close()
 
-		for p := fileInfo.FromPiece; p <= fileInfo.ToPiece; p++ {
+		for p := span.fromPiece; p <= span.toPiece; p++ {
 			select {
 			case <-ctx.Done():
 				_ = pw.CloseWithError(ctx.Err())
@@ -131,11 +161,11 @@ func (c *client) StreamFile(ctx context.Context, bagID, path string) (FileStream
 				return
 			}
 			part := data
-			if p == fileInfo.ToPiece {
-				part = part[:fileInfo.ToPieceOffset]
+			if p == span.toPiece {
+				part = part[:span.toPieceOffset]
 			}
-			if p == fileInfo.FromPiece {
-				part = part[fileInfo.FromPieceOffset:]
+			if p == span.fromPiece {
+				part = part[span.fromPieceOffset:]
 			}
 			if len(part) == 0 {
 				continue
@@ -207,9 +237,51 @@ func (c *client) ListFiles(ctx context.Context, bagID string) (info BagInfo, err
 		Description: torrent.Info.Description.Value,
 		PeersCount:  len(torrent.GetPeers()),
 		Files:       files,
+		PieceSize:   torrent.Info.PieceSize,
+		BagSize:     torrent.Info.FileSize,
+		HeaderSize:  torrent.Info.HeaderSize,
+		MerkleHash:  hex.EncodeToString(torrent.Info.RootHash),
 	}, nil
 }
 
+// GetPieces downloads the pieces with their proofs, pieces are returned in the requested order.
+func (c *client) GetPieces(ctx context.Context, bagID string, pieces []uint32) ([]Piece, error) {
+	torrent, downloader, err := c.getTorrent(ctx, bagID)
+	if err != nil {
+		return nil, err
+	}
+
+	num := torrent.PiecesNum()
+	for _, p := range pieces {
+		if p >= num {
+			return nil, fmt.Errorf("piece %d is out of range (%d): %w", p, num, ErrInvalidRange)
+		}
+	}
+
+	fetch := tonstorage.NewPreFetcher(ctx, torrent, downloader, func(event tonstorage.Event) {}, 64, pieces)
+	defer fetch.Stop()
+
+	result := make([]Piece, 0, len(pieces))
+	for _, p := range pieces {
+		data, proof, err := fetch.Get(ctx, p)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, ErrTimeout
+			}
+
+			return nil, fmt.Errorf("failed to download piece %d: %w", p, err)
+		}
+
+		result = append(result, Piece{
+			Index: p,
+			Data:  data,
+			Proof: proof,
+		})
+	}
+
+	return result, nil
+}
+
 func (c *client) Close() {
 	if c == nil {
 		return
@@ -0,0 +1,49 @@
+package remotetonstorage
+
+import (
+	"errors"
+
+	tonstorage "github.com/xssnick/tonutils-storage/storage"
+)
+
+var ErrInvalidRange = errors.New("invalid range")
+
+// piecesRange describes the pieces to fetch and the offsets to cut
+// in the first and the last of them. toPieceOffset is exclusive.
+type piecesRange struct {
+	fromPiece       uint32
+	toPiece         uint32
+	fromPieceOffset uint32
+	toPieceOffset   uint32
+}
+
+// piecesSpan narrows the file pieces down to the ones covering rng.
+// A nil rng returns the pieces of the whole file.
+func piecesSpan(fileInfo *tonstorage.FileInfo, pieceSize uint32, rng *ByteRange) (piecesRange, error) {
+	span := piecesRange{
+		fromPiece:       fileInfo.FromPiece,
+		toPiece:         fileInfo.ToPiece,
+		fromPieceOffset: fileInfo.FromPieceOffset,
+		toPieceOffset:   fileInfo.ToPieceOffset,
+	}
+
+	if rng == nil {
+		return span, nil
+	}
+
+	if pieceSize == 0 || rng.Start > rng.End || rng.End >= fileInfo.Size {
+		return piecesRange{}, ErrInvalidRange
+	}
+
+	ps := uint64(pieceSize)
+	fileStart := uint64(fileInfo.FromPiece)*ps + uint64(fileInfo.FromPieceOffset)
+	from := fileStart + rng.Start
+	last := fileStart + rng.End
+
+	return piecesRange{
+		fromPiece:       uint32(from / ps),
+		toPiece:         uint32(last / ps),
+		fromPieceOffset: uint32(from % ps),
+		toPieceOffset:   uint32(last%ps) + 1,
+	}, nil
+}
@@ -0,0 +1,101 @@
+package tondns
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// notFoundTTL limits caching of missing records, a domain may get its record any moment
+const notFoundTTL = time.Minute
+
+type cacheEntry struct {
+	record    Record
+	err       error
+	expiresAt time.Time
+}
+
+type cache struct {
+	resolver   Resolver
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// Resolve returns the cached record with its remaining TTL, resolving it on miss.
+// Only found and not found results are cached, other errors are temporary.
+func (c *cache) Resolve(ctx context.Context, domain string) (Record, error) {
+	domain = strings.ToLower(domain)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[domain]
+	c.mu.Unlock()
+
+	if ok && now.Before(entry.expiresAt) {
+		record := entry.record
+		record.TTL = entry.expiresAt.Sub(now)
+		return record, entry.err
+	}
+
+	record, err := c.resolver.Resolve(ctx, domain)
+	switch {
+	case err == nil:
+		c.set(domain, cacheEntry{record: record, expiresAt: now.Add(record.TTL)})
+	case errors.Is(err, ErrNotFound):
+		c.set(domain, cacheEntry{err: ErrNotFound, expiresAt: now.Add(notFoundTTL)})
+	}
+
+	return record, err
+}
+
+func (c *cache) set(domain string, entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+
+	c.entries[domain] = entry
+}
+
+// evict removes expired entries, or the one expiring first if all are alive.
+func (c *cache) evict() {
+	now := time.Now()
+
+	var (
+		oldest    string
+		oldestExp time.Time
+	)
+	for domain, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, domain)
+			continue
+		}
+
+		if oldest == "" || entry.expiresAt.Before(oldestExp) {
+			oldest = domain
+			oldestExp = entry.expiresAt
+		}
+	}
+
+	if len(c.entries) >= c.maxEntries && oldest != "" {
+		delete(c.entries, oldest)
+	}
+}
+
+func NewCache(resolver Resolver, maxEntries int) Resolver {
+	if maxEntries <= 0 {
+		maxEntries = 1
+	}
+
+	return &cache{
+		resolver:   resolver,
+		maxEntries: maxEntries,
+		entries:    make(map[string]cacheEntry, maxEntries),
+	}
+}
@@ -0,0 +1,135 @@
+package tondns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeResolver returns preset results and counts lookups of every domain.
+type fakeResolver struct {
+	records map[string]Record
+	err     error
+	calls   map[string]int
+}
+
+func (r *fakeResolver) Resolve(_ context.Context, domain string) (Record, error) {
+	r.calls[domain]++
+
+	if r.err != nil {
+		return Record{}, r.err
+	}
+
+	record, ok := r.records[domain]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+
+	return record, nil
+}
+
+func newFakeResolver(records map[string]Record) *fakeResolver {
+	return &fakeResolver{
+		records: records,
+		calls:   make(map[string]int),
+	}
+}
+
+func TestCacheHit(t *testing.T) {
+	fake := newFakeResolver(map[string]Record{
+		"a.ton": {BagID: "aa", TTL: time.Hour},
+	})
+	c := NewCache(fake, 10)
+
+	for range 3 {
+		record, err := c.Resolve(context.Background(), "A.ton")
+		if err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+
+		if record.BagID != "aa" || record.TTL <= 0 || record.TTL > time.Hour {
+			t.Fatalf("Resolve = %+v, want aa with remaining TTL", record)
+		}
+	}
+
+	if fake.calls["a.ton"] != 1 {
+		t.Fatalf("resolver called %d times, want 1", fake.calls["a.ton"])
+	}
+}
+
+func TestCacheExpired(t *testing.T) {
+	fake := newFakeResolver(map[string]Record{
+		"a.ton": {BagID: "aa", TTL: 0},
+	})
+	c := NewCache(fake, 10)
+
+	for range 2 {
+		if _, err := c.Resolve(context.Background(), "a.ton"); err != nil {
+			t.Fatalf("Resolve: %v", err)
+		}
+	}
+
+	if fake.calls["a.ton"] != 2 {
+		t.Fatalf("resolver called %d times, want 2", fake.calls["a.ton"])
+	}
+}
+
+func TestCacheNotFound(t *testing.T) {
+	fake := newFakeResolver(nil)
+	c := NewCache(fake, 10)
+
+	for range 2 {
+		record, err := c.Resolve(context.Background(), "missing.ton")
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Resolve error = %v, want ErrNotFound", err)
+		}
+
+		if record.TTL > notFoundTTL {
+			t.Fatalf("not found TTL = %v, want at most %v", record.TTL, notFoundTTL)
+		}
+	}
+
+	if fake.calls["missing.ton"] != 1 {
+		t.Fatalf("resolver called %d times, want 1", fake.calls["missing.ton"])
+	}
+}
+
+func TestCacheTemporaryError(t *testing.T) {
+	fake := newFakeResolver(nil)
+	fake.err = errors.New("liteserver timeout")
+	c := NewCache(fake, 10)
+
+	for range 2 {
+		if _, err := c.Resolve(context.Background(), "a.ton"); !errors.Is(err, fake.err) {
+			t.Fatalf("Resolve error = %v, want %v", err, fake.err)
+		}
+	}
+
+	if fake.calls["a.ton"] != 2 {
+		t.Fatalf("resolver called %d times, want 2", fake.calls["a.ton"])
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	fake := newFakeResolver(map[string]Record{
+		"a.ton": {BagID: "aa", TTL: time.Minute},
+		"b.ton": {BagID: "bb", TTL: time.Hour},
+		"c.ton": {BagID: "cc", TTL: time.Hour},
+	})
+	c := NewCache(fake, 2)
+
+	for _, domain := range []string{"a.ton", "b.ton", "c.ton", "b.ton", "c.ton", "a.ton"} {
+		if _, err := c.Resolve(context.Background(), domain); err != nil {
+			t.Fatalf("Resolve(%q): %v", domain, err)
+		}
+	}
+
+	// a.ton expires first, so it's evicted for c.ton and resolved again
+	want := map[string]int{"a.ton": 2, "b.ton": 1, "c.ton": 1}
+	for domain, n := range want {
+		if fake.calls[domain] != n {
+			t.Errorf("resolver called %d times for %q, want %d", fake.calls[domain], domain, n)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package tondns
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xssnick/tonutils-go/liteclient"
+	"github.com/xssnick/tonutils-go/ton"
+	"github.com/xssnick/tonutils-go/ton/dns"
+)
+
+// LiteclientResolver reads DNS records from the blockchain through liteservers.
+type LiteclientResolver struct {
+	pool *liteclient.ConnectionPool
+	dns  *dns.Client
+	ttl  time.Duration
+}
+
+// Resolve runs dnsresolve get methods of the DNS contracts chain and reads the storage site record.
+// TON DNS records have no TTL, so the configured one is returned.
+func (r *LiteclientResolver) Resolve(ctx context.Context, domain string) (Record, error) {
+	d, err := r.dns.Resolve(ctx, strings.ToLower(domain))
+	if err != nil {
+		if errors.Is(err, dns.ErrNoSuchRecord) {
+			return Record{}, ErrNotFound
+		}
+
+		return Record{}, fmt.Errorf("failed to resolve %q: %w", domain, err)
+	}
+
+	bagID, inStorage := d.GetSiteRecord()
+	if !inStorage || len(bagID) != 32 {
+		return Record{}, ErrNotFound
+	}
+
+	return Record{
+		BagID: hex.EncodeToString(bagID),
+		TTL:   r.ttl,
+	}, nil
+}
+
+func (r *LiteclientResolver) Close() {
+	r.pool.Stop()
+}
+
+// NewLiteclientResolver connects to liteservers from the global config and finds the root DNS contract.
+func NewLiteclientResolver(ctx context.Context, configURL string, ttl time.Duration) (*LiteclientResolver, error) {
+	if configURL == "" {
+		configURL = "https://ton-blockchain.github.io/global.config.json"
+	}
+
+	pool := liteclient.NewConnectionPool()
+	if err := pool.AddConnectionsFromConfigUrl(ctx, configURL); err != nil {
+		return nil, fmt.Errorf("failed to connect to liteservers: %w", err)
+	}
+
+	api := ton.NewAPIClient(pool, ton.ProofCheckPolicyFast).WithRetry()
+
+	root, err := dns.GetRootContractAddr(ctx, api)
+	if err != nil {
+		pool.Stop()
+		return nil, fmt.Errorf("failed to get root DNS contract: %w", err)
+	}
+
+	return &LiteclientResolver{
+		pool: pool,
+		dns:  dns.NewDNSClient(api, root),
+		ttl:  ttl,
+	}, nil
+}
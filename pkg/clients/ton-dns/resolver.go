@@ -0,0 +1,46 @@
+package tondns
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("domain not found")
+
+// Resolver resolves TON DNS domains like "foundation.ton" to bag IDs
+// from their "storage" site records.
+type Resolver interface {
+	Resolve(ctx context.Context, domain string) (Record, error)
+}
+
+type Record struct {
+	// BagID is a lowercase hex bag ID
+	BagID string
+	// TTL is how long the record may be cached
+	TTL time.Duration
+}
+
+// IsDomain reports whether name looks like a TON DNS domain: dot separated labels ending with .ton
+func IsDomain(name string) bool {
+	name = strings.ToLower(name)
+	if len(name) > 126 || !strings.HasSuffix(name, ".ton") {
+		return false
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+
+		for i := range len(label) {
+			c := label[i]
+			if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
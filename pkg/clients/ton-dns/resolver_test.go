@@ -0,0 +1,50 @@
+package tondns
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsDomain(t *testing.T) {
+	cases := map[string]bool{
+		"foundation.ton":                  true,
+		"Sub.Foundation.TON":              true,
+		"a-b.ton":                         true,
+		"ton":                             false,
+		".ton":                            false,
+		"a..ton":                          false,
+		"-a.ton":                          false,
+		"a-.ton":                          false,
+		"a_b.ton":                         false,
+		"foundation.com":                  false,
+		"a/b.ton":                         false,
+		strings.Repeat("a", 123) + ".ton": false,
+	}
+
+	for name, want := range cases {
+		if got := IsDomain(name); got != want {
+			t.Errorf("IsDomain(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestStaticResolver(t *testing.T) {
+	r := NewStaticResolver(map[string]string{"Site.ton": "ABCD"}, time.Minute)
+
+	record, err := r.Resolve(context.Background(), "site.TON")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	if record.BagID != "abcd" || record.TTL != time.Minute {
+		t.Fatalf("Resolve = %+v, want abcd with a minute TTL", record)
+	}
+
+	r.Delete("SITE.ton")
+	if _, err = r.Resolve(context.Background(), "site.ton"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Resolve after Delete error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,59 @@
+package tondns
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StaticResolver serves records configured at startup, the gateway runs without liteservers then.
+type StaticResolver struct {
+	mu      sync.RWMutex
+	records map[string]string
+	ttl     time.Duration
+}
+
+func (r *StaticResolver) Resolve(_ context.Context, domain string) (Record, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	bagID, ok := r.records[strings.ToLower(domain)]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+
+	return Record{
+		BagID: bagID,
+		TTL:   r.ttl,
+	}, nil
+}
+
+// Set points the domain to the bag.
+func (r *StaticResolver) Set(domain, bagID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records[strings.ToLower(domain)] = strings.ToLower(bagID)
+}
+
+func (r *StaticResolver) Delete(domain string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.records, strings.ToLower(domain))
+}
+
+// NewStaticResolver creates a resolver serving records from the domain -> bag ID map.
+func NewStaticResolver(records map[string]string, ttl time.Duration) *StaticResolver {
+	r := &StaticResolver{
+		records: make(map[string]string, len(records)),
+		ttl:     ttl,
+	}
+
+	for domain, bagID := range records {
+		r.Set(domain, bagID)
+	}
+
+	return r
+}
@@ -12,6 +12,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -19,11 +20,20 @@ var ErrNotFound = errors.New("not found")
 
 type Client interface {
 	GetBag(ctx context.Context, bagId string) (*BagDetailed, error)
+	GetPieceProof(ctx context.Context, bagId string, piece uint32) ([]byte, error)
+	AddBag(ctx context.Context, bagId string, downloadAll bool) error
+	RemoveBag(ctx context.Context, bagId string, withFiles bool) error
+	ListBags(ctx context.Context) (*List, error)
+	CreateBag(ctx context.Context, path, description string) (string, error)
 }
 
+// createBagTimeout is longer than the default timeout, the daemon hashes all files before it responds
+const createBagTimeout = 10 * time.Minute
+
 type client struct {
 	base        string
 	client      http.Client
+	slowClient  http.Client
 	credentials *Credentials
 }
 
@@ -43,7 +53,104 @@ func (c *client) GetBag(ctx context.Context, bagId string) (*BagDetailed, error)
 	return &res, nil
 }
 
+// GetPieceProof returns the merkle proof of the piece against the bag merkle hash as a serialized cell.
+func (c *client) GetPieceProof(ctx context.Context, bagId string, piece uint32) ([]byte, error) {
+	var res ProofResponse
+	if err := c.doRequest(ctx, "GET", fmt.Sprintf("/api/v1/piece/proof?bag_id=%s&piece=%d", bagId, piece), nil, &res); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to do request: %w", err)
+	}
+
+	return res.Proof, nil
+}
+
+// AddBag starts downloading the bag into the default directory of the daemon.
+// Without downloadAll only the header is downloaded, files are fetched on demand.
+func (c *client) AddBag(ctx context.Context, bagId string, downloadAll bool) error {
+	type request struct {
+		BagID       string   `json:"bag_id"`
+		Path        string   `json:"path"`
+		Files       []uint32 `json:"files"`
+		DownloadAll bool     `json:"download_all"`
+	}
+
+	var res Result
+	if err := c.doRequest(ctx, "POST", "/api/v1/add", request{
+		BagID:       bagId,
+		DownloadAll: downloadAll,
+	}, &res); err != nil {
+		return fmt.Errorf("failed to do request: %w", err)
+	}
+
+	if !res.Ok {
+		return fmt.Errorf("error in response: %s", res.Error)
+	}
+	return nil
+}
+
+// RemoveBag stops the bag, downloaded files are deleted only with withFiles.
+func (c *client) RemoveBag(ctx context.Context, bagId string, withFiles bool) error {
+	type request struct {
+		BagID     string `json:"bag_id"`
+		WithFiles bool   `json:"with_files"`
+	}
+
+	var res Result
+	if err := c.doRequest(ctx, "POST", "/api/v1/remove", request{
+		BagID:     bagId,
+		WithFiles: withFiles,
+	}, &res); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrNotFound
+		}
+
+		return fmt.Errorf("failed to do request: %w", err)
+	}
+
+	if !res.Ok {
+		return fmt.Errorf("error in response: %s", res.Error)
+	}
+	return nil
+}
+
+func (c *client) ListBags(ctx context.Context) (*List, error) {
+	var res List
+	if err := c.doRequest(ctx, "GET", "/api/v1/list", nil, &res); err != nil {
+		return nil, fmt.Errorf("failed to do request: %w", err)
+	}
+
+	return &res, nil
+}
+
+// CreateBag creates a bag from the file or directory at path, the path must be readable by the daemon.
+func (c *client) CreateBag(ctx context.Context, path, description string) (string, error) {
+	type request struct {
+		Path        string `json:"path"`
+		Description string `json:"description"`
+	}
+
+	var res Created
+	if err := c.doRequestWith(ctx, &c.slowClient, "POST", "/api/v1/create", request{
+		Path:        path,
+		Description: description,
+	}, &res); err != nil {
+		return "", fmt.Errorf("failed to do request: %w", err)
+	}
+
+	if res.BagID == "" {
+		return "", fmt.Errorf("empty bag id in response")
+	}
+	return strings.ToLower(res.BagID), nil
+}
+
 func (c *client) doRequest(ctx context.Context, method, url string, req, resp any) error {
+	return c.doRequestWith(ctx, &c.client, method, url, req, resp)
+}
+
+func (c *client) doRequestWith(ctx context.Context, hc *http.Client, method, url string, req, resp any) error {
 	buf := &bytes.Buffer{}
 	if req != nil {
 		if err := json.NewEncoder(buf).Encode(req); err != nil {
@@ -59,7 +166,7 @@ func (c *client) doRequest(ctx context.Context, method, url string, req, resp an
 		r.SetBasicAuth(c.credentials.Login, c.credentials.Password)
 	}
 
-	res, err := c.client.Do(r)
+	res, err := hc.Do(r)
 	if err != nil {
 		return fmt.Errorf("failed to make request: %w", err)
 	}
@@ -89,6 +196,9 @@ func NewClient(base string, credentials *Credentials) Client {
 		client: http.Client{
 			Timeout: 15 * time.Second,
 		},
+		slowClient: http.Client{
+			Timeout: createBagTimeout,
+		},
 		credentials: credentials,
 	}
 }
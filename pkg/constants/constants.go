@@ -2,9 +2,30 @@ package constants
 
 const (
 	MaxPathLength              = 4096
-	MaxFileServeSize           = 50 << 20 // 50 MiB
-	MaxHTMLFileSize            = 5 << 20  // 5 MiB
-	FileDownloadTimeoutSeconds = 60 * 3   // 3 minutes
+	MaxFileServeSize           = 50 << 20  // 50 MiB
+	MaxHTMLFileSize            = 5 << 20   // 5 MiB
+	MaxMarkdownFileSize        = 1 << 20   // 1 MiB, larger markdown files are served as text
+	MaxPreviewFileSize         = 2 << 20   // 2 MiB, larger text files are not shown on preview pages
+	FileDownloadTimeoutSeconds = 60 * 3    // 3 minutes, extended for large files by MinDownloadBytesPerSecond
+	MinDownloadBytesPerSecond  = 128 << 10 // 128 KiB/s
+
+	// Directory listings, HTML pages are always paginated, other formats only on request
+	ListingPageSize    = 500
+	MaxListingPageSize = 10000
+
+	// Recursive search, matching stops after MaxSearchResults files
+	MaxSearchQueryLength = 256
+	MaxSearchResults     = 10000
+
+	// Merkle proofs, pieces of remote bags are downloaded to get their proofs
+	MaxProofPieces = 256
+
+	// Uploads, files of a session are staged on disk until the bag is created
+	MaxUploadFiles = 10000
+
+	// Bags are content-addressed, so responses are cached as immutable
+	ImmutableCacheMaxAgeSeconds = 60 * 60 * 24 * 365 // 1 year
+	AliasCacheMaxAgeSeconds     = 60
 )
 
 // Sorting constants
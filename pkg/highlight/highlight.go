@@ -0,0 +1,227 @@
+// Package highlight marks up source code with spans for comments, strings, numbers and keywords.
+// It's a lexer of common token types, not a parser, so the result is approximate but never unsafe:
+// all of the source is HTML escaped.
+package highlight
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Span classes
+const (
+	classComment = "c"
+	classString  = "s"
+	classNumber  = "n"
+	classKeyword = "k"
+	classTag     = "t"
+)
+
+type token struct {
+	class string
+	text  string
+}
+
+// Supported reports whether there is a syntax for the file extension.
+func Supported(ext string) bool {
+	_, ok := languages[strings.ToLower(ext)]
+	return ok
+}
+
+// Lines returns HTML lines of the source. Spans are closed at the end of every line,
+// so the lines can be rendered separately. Unknown extensions are only escaped.
+func Lines(src, ext string) []string {
+	src = strings.ToValidUTF8(strings.ReplaceAll(src, "\r\n", "\n"), "�")
+	src = strings.TrimSuffix(src, "\n")
+
+	lang, ok := languages[strings.ToLower(ext)]
+	if !ok {
+		lines := strings.Split(src, "\n")
+		for i, line := range lines {
+			lines[i] = html.EscapeString(line)
+		}
+
+		return lines
+	}
+
+	var (
+		lines []string
+		line  strings.Builder
+	)
+	for _, t := range tokenize(src, lang) {
+		parts := strings.Split(t.text, "\n")
+		for i, part := range parts {
+			if i > 0 {
+				lines = append(lines, line.String())
+				line.Reset()
+			}
+
+			if part == "" {
+				continue
+			}
+
+			if t.class != "" {
+				line.WriteString(`<span class="` + t.class + `">` + html.EscapeString(part) + "</span>")
+			} else {
+				line.WriteString(html.EscapeString(part))
+			}
+		}
+	}
+
+	return append(lines, line.String())
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || r == '@' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func tokenize(src string, lang *language) []token {
+	var tokens []token
+	plainStart := 0
+
+	emit := func(start, end int, class string) {
+		if plainStart < start {
+			tokens = append(tokens, token{text: src[plainStart:start]})
+		}
+		tokens = append(tokens, token{class: class, text: src[start:end]})
+		plainStart = end
+	}
+
+	for i := 0; i < len(src); {
+		if end, ok := matchComment(src, i, lang); ok {
+			emit(i, end, classComment)
+			i = end
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(src[i:])
+
+		if lang.markup {
+			if r == '<' && i+1 < len(src) && (src[i+1] == '/' || src[i+1] == '!' || src[i+1] == '?' || isIdentStart(rune(src[i+1]))) {
+				end := i + 1
+				for end < len(src) && src[end] != '>' && src[end] != ' ' && src[end] != '\n' && src[end] != '\t' {
+					end++
+				}
+				if end < len(src) && src[end] == '>' {
+					end++
+				}
+
+				emit(i, end, classTag)
+				i = end
+				continue
+			}
+
+			// Attribute values inside tags
+			if strings.ContainsRune(lang.quotes, r) && i > 0 && src[i-1] == '=' {
+				end := stringEnd(src, i, r)
+				emit(i, end, classString)
+				i = end
+				continue
+			}
+
+			i += size
+			continue
+		}
+
+		switch {
+		case strings.ContainsRune(lang.quotes, r):
+			end := stringEnd(src, i, r)
+			emit(i, end, classString)
+			i = end
+
+		case unicode.IsDigit(r) && (i == 0 || !isIdentPart(lastRune(src[:i]))):
+			end := i
+			for end < len(src) && (isIdentPart(rune(src[end])) || src[end] == '.') {
+				end++
+			}
+			emit(i, end, classNumber)
+			i = end
+
+		case isIdentStart(r) && (i == 0 || !isIdentPart(lastRune(src[:i]))):
+			end := i + size
+			for end < len(src) {
+				next, n := utf8.DecodeRuneInString(src[end:])
+				if !isIdentPart(next) {
+					break
+				}
+				end += n
+			}
+
+			word := src[i:end]
+			if lang.caseInsensitive {
+				word = strings.ToLower(word)
+			}
+
+			if lang.keywords[word] {
+				emit(i, end, classKeyword)
+			}
+			i = end
+
+		default:
+			i += size
+		}
+	}
+
+	if plainStart < len(src) {
+		tokens = append(tokens, token{text: src[plainStart:]})
+	}
+
+	return tokens
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+// matchComment returns the end of the comment starting at i.
+func matchComment(src string, i int, lang *language) (int, bool) {
+	for _, c := range lang.lineComments {
+		if strings.HasPrefix(src[i:], c) {
+			// "#" inside words like "C#" or URLs like "a#b" isn't a comment
+			if c == "#" && i > 0 && !unicode.IsSpace(lastRune(src[:i])) {
+				continue
+			}
+
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				return len(src), true
+			}
+			return i + end, true
+		}
+	}
+
+	for _, c := range lang.blockComments {
+		if strings.HasPrefix(src[i:], c[0]) {
+			end := strings.Index(src[i+len(c[0]):], c[1])
+			if end < 0 {
+				return len(src), true
+			}
+			return i + len(c[0]) + end + len(c[1]), true
+		}
+	}
+
+	return 0, false
+}
+
+// stringEnd returns the end of the string opened by quote at i. Only backtick strings span lines.
+func stringEnd(src string, i int, quote rune) int {
+	for j := i + 1; j < len(src); j++ {
+		switch {
+		case src[j] == '\\' && quote != '`':
+			j++
+		case rune(src[j]) == quote:
+			return j + 1
+		case src[j] == '\n' && quote != '`':
+			return j
+		}
+	}
+
+	return len(src)
+}
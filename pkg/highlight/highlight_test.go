@@ -0,0 +1,146 @@
+package highlight
+
+import (
+	"html"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	cases := []struct {
+		name string
+		ext  string
+		src  string
+		want []string
+	}{
+		{
+			"unterminated string ends at the line",
+			"go", "s := \"<script>\nx",
+			[]string{`s := <span class="s">&#34;&lt;script&gt;</span>`, "x"},
+		},
+		{
+			"unterminated raw string spans lines",
+			"go", "x := `<b>\n</b>",
+			[]string{"x := <span class=\"s\">`&lt;b&gt;</span>", `<span class="s">&lt;/b&gt;</span>`},
+		},
+		{
+			"escaped quote",
+			"go", `"a\"<b>"`,
+			[]string{`<span class="s">&#34;a\&#34;&lt;b&gt;&#34;</span>`},
+		},
+		{
+			"backslash at the end",
+			"go", `"a\`,
+			[]string{`<span class="s">&#34;a\</span>`},
+		},
+		{
+			"unterminated block comment",
+			"go", "/* <b> \n x",
+			[]string{`<span class="c">/* &lt;b&gt; </span>`, `<span class="c"> x</span>`},
+		},
+		{
+			"line comment",
+			"go", "// <b>&amp;",
+			[]string{`<span class="c">// &lt;b&gt;&amp;amp;</span>`},
+		},
+		{
+			"keywords numbers and plain text",
+			"go", "func <x> 1<2 &",
+			[]string{`<span class="k">func</span> &lt;x&gt; <span class="n">1</span>&lt;<span class="n">2</span> &amp;`},
+		},
+		{
+			"hash comment",
+			"py", "# <i>\n'<'",
+			[]string{`<span class="c"># &lt;i&gt;</span>`, `<span class="s">&#39;&lt;&#39;</span>`},
+		},
+		{
+			"case insensitive keywords",
+			"sql", "select '<' -- <b>",
+			[]string{`<span class="k">select</span> <span class="s">&#39;&lt;&#39;</span> <span class="c">-- &lt;b&gt;</span>`},
+		},
+		{
+			"markup",
+			"html", `<a href="x"><b>&amp;</b><!-- <c>`,
+			[]string{`<span class="t">&lt;a</span> href=<span class="s">&#34;x&#34;</span>&gt;<span class="t">&lt;b&gt;</span>&amp;amp;<span class="t">&lt;/b&gt;</span><span class="c">&lt;!-- &lt;c&gt;</span>`},
+		},
+		{
+			"unterminated attribute",
+			"html", `<a href='<b>`,
+			[]string{`<span class="t">&lt;a</span> href=<span class="s">&#39;&lt;b&gt;</span>`},
+		},
+		{
+			"bare bracket in markup",
+			"html", "<",
+			[]string{"&lt;"},
+		},
+		{
+			"unknown extension",
+			"txt", "<b>&\n\"",
+			[]string{"&lt;b&gt;&amp;", "&#34;"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Lines(tc.src, tc.ext); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Lines(%q, %q)\n got: %q\nwant: %q", tc.src, tc.ext, got, tc.want)
+			}
+		})
+	}
+}
+
+var spanRe = regexp.MustCompile(`<span class="[a-z]">|</span>`)
+
+// checkEscaped fails if the lines have markup other than the spans,
+// or don't give back the source once the spans are removed and the text is unescaped.
+func checkEscaped(t *testing.T, src, ext string) {
+	t.Helper()
+
+	lines := Lines(src, ext)
+	for _, line := range lines {
+		if text := spanRe.ReplaceAllString(line, ""); strings.ContainsAny(text, `<>"'`) {
+			t.Fatalf("Lines(%q, %q): unescaped text in %q", src, ext, line)
+		}
+	}
+
+	want := strings.TrimSuffix(strings.ToValidUTF8(strings.ReplaceAll(src, "\r\n", "\n"), "�"), "\n")
+	if got := html.UnescapeString(spanRe.ReplaceAllString(strings.Join(lines, "\n"), "")); got != want {
+		t.Fatalf("Lines(%q, %q): source changed\n got: %q\nwant: %q", src, ext, got, want)
+	}
+}
+
+var escapeSources = []string{
+	`"<script>alert(1)</script>`,
+	"'<img src=x onerror=alert(1)>",
+	"`<b>\n</b>",
+	"/* <b>\n*/ <i> /* <s>",
+	"// <b>\n# <i>\n-- <s>\n; <u>",
+	`"\<b>\"<i>`,
+	`"a\`,
+	"<a href=\"<b>\" title='<i>'>&amp;</a><!-- <c>",
+	"<?php echo '<b>'; ?> <!DOCTYPE html> </x",
+	"func 0x1<2 && a>b; C# a#b @x $y",
+	"\xff<\xfe>\r\n<b>",
+}
+
+func TestLinesEscapesAllLanguages(t *testing.T) {
+	for ext := range languages {
+		for _, src := range escapeSources {
+			checkEscaped(t, src, ext)
+		}
+	}
+}
+
+func FuzzLines(f *testing.F) {
+	for _, src := range escapeSources {
+		f.Add(src, "go")
+		f.Add(src, "html")
+		f.Add(src, "py")
+	}
+
+	f.Fuzz(func(t *testing.T, src, ext string) {
+		checkEscaped(t, src, ext)
+	})
+}
@@ -0,0 +1,184 @@
+package highlight
+
+import "strings"
+
+type language struct {
+	lineComments  []string
+	blockComments [][2]string
+	// quotes are the string delimiters, only backtick strings span lines
+	quotes string
+	// markup highlights tags instead of keywords and strings
+	markup          bool
+	caseInsensitive bool
+	keywords        map[string]bool
+}
+
+func words(s string) map[string]bool {
+	result := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		result[w] = true
+	}
+
+	return result
+}
+
+var (
+	cLike = [][2]string{{"/*", "*/"}}
+
+	goLang = &language{
+		lineComments:  []string{"//"},
+		blockComments: cLike,
+		quotes:        "\"'`",
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var
+			true false nil iota any bool byte error int int8 int16 int32 int64 uint uint8 uint16 uint32 uint64
+			uintptr float32 float64 complex64 complex128 rune string append cap close copy delete len make new panic recover`),
+	}
+
+	cLang = &language{
+		lineComments:  []string{"//"},
+		blockComments: cLike,
+		quotes:        `"'`,
+		keywords: words(`auto break case char const continue default do double else enum extern float for goto if
+			inline int long register return short signed sizeof static struct switch typedef union unsigned void
+			volatile while bool true false class namespace template typename public private protected virtual
+			override new delete this nullptr using try catch throw operator friend`),
+	}
+
+	javaLang = &language{
+		lineComments:  []string{"//"},
+		blockComments: cLike,
+		quotes:        `"'`,
+		keywords: words(`abstract assert boolean break byte case catch char class const continue default do double
+			else enum extends final finally float for goto if implements import instanceof int interface long
+			native new package private protected public return short static strictfp super switch synchronized
+			this throw throws transient try void volatile while var record true false null`),
+	}
+
+	jsLang = &language{
+		lineComments:  []string{"//"},
+		blockComments: cLike,
+		quotes:        "\"'`",
+		keywords: words(`async await break case catch class const continue debugger default delete do else export
+			extends finally for from function if import in instanceof let new of return static super switch this
+			throw try typeof var void while with yield true false null undefined
+			interface type enum implements private protected public readonly as declare namespace abstract`),
+	}
+
+	phpLang = &language{
+		lineComments:  []string{"//", "#"},
+		blockComments: cLike,
+		quotes:        `"'`,
+		keywords: words(`abstract and array as break callable case catch class clone const continue declare default
+			do echo else elseif empty enddeclare endfor endforeach endif endswitch endwhile extends final finally fn
+			for foreach function global goto if implements include include_once instanceof insteadof interface isset
+			list match namespace new or print private protected public readonly require require_once return static
+			switch throw trait try unset use var while yield true false null`),
+	}
+
+	pythonLang = &language{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords: words(`False None True and as assert async await break class continue def del elif else except
+			finally for from global if import in is lambda nonlocal not or pass raise return try while with yield
+			self print`),
+	}
+
+	rubyLang = &language{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords: words(`BEGIN END alias and begin break case class def defined do else elsif end ensure false for
+			if in module next nil not or redo rescue retry return self super then true undef unless until when
+			while yield require attr_accessor attr_reader puts`),
+	}
+
+	rustLang = &language{
+		lineComments:  []string{"//"},
+		blockComments: cLike,
+		quotes:        `"`,
+		keywords: words(`as async await break const continue crate dyn else enum extern false fn for if impl in let
+			loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where
+			while i8 i16 i32 i64 i128 isize u8 u16 u32 u64 u128 usize f32 f64 bool char str String Vec Option
+			Result Some None Ok Err`),
+	}
+
+	shellLang = &language{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords: words(`if then else elif fi case esac for while until do done in function return local export
+			echo exit set unset readonly shift source`),
+	}
+
+	sqlLang = &language{
+		lineComments:    []string{"--"},
+		blockComments:   cLike,
+		quotes:          `'"`,
+		caseInsensitive: true,
+		keywords: words(`select from where and or not insert into values update set delete create table index view
+			drop alter add column primary key foreign references join left right inner outer on group by order
+			having limit offset as distinct union all null is in exists between like case when then else end
+			begin commit rollback if returning with default unique constraint`),
+	}
+
+	cssLang = &language{
+		blockComments: cLike,
+		quotes:        `"'`,
+		keywords:      words(`@media @import @font-face @keyframes @supports @charset`),
+	}
+
+	iniLang = &language{
+		lineComments: []string{";", "#"},
+		quotes:       `"'`,
+		keywords:     words(`true false yes no on off`),
+	}
+
+	configLang = &language{
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords:     words(`true false null yes no on off`),
+	}
+
+	jsonLang = &language{
+		quotes:   `"`,
+		keywords: words(`true false null`),
+	}
+
+	markupLang = &language{
+		blockComments: [][2]string{{"<!--", "-->"}},
+		quotes:        `"'`,
+		markup:        true,
+	}
+)
+
+var languages = map[string]*language{
+	"go":    goLang,
+	"c":     cLang,
+	"h":     cLang,
+	"cpp":   cLang,
+	"hpp":   cLang,
+	"java":  javaLang,
+	"js":    jsLang,
+	"mjs":   jsLang,
+	"ts":    jsLang,
+	"tsx":   jsLang,
+	"php":   phpLang,
+	"py":    pythonLang,
+	"rb":    rubyLang,
+	"rs":    rustLang,
+	"sh":    shellLang,
+	"sql":   sqlLang,
+	"css":   cssLang,
+	"yaml":  configLang,
+	"yml":   configLang,
+	"toml":  configLang,
+	"ini":   iniLang,
+	"cfg":   iniLang,
+	"conf":  configLang,
+	"json":  jsonLang,
+	"map":   jsonLang,
+	"html":  markupLang,
+	"htm":   markupLang,
+	"xhtml": markupLang,
+	"xml":   markupLang,
+	"svg":   markupLang,
+}
@@ -0,0 +1,154 @@
+package httpServer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+)
+
+// aliasesBase is the prefix of public alias routes: /g/<slug>/<path>
+const aliasesBase = "/g"
+
+// aliasLocal is set when the bag was requested by an alias, the alias may point to another bag later.
+const aliasLocal = "alias"
+
+func isAlias(c *fiber.Ctx) bool {
+	_, ok := c.Locals(aliasLocal).(string)
+	return ok
+}
+
+// getAliasPath serves /g/<slug>/<path> as the path inside the alias target.
+func (h *handler) getAliasPath(c *fiber.Ctx) (err error) {
+	slug := strings.ToLower(c.Params("slug"))
+	rawPath := c.Params("*")
+
+	log := h.logger.With(
+		slog.String("func", "getAliasPath"),
+		slog.String("slug", slug),
+		slog.String("raw_path", rawPath),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	decodedPath, err := url.QueryUnescape(rawPath)
+	if err != nil {
+		log.Error("failed to decode path", slog.String("error", err.Error()))
+		err = fiber.NewError(fiber.StatusBadRequest, "invalid path encoding")
+		return errorHandler(c, err)
+	}
+
+	alias, err := h.aliases.Resolve(c.Context(), slug)
+	if err != nil {
+		log.Error("failed to resolve alias", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	if alias == nil {
+		return errorHandler(c, fiber.NewError(fiber.StatusNotFound, "alias not found"))
+	}
+
+	c.Locals(aliasLocal, slug)
+
+	return h.getBagInfoResponse(c, alias.BagID, path.Join(alias.Path, decodedPath), log.With(slog.String("bagid", alias.BagID)))
+}
+
+func (h *handler) getAllAliases(c *fiber.Ctx) error {
+	log := h.logger.With(
+		slog.String("func", "getAllAliases"),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	limit := c.QueryInt("limit", 100)
+	offset := c.QueryInt("offset", 0)
+
+	aliases, err := h.aliases.GetAllAliases(c.Context(), limit, offset)
+	if err != nil {
+		log.Error("failed to get aliases", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"aliases": aliases,
+	})
+}
+
+func (h *handler) getAlias(c *fiber.Ctx) error {
+	slug := strings.ToLower(c.Params("slug"))
+	log := h.logger.With(
+		slog.String("func", "getAlias"),
+		slog.String("slug", slug),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	alias, err := h.aliases.GetAlias(c.Context(), slug)
+	if err != nil {
+		log.Error("failed to get alias", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	if alias == nil {
+		return errorHandler(c, fiber.NewError(fiber.StatusNotFound, "alias not found"))
+	}
+
+	return c.JSON(fiber.Map{
+		"alias": alias,
+	})
+}
+
+// putAlias creates the alias or repoints it, the previous target is kept in the alias history.
+func (h *handler) putAlias(c *fiber.Ctx) (err error) {
+	body := c.Body()
+	log := h.logger.With(
+		slog.String("func", "putAlias"),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+		slog.Int("body_length", len(body)),
+	)
+
+	if len(body) == 0 || body[0] != '{' {
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid request body"))
+	}
+
+	var alias v1.Alias
+	if err = json.Unmarshal(body, &alias); err != nil {
+		log.Error("failed to parse request body", slog.String("error", err.Error()))
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid request body"))
+	}
+
+	if err = h.aliases.SetAlias(c.Context(), alias); err != nil {
+		log.Error("failed to set alias", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (h *handler) deleteAlias(c *fiber.Ctx) error {
+	slug := strings.ToLower(c.Params("slug"))
+	log := h.logger.With(
+		slog.String("func", "deleteAlias"),
+		slog.String("slug", slug),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	if err := h.aliases.DeleteAlias(c.Context(), slug); err != nil {
+		log.Error("failed to delete alias", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,195 @@
+package httpServer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"mytonstorage-gateway/pkg/models/private"
+)
+
+const (
+	archiveZip   = "zip"
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+)
+
+var archiveContentTypes = map[string]string{
+	archiveZip:   "application/zip",
+	archiveTar:   "application/x-tar",
+	archiveTarGz: "application/gzip",
+}
+
+type archiveWriter interface {
+	add(name string, size uint64, r io.Reader) error
+	Close() error
+}
+
+// serveArchive streams all files under the directory path as an archive.
+// Files are read one after another and written on the fly, nothing is buffered.
+func (h *handler) serveArchive(c *fiber.Ctx, bagid, path, format string, log *slog.Logger) error {
+	contentType, ok := archiveContentTypes[format]
+	if !ok {
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "unsupported archive format"))
+	}
+
+	tree, err := h.files.ListTree(c.Context(), bagid, path)
+	if err != nil {
+		return errorHandler(c, mapPathInfoError(err, private.FolderInfo{}, log))
+	}
+
+	limits, ok := h.streamLimits(tree.TotalSize)
+	if !ok {
+		return errorHandler(c, fiber.NewError(fiber.StatusRequestEntityTooLarge, "directory too large, use https://github.com/xssnick/TON-Torrent"))
+	}
+
+	root := bagid
+	if path != "." {
+		root = filepath.Base(path)
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, contentDisposition("attachment", root+"."+format))
+
+	if c.Method() == fiber.MethodHead {
+		return nil
+	}
+
+	if err := h.checkQuota(c, bagid, &limits); err != nil {
+		return errorHandler(c, err)
+	}
+
+	ctx := c.Context()
+	pr, pw := io.Pipe()
+	go func() {
+		err := h.writeArchive(ctx, pw, tree, path, root, format)
+		if err != nil {
+			log.Warn("failed to write archive", slog.String("error", err.Error()))
+		}
+
+		_ = pw.CloseWithError(err)
+	}()
+
+	return streamWithDeadline(c, pr, -1, limits)
+}
+
+func (h *handler) writeArchive(ctx context.Context, w io.Writer, tree private.FileTree, path, root, format string) (err error) {
+	var aw archiveWriter
+	switch format {
+	case archiveZip:
+		aw = &zipArchive{w: zip.NewWriter(w)}
+	case archiveTar:
+		aw = &tarArchive{w: tar.NewWriter(w)}
+	case archiveTarGz:
+		gz := gzip.NewWriter(w)
+		aw = &tarArchive{w: tar.NewWriter(gz), gz: gz}
+	}
+
+	prefix := strings.Trim(path, string(filepath.Separator)) + string(filepath.Separator)
+	for _, f := range tree.Files {
+		rel := f.Name
+		if path != "." {
+			rel = strings.TrimPrefix(f.Name, prefix)
+		}
+
+		// Never produce entries escaping the archive root
+		rel, err = sanitizePath(rel)
+		if err != nil {
+			return fmt.Errorf("invalid file name %q: %w", f.Name, err)
+		}
+
+		var r io.ReadCloser
+		r, err = h.openTreeFile(ctx, tree, f.Name)
+		if err != nil {
+			return fmt.Errorf("failed to open %q: %w", f.Name, err)
+		}
+
+		err = aw.add(filepath.ToSlash(filepath.Join(root, rel)), f.Size, r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("failed to add %q: %w", f.Name, err)
+		}
+	}
+
+	return aw.Close()
+}
+
+func (h *handler) openTreeFile(ctx context.Context, tree private.FileTree, name string) (io.ReadCloser, error) {
+	if tree.LocalRoot != "" {
+		p, err := sanitizePath(filepath.Join(tree.LocalRoot, name))
+		if err != nil {
+			return nil, err
+		}
+
+		return os.Open(p)
+	}
+
+	stream, err := h.files.StreamFile(ctx, tree.BagID, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream.FileStream, nil
+}
+
+type zipArchive struct {
+	w *zip.Writer
+}
+
+func (a *zipArchive) add(name string, size uint64, r io.Reader) error {
+	fw, err := a.w.CreateHeader(&zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(fw, r, int64(size))
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.w.Close()
+}
+
+type tarArchive struct {
+	w  *tar.Writer
+	gz *gzip.Writer
+}
+
+func (a *tarArchive) add(name string, size uint64, r io.Reader) error {
+	err := a.w.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(size),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(a.w, r, int64(size))
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.w.Close(); err != nil {
+		return err
+	}
+
+	if a.gz != nil {
+		return a.gz.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package httpServer
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// clientIPLocal holds the client IP resolved once per request by clientIPMiddleware
+const clientIPLocal = "client_ip"
+
+const (
+	headerXForwardedFor = "X-Forwarded-For"
+	headerXRealIP       = "X-Real-IP"
+	headerForwarded     = "Forwarded"
+)
+
+// clientIPResolver takes the client IP from the proxy header, but only
+// if the request came from one of the trusted proxies.
+type clientIPResolver struct {
+	trusted []*net.IPNet
+	header  string
+}
+
+// newClientIPResolver parses trusted proxies given as CIDRs or single IPs.
+// Header is one of X-Forwarded-For, X-Real-IP and Forwarded.
+func newClientIPResolver(trustedProxies []string, header string) clientIPResolver {
+	r := clientIPResolver{
+		header: headerXForwardedFor,
+	}
+
+	switch strings.ToLower(strings.TrimSpace(header)) {
+	case strings.ToLower(headerXRealIP):
+		r.header = headerXRealIP
+	case strings.ToLower(headerForwarded):
+		r.header = headerForwarded
+	}
+
+	for _, p := range trustedProxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+
+		if _, n, err := net.ParseCIDR(p); err == nil {
+			r.trusted = append(r.trusted, n)
+		}
+	}
+
+	return r
+}
+
+func (r clientIPResolver) isTrusted(ip net.IP) bool {
+	for _, n := range r.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r clientIPResolver) resolve(c *fiber.Ctx) string {
+	remote := c.Context().RemoteIP()
+	if len(r.trusted) == 0 || !r.isTrusted(remote) {
+		return remote.String()
+	}
+
+	var chain []string
+	switch r.header {
+	case headerXRealIP:
+		chain = []string{c.Get(headerXRealIP)}
+	case headerForwarded:
+		chain = forwardedFor(c.Get(headerForwarded))
+	default:
+		for _, v := range strings.Split(c.Get(headerXForwardedFor), ",") {
+			chain = append(chain, strings.TrimSpace(v))
+		}
+	}
+
+	// Each proxy appends the address it got the request from, so the chain is walked
+	// from the right and the first address which is not a trusted proxy is the client.
+	// Addresses on the left of it could be set by the client itself.
+	var client net.IP
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseNodeIP(chain[i])
+		if ip == nil {
+			break
+		}
+
+		client = ip
+		if !r.isTrusted(ip) {
+			break
+		}
+	}
+
+	if client == nil {
+		return remote.String()
+	}
+
+	return client.String()
+}
+
+// forwardedFor returns the for= parameters of the RFC 7239 Forwarded header in order.
+func forwardedFor(header string) []string {
+	var result []string
+
+	for _, element := range strings.Split(header, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				result = append(result, strings.Trim(value, `"`))
+			}
+		}
+	}
+
+	return result
+}
+
+// parseNodeIP parses an address which may have a port or be in brackets like "[2001:db8::1]:4711".
+// Obfuscated and unknown identifiers give nil.
+func parseNodeIP(node string) net.IP {
+	node = strings.TrimSpace(node)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+
+	return net.ParseIP(strings.Trim(node, "[]"))
+}
+
+// clientIPMiddleware resolves the client IP once, handlers get it with clientIP.
+func (h *handler) clientIPMiddleware(c *fiber.Ctx) error {
+	c.Locals(clientIPLocal, h.ipResolver.resolve(c))
+	return c.Next()
+}
+
+// clientIP returns the real client IP of the request.
+func clientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals(clientIPLocal).(string); ok {
+		return ip
+	}
+
+	return c.IP()
+}
@@ -0,0 +1,197 @@
+package httpServer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gofiber/fiber/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	encodingBrotli = "br"
+	encodingZstd   = "zstd"
+	encodingGzip   = "gzip"
+
+	// Smaller bodies don't get smaller enough to be worth it
+	minCompressSize = 1024
+
+	// Streams are compressed on the fly, so speed matters more than ratio
+	brotliLevel = 4
+)
+
+// Server side preference, the first one supported by the client is used
+var encodingsPreference = []string{encodingBrotli, encodingZstd, encodingGzip}
+
+// compressibleTypes are non text/* media types worth compressing.
+// Images, video, audio and archives are compressed by their formats already.
+var compressibleTypes = map[string]bool{
+	"application/javascript":        true,
+	"application/json":              true,
+	"application/x-ndjson":          true,
+	"application/xml":               true,
+	"application/xhtml+xml":         true,
+	"application/wasm":              true,
+	"application/vnd.ms-fontobject": true,
+	"image/svg+xml":                 true,
+	"image/bmp":                     true,
+	"image/vnd.microsoft.icon":      true,
+	"font/otf":                      true,
+	"font/ttf":                      true,
+}
+
+func isCompressible(contentType string) bool {
+	mimeType, _, _ := strings.Cut(contentType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+
+	return strings.HasPrefix(mimeType, "text/") || compressibleTypes[mimeType]
+}
+
+// negotiateEncoding picks the content coding from the Accept-Encoding header value.
+// Codings with higher q win, ties are broken by server preference.
+func negotiateEncoding(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.EqualFold(strings.TrimSpace(k), "q") {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = parsed
+			}
+		}
+
+		if name == "*" {
+			wildcard = q
+		} else {
+			weights[name] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodingsPreference {
+		q, ok := weights[encoding]
+		if !ok {
+			q = wildcard
+		}
+
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// responseEncoding decides whether the response of size bytes (-1 if unknown) is compressed and how.
+// Partial content is never compressed, byte ranges refer to the original representation.
+func responseEncoding(c *fiber.Ctx, size int) string {
+	resp := c.Response()
+	if c.Method() == fiber.MethodHead ||
+		resp.StatusCode() == fiber.StatusPartialContent ||
+		len(resp.Header.Peek(fiber.HeaderContentEncoding)) > 0 ||
+		!isCompressible(string(resp.Header.ContentType())) {
+		return ""
+	}
+
+	// Caches must keep the representations apart even if this client gets it uncompressed
+	c.Vary(fiber.HeaderAcceptEncoding)
+
+	if size >= 0 && size < minCompressSize {
+		return ""
+	}
+
+	return negotiateEncoding(c.Get(fiber.HeaderAcceptEncoding))
+}
+
+// setEncodingHeaders marks the response as compressed. The strong ETag identifies
+// the original bytes, so it's weakened, If-None-Match still matches it.
+func setEncodingHeaders(c *fiber.Ctx, encoding string) {
+	c.Set(fiber.HeaderContentEncoding, encoding)
+	c.Response().Header.Del(fiber.HeaderContentLength)
+
+	if etag := c.Response().Header.Peek(fiber.HeaderETag); len(etag) > 0 && !bytes.HasPrefix(etag, []byte("W/")) {
+		c.Set(fiber.HeaderETag, "W/"+string(etag))
+	}
+}
+
+func newEncoder(w io.Writer, encoding string) (io.WriteCloser, error) {
+	switch encoding {
+	case encodingBrotli:
+		return brotli.NewWriterLevel(w, brotliLevel), nil
+	case encodingZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return gzip.NewWriter(w), nil
+	}
+}
+
+// streamEncoded streams the body generated by write, compressed if the client supports it.
+// Content-Type must be set before, it decides whether the body is compressed.
+func streamEncoded(c *fiber.Ctx, write func(w io.Writer) error) {
+	encoding := responseEncoding(c, -1)
+	if encoding != "" {
+		setEncodingHeaders(c, encoding)
+	}
+
+	c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+		defer bw.Flush()
+
+		var w io.Writer = bw
+		if encoding != "" {
+			if cw, err := newEncoder(bw, encoding); err == nil {
+				defer cw.Close()
+				w = cw
+			}
+		}
+
+		_ = write(w)
+	})
+}
+
+// compressMiddleware compresses in-memory response bodies like listings and JSON.
+// Streamed bodies are compressed by streamWithDeadline.
+func (h *handler) compressMiddleware(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		return err
+	}
+
+	if c.Response().IsBodyStream() {
+		return nil
+	}
+
+	body := c.Response().Body()
+	encoding := responseEncoding(c, len(body))
+	if encoding == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc, err := newEncoder(&buf, encoding)
+	if err != nil {
+		return nil
+	}
+
+	if _, err = enc.Write(body); err != nil {
+		return nil
+	}
+	if err = enc.Close(); err != nil {
+		return nil
+	}
+
+	setEncodingHeaders(c, encoding)
+	c.Response().SetBodyRaw(buf.Bytes())
+
+	return nil
+}
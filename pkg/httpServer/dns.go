@@ -0,0 +1,42 @@
+package httpServer
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	tondns "mytonstorage-gateway/pkg/clients/ton-dns"
+)
+
+// domainTTLLocal holds the remaining TTL of the TON DNS record the bag was resolved from.
+const domainTTLLocal = "domain_ttl"
+
+// resolveBagID returns bag ID for the TON DNS domain, other values are returned as is.
+func (h *handler) resolveBagID(c *fiber.Ctx, bagid string, log *slog.Logger) (string, error) {
+	if h.dns == nil || !tondns.IsDomain(bagid) {
+		return bagid, nil
+	}
+
+	record, err := h.dns.Resolve(c.Context(), bagid)
+	if err != nil {
+		if errors.Is(err, tondns.ErrNotFound) {
+			log.Warn("domain has no storage record", slog.String("domain", bagid))
+			return "", fiber.NewError(fiber.StatusNotFound, "domain not found")
+		}
+
+		log.Error("failed to resolve domain", slog.String("domain", bagid), slog.String("error", err.Error()))
+		return "", fiber.NewError(fiber.StatusBadGateway, "failed to resolve domain")
+	}
+
+	c.Locals(domainTTLLocal, record.TTL)
+
+	return record.BagID, nil
+}
+
+// domainTTL returns the remaining TTL of the domain record if the bag was requested by domain.
+func domainTTL(c *fiber.Ctx) (time.Duration, bool) {
+	ttl, ok := c.Locals(domainTTLLocal).(time.Duration)
+	return ttl, ok
+}
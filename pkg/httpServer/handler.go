@@ -2,11 +2,13 @@ package httpServer
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 
+	tondns "mytonstorage-gateway/pkg/clients/ton-dns"
 	v1 "mytonstorage-gateway/pkg/models/api/v1"
 	"mytonstorage-gateway/pkg/models/private"
 	htmlTemplates "mytonstorage-gateway/pkg/templates"
@@ -16,10 +18,17 @@ type TokenPermissions struct {
 	Bans    bool
 	Reports bool
 	Metrics bool
+	Aliases bool
+	Pins    bool
+	Uploads bool
 }
 
 type files interface {
 	GetPathInfo(ctx context.Context, bagID, path string) (private.FolderInfo, error)
+	ListTree(ctx context.Context, bagID, path string) (private.FileTree, error)
+	StreamFile(ctx context.Context, bagID, path string, rng *private.ByteRange) (*private.StreamFile, error)
+	Manifest(ctx context.Context, bagID string) (v1.Manifest, error)
+	FileProof(ctx context.Context, bagID, path string, rng *private.ByteRange) (v1.FileProof, error)
 }
 
 type reports interface {
@@ -33,7 +42,47 @@ type reports interface {
 
 type templatesSvc interface {
 	ContentType(filename string) htmlTemplates.ContentType
-	HtmlFilesListWithTemplate(f private.FolderInfo, path string) (string, error)
+	SniffContentType(head []byte) htmlTemplates.ContentType
+	HtmlFilesListWithTemplate(f private.FolderInfo, path string, readme *htmlTemplates.Readme, listing htmlTemplates.Listing) (string, error)
+	SearchWithTemplate(result v1.SearchResult, listing htmlTemplates.Listing) (string, error)
+	MarkdownWithTemplate(f private.FolderInfo, path string, content []byte) (string, error)
+	PreviewWithTemplate(f private.FolderInfo, path string, size uint64, content []byte) (string, error)
+}
+
+type dnsResolver interface {
+	Resolve(ctx context.Context, domain string) (tondns.Record, error)
+}
+
+type quotas interface {
+	Check(ctx context.Context, ip, bagID string) error
+	Add(ctx context.Context, ip, bagID string, n uint64) error
+}
+
+type thumbnails interface {
+	Get(ctx context.Context, bagID string, fileIndex uint32, size int, open func() (io.ReadCloser, error)) ([]byte, error)
+}
+
+type aliases interface {
+	Resolve(ctx context.Context, slug string) (*v1.Alias, error)
+	GetAlias(ctx context.Context, slug string) (*v1.Alias, error)
+	GetAllAliases(ctx context.Context, limit int, offset int) ([]v1.Alias, error)
+	SetAlias(ctx context.Context, alias v1.Alias) error
+	DeleteAlias(ctx context.Context, slug string) error
+}
+
+type pins interface {
+	GetAllPins(ctx context.Context) ([]v1.Pin, error)
+	GetPin(ctx context.Context, bagID string) (*v1.Pin, error)
+	AddPin(ctx context.Context, bagID string, downloadAll bool) error
+	RemovePin(ctx context.Context, bagID string, withFiles bool) error
+}
+
+type uploads interface {
+	CreateSession(ctx context.Context, tokenHash, description string) (v1.UploadSession, error)
+	GetSession(ctx context.Context, tokenHash, id string) (v1.UploadSession, error)
+	WriteFile(ctx context.Context, tokenHash, id, path string, offset, total uint64, data io.Reader, length uint64) (v1.UploadFile, error)
+	Complete(ctx context.Context, tokenHash, id string) (v1.UploadResult, error)
+	Abort(ctx context.Context, tokenHash, id string) error
 }
 
 type errorResponse struct {
@@ -41,14 +90,31 @@ type errorResponse struct {
 }
 
 type handler struct {
-	server       *fiber.App
-	logger       *slog.Logger
-	files        files
-	reports      reports
-	templates    templatesSvc
-	namespace    string
-	subsystem    string
-	accessTokens map[string]TokenPermissions
+	server     *fiber.App
+	logger     *slog.Logger
+	files      files
+	reports    reports
+	templates  templatesSvc
+	dns        dnsResolver
+	quotas     quotas
+	thumbnails thumbnails
+	aliases    aliases
+	pins       pins
+	uploads    uploads
+	// uploadBodyLimit is the body limit of upload routes, other routes keep the server limit
+	uploadBodyLimit int
+	namespace       string
+	subsystem       string
+	accessTokens    map[string]TokenPermissions
+	bagsDomain      string
+	publicURL       string
+	ipResolver      clientIPResolver
+	websites        map[string]websiteSettings
+	sizeTiers       []sizeTier
+	bandwidth       *tokenBucket
+
+	rateLimits  RateLimits
+	rateCounter rateCounter
 }
 
 func New(
@@ -56,7 +122,23 @@ func New(
 	files files,
 	reports reports,
 	templates templatesSvc,
+	dns dnsResolver,
+	quotas quotas,
+	thumbnails thumbnails,
+	aliases aliases,
+	pins pins,
+	uploads uploads,
+	uploadBodyLimit int,
 	accessTokens []string,
+	trustedProxies []string,
+	clientIPHeader string,
+	bagsDomain string,
+	publicURL string,
+	websites []string,
+	sizeTiers []string,
+	globalBandwidth int64,
+	rateLimits RateLimits,
+	rateCounter rateCounter,
 	namespace string,
 	subsystem string,
 	logger *slog.Logger,
@@ -71,11 +153,13 @@ func New(
 			continue
 		}
 
-		// default
+		// default, pins delete data from the daemon and uploads use its disk,
+		// so they are granted only explicitly
 		permissions := TokenPermissions{
 			Bans:    true,
 			Reports: true,
 			Metrics: true,
+			Aliases: true,
 		}
 
 		if len(parts) > 1 {
@@ -91,10 +175,19 @@ func New(
 					permissions.Reports = true
 				case "metrics":
 					permissions.Metrics = true
+				case "aliases":
+					permissions.Aliases = true
+				case "pins":
+					permissions.Pins = true
+				case "uploads":
+					permissions.Uploads = true
 				case "all":
 					permissions.Bans = true
 					permissions.Reports = true
 					permissions.Metrics = true
+					permissions.Aliases = true
+					permissions.Pins = true
+					permissions.Uploads = true
 				}
 			}
 		}
@@ -103,14 +196,30 @@ func New(
 	}
 
 	h := &handler{
-		server:       server,
-		files:        files,
-		reports:      reports,
-		templates:    templates,
-		namespace:    namespace,
-		subsystem:    subsystem,
-		accessTokens: accessTokensMap,
-		logger:       logger,
+		server:          server,
+		files:           files,
+		reports:         reports,
+		templates:       templates,
+		dns:             dns,
+		quotas:          quotas,
+		thumbnails:      thumbnails,
+		aliases:         aliases,
+		pins:            pins,
+		uploads:         uploads,
+		uploadBodyLimit: uploadBodyLimit,
+		namespace:       namespace,
+		subsystem:       subsystem,
+		accessTokens:    accessTokensMap,
+		bagsDomain:      strings.Trim(strings.ToLower(bagsDomain), "."),
+		publicURL:       strings.TrimRight(publicURL, "/"),
+		ipResolver:      newClientIPResolver(trustedProxies, clientIPHeader),
+		websites:        parseWebsites(websites),
+		sizeTiers:       parseSizeTiers(sizeTiers, logger),
+		bandwidth:       newTokenBucket(globalBandwidth),
+		logger:          logger,
+
+		rateLimits:  rateLimits,
+		rateCounter: rateCounter,
 	}
 
 	return h
@@ -2,11 +2,14 @@ package httpServer
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log/slog"
 	"math"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,6 +22,7 @@ import (
 	"mytonstorage-gateway/pkg/iframewrap"
 	"mytonstorage-gateway/pkg/models"
 	"mytonstorage-gateway/pkg/models/private"
+	htmlTemplates "mytonstorage-gateway/pkg/templates"
 )
 
 func okHandler(c *fiber.Ctx) error {
@@ -28,6 +32,10 @@ func okHandler(c *fiber.Ctx) error {
 }
 
 func errorHandler(c *fiber.Ctx, err error) error {
+	// Errors like timeouts are temporary and must never be cached as immutable content
+	c.Response().Header.Del(fiber.HeaderCacheControl)
+	c.Response().Header.Del(fiber.HeaderETag)
+
 	if e, ok := err.(*fiber.Error); ok {
 		return c.Status(e.Code).JSON(fiber.Map{
 			"error": e.Message,
@@ -47,22 +55,6 @@ func errorHandler(c *fiber.Ctx, err error) error {
 	return c.Status(fiber.StatusInternalServerError).JSON(errorResponse)
 }
 
-func validateBagID(bagid string) bool {
-	if len(bagid) != 64 {
-		return false
-	}
-
-	bagid = strings.ToLower(bagid)
-	for i := range 64 {
-		c := bagid[i]
-		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
-			return false
-		}
-	}
-
-	return true
-}
-
 func sanitizePath(p string) (string, error) {
 	p = strings.TrimSpace(p)
 	if p == "" || p == "." || p == "/" {
@@ -119,7 +111,7 @@ func serveHTMLFile(c *fiber.Ctx, bagInfo private.FolderInfo) error {
 
 	if bagInfo.StreamFile != nil {
 		buf := make([]byte, bagInfo.StreamFile.Size)
-		_, err := bagInfo.StreamFile.FileStream.Read(buf)
+		_, err := io.ReadFull(bagInfo.StreamFile.FileStream, buf)
 		bagInfo.StreamFile.FileStream.Close()
 		if err != nil {
 			return errorHandler(c, err)
@@ -138,8 +130,9 @@ func serveHTMLFile(c *fiber.Ctx, bagInfo private.FolderInfo) error {
 	}
 
 	iframeHTML, err := iframewrap.WrapHTML(htmlContent, iframewrap.Options{
-		AllowScripts: true,
-		AllowForms:   true,
+		AllowScripts:    true,
+		AllowForms:      true,
+		AllowSameOrigin: isBagOrigin(c),
 	})
 	if err != nil {
 		log.Error("failed to create iframe wrapper", slog.String("error", err.Error()))
@@ -150,37 +143,341 @@ func serveHTMLFile(c *fiber.Ctx, bagInfo private.FolderInfo) error {
 	return c.SendString(iframeHTML)
 }
 
-func streamWithDeadline(c *fiber.Ctx, r io.Reader, size int) error {
-	deadline := time.Now().Add(time.Second * constants.FileDownloadTimeoutSeconds)
+// sniffLocalFile detects the type of a local file with unknown extension from its leading bytes.
+func (h *handler) sniffLocalFile(path string, fallback htmlTemplates.ContentType) htmlTemplates.ContentType {
+	f, err := os.Open(path)
+	if err != nil {
+		return fallback
+	}
+	defer f.Close()
+
+	head := make([]byte, htmlTemplates.SniffLength)
+	n, _ := io.ReadFull(f, head)
+
+	return h.templates.SniffContentType(head[:n])
+}
+
+// sniffStream wraps open of a remote file with unknown extension, so its type is detected
+// from the leading bytes of the stream that is served instead of a separate one.
+// The first stream is opened before the headers are sent, they are updated then.
+// Streams that don't cover the beginning of the file keep the fallback type.
+func (h *handler) sniffStream(c *fiber.Ctx, size uint64, name string, open func(rng *private.ByteRange) (io.ReadCloser, error)) func(rng *private.ByteRange) (io.ReadCloser, error) {
+	first := true
+
+	return func(rng *private.ByteRange) (io.ReadCloser, error) {
+		r, err := open(rng)
+		if err != nil || !first {
+			return r, err
+		}
+		first = false
+
+		length := min(size, htmlTemplates.SniffLength)
+		if rng != nil && (rng.Start > 0 || rng.End+1 < length) {
+			return r, nil
+		}
+
+		head := make([]byte, length)
+		n, _ := io.ReadFull(r, head)
+		head = head[:n]
+
+		setFileTypeHeaders(c, withDispositionQuery(c, h.templates.SniffContentType(head)), name)
+
+		return readCloser{
+			Reader: io.MultiReader(bytes.NewReader(head), r),
+			Closer: r,
+		}, nil
+	}
+}
+
+// withDispositionQuery applies the download and inline query parameters to ct.
+func withDispositionQuery(c *fiber.Ctx, ct htmlTemplates.ContentType) htmlTemplates.ContentType {
+	switch {
+	case c.QueryBool("download"):
+		ct.IsDownload = true
+		ct.IsHtml = false
+	case c.QueryBool("inline") && !ct.ForceDownload:
+		ct.IsDownload = false
+	}
+
+	return ct
+}
+
+// setFileTypeHeaders sets the type and disposition of a file response.
+func setFileTypeHeaders(c *fiber.Ctx, ct htmlTemplates.ContentType, name string) {
+	disposition := "inline"
+	if ct.IsDownload {
+		disposition = "attachment"
+	}
+
+	c.Response().Header.SetContentType(ct.MimeType)
+	c.Set(fiber.HeaderContentDisposition, contentDisposition(disposition, name))
+}
+
+// servedFileName returns the name of the file resolved by GetPathInfo. The path may be
+// the bag root for single file bags, so the name is taken from the file entry.
+func servedFileName(bagInfo private.FolderInfo, path string) string {
+	if len(bagInfo.Files) == 1 && !bagInfo.Files[0].IsFolder {
+		return bagInfo.Files[0].Name
+	}
+
+	return filepath.Base(path)
+}
+
+// contentDisposition builds the header value with an ASCII fallback filename
+// and the RFC 5987 encoded UTF-8 filename.
+func contentDisposition(disposition, filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	return fmt.Sprintf(`%s; filename="%s"; filename*=%s`, disposition, fallback, extValue(filename))
+}
+
+// extValue encodes s as RFC 5987 ext-value, so any text fits into a header.
+func extValue(s string) string {
+	var encoded strings.Builder
+	encoded.WriteString("UTF-8''")
+	for _, b := range []byte(s) {
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	return encoded.String()
+}
+
+// isAttrChar reports whether b is allowed unencoded in RFC 5987 ext-value.
+func isAttrChar(b byte) bool {
+	if (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') {
+		return true
+	}
+
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
+
+// serveContent sends the whole file or the byte ranges requested by the client.
+// open must return a reader positioned at rng.Start, or at the file start if rng is nil.
+func serveContent(c *fiber.Ctx, size uint64, lastModified time.Time, limits streamLimits, open func(rng *private.ByteRange) (io.ReadCloser, error)) error {
+	setContentHeaders(c, lastModified)
+
+	var ranges []httpRange
+	if ifRangeMatches(c, string(c.Response().Header.Peek(fiber.HeaderETag)), lastModified) {
+		var err error
+		ranges, err = parseRange(c.Get(fiber.HeaderRange), size)
+		if errors.Is(err, errRangeNotSatisfiable) {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			return errorHandler(c, fiber.NewError(fiber.StatusRequestedRangeNotSatisfiable, "range not satisfiable"))
+		}
+	}
+
+	if len(ranges) == 0 {
+		r, err := open(nil)
+		if err != nil {
+			return errorHandler(c, err)
+		}
+
+		return streamWithDeadline(c, r, int(size), limits)
+	}
+
+	// Every range is opened separately, so the gaps between them are never fetched.
+	// The first one is opened here to answer with an error instead of a broken body.
+	r, err := open(&private.ByteRange{
+		Start: ranges[0].start,
+		End:   ranges[0].end,
+	})
+	if err != nil {
+		return errorHandler(c, err)
+	}
+
+	c.Status(fiber.StatusPartialContent)
+
+	if len(ranges) == 1 {
+		c.Set(fiber.HeaderContentRange, ranges[0].contentRange(size))
+		body, n := rangeBody(r, open, ranges, size, "", "")
+		return streamWithDeadline(c, body, int(n), limits)
+	}
 
+	boundary := multipartBoundary()
+	body, n := rangeBody(r, open, ranges, size, string(c.Response().Header.ContentType()), boundary)
+	c.Response().Header.SetContentType("multipart/byteranges; boundary=" + boundary)
+
+	return streamWithDeadline(c, body, int(n), limits)
+}
+
+// headContent answers HEAD requests from file metadata only, the file is never opened.
+func headContent(c *fiber.Ctx, size uint64, lastModified time.Time) error {
+	setContentHeaders(c, lastModified)
+	c.Response().Header.SetContentLength(int(size))
+
+	return nil
+}
+
+func setContentHeaders(c *fiber.Ctx, lastModified time.Time) {
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	if !lastModified.IsZero() {
+		c.Set(fiber.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// fileETag returns a strong entity tag for a single file of a bag.
+// Bag ID is a hash of the bag info including its merkle root, so
+// together with file index and size it identifies the content.
+func fileETag(bagInfo private.FolderInfo) string {
+	var index uint32
+	var size uint64
+	if len(bagInfo.Files) > 0 {
+		index = bagInfo.Files[0].Index
+		size = bagInfo.Files[0].Size
+	}
+
+	return fmt.Sprintf(`"%s-%d-%d"`, strings.ToLower(bagInfo.BagID), index, size)
+}
+
+// listingETag returns a weak entity tag for a directory listing.
+// Files never change, but the page also shows peers count, so it is not byte-identical.
+func listingETag(bagID, path, format, options string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(path))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(format))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(options))
+
+	return fmt.Sprintf(`W/"%s-%x"`, strings.ToLower(bagID), h.Sum64())
+}
+
+// setCacheHeaders marks the response as immutable, bag content can't change.
+// Responses for TON DNS domains are cached only while the record is, the domain may point to another bag later.
+// Aliases can be repointed by admins at any time, so their responses are cached briefly.
+// Website fallback pages are revalidated on every request, they don't belong to the requested path.
+func setCacheHeaders(c *fiber.Ctx, etag string) {
+	c.Set(fiber.HeaderETag, etag)
+
+	if fallback, _ := c.Locals(websiteFallbackLocal).(bool); fallback {
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		return
+	}
+
+	if isAlias(c) {
+		c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", constants.AliasCacheMaxAgeSeconds))
+		return
+	}
+
+	if ttl, ok := domainTTL(c); ok {
+		c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+		return
+	}
+
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d, immutable", constants.ImmutableCacheMaxAgeSeconds))
+}
+
+// notModified reports whether If-None-Match matches etag, so 304 Not Modified can be sent.
+// Weak comparison is used as required for If-None-Match.
+func notModified(c *fiber.Ctx, etag string) bool {
+	ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch)
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyThrottled copies src to w until src ends, a write fails, the deadline passes or charge fails.
+// charge is called with the number of bytes written in batches of quotaChargeBytes, if set.
+func copyThrottled(w io.Writer, src *throttledReader, deadline time.Time, charge func(n int) error) {
+	var uncharged int
+	defer func() {
+		if charge != nil && uncharged > 0 {
+			_ = charge(uncharged)
+		}
+	}()
+
+	buf := make([]byte, 64*1024)
+	for {
+		if src.expired(deadline) {
+			return
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+
+			if charge != nil {
+				uncharged += n
+				if uncharged >= quotaChargeBytes {
+					cerr := charge(uncharged)
+					uncharged = 0
+					if cerr != nil {
+						return
+					}
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// streamWithDeadline streams size bytes of r, or the whole r with chunked encoding if size is -1.
+// The stream is throttled and cut off at the deadline according to limits,
+// time spent waiting for the global bandwidth doesn't count towards the deadline.
+// Compressible content is compressed on the fly if the client accepts it.
+func streamWithDeadline(c *fiber.Ctx, r io.Reader, size int, limits streamLimits) error {
+	deadline := limits.deadline(limits.size)
 	if size >= 0 {
+		deadline = limits.deadline(uint64(size))
+	}
+
+	encoding := responseEncoding(c, size)
+	if encoding != "" {
+		setEncodingHeaders(c, encoding)
+	} else if size >= 0 {
 		c.Response().Header.Set("Content-Length", fmt.Sprintf("%d", size))
 	}
 
-	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+	src := limits.reader(r)
+
+	c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+		var w io.Writer = bw
+		var enc io.WriteCloser
+		if encoding != "" {
+			var err error
+			if enc, err = newEncoder(bw, encoding); err == nil {
+				w = enc
+			}
+		}
+
 		defer func() {
-			_ = w.Flush()
+			if enc != nil {
+				_ = enc.Close()
+			}
+
+			_ = bw.Flush()
 
 			if rc, ok := r.(io.ReadCloser); ok {
 				_ = rc.Close()
 			}
 		}()
 
-		buf := make([]byte, 64*1024)
-		for {
-			if time.Now().After(deadline) {
-				return
-			}
-			n, err := r.Read(buf)
-			if n > 0 {
-				if _, werr := w.Write(buf[:n]); werr != nil {
-					return
-				}
-			}
-			if err != nil {
-				return
-			}
-		}
+		copyThrottled(w, src, deadline, limits.charge)
 	})
 	return nil
 }
@@ -0,0 +1,97 @@
+package httpServer
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	tondns "mytonstorage-gateway/pkg/clients/ton-dns"
+	htmlTemplates "mytonstorage-gateway/pkg/templates"
+	"mytonstorage-gateway/pkg/utils"
+)
+
+// bagOriginLocal is set when the request came to a bag's own origin: <bagid>.<bags domain>
+const bagOriginLocal = "bag_origin"
+
+// Bag IDs are 64 hex characters, which exceeds the 63 characters DNS label limit,
+// so the 52 characters unpadded base32 form is accepted as well.
+var bagIDBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// bagHostMiddleware maps requests to <bagid>.<bags domain>/<path> onto the gateway route of the bag.
+// With TON DNS enabled, <name>.ton and <name>.ton.<bags domain> hosts are mapped onto the route of the domain.
+// Paths already pointing to the gateway route of the same bag (e.g. listing links) are kept as is.
+func (h *handler) bagHostMiddleware(c *fiber.Ctx) error {
+	if h.bagsDomain == "" && h.dns == nil {
+		return c.Next()
+	}
+
+	bagID, ok := h.bagFromHost(c.Hostname())
+	if !ok {
+		return c.Next()
+	}
+
+	c.Locals(bagOriginLocal, true)
+
+	bagRoot := htmlTemplates.APIBase + "/" + bagID
+	path := c.Path()
+	if lower := strings.ToLower(path); lower == bagRoot || strings.HasPrefix(lower, bagRoot+"/") {
+		return c.Next()
+	}
+
+	if path == "/" {
+		path = ""
+	}
+	c.Path(bagRoot + path)
+
+	return c.Next()
+}
+
+// isBagOrigin reports whether the request is served from the bag's own origin.
+func isBagOrigin(c *fiber.Ctx) bool {
+	v, _ := c.Locals(bagOriginLocal).(bool)
+	return v
+}
+
+// bagFromHost extracts the lowercase hex bag ID or TON DNS domain from the request host.
+func (h *handler) bagFromHost(host string) (string, bool) {
+	if hp, _, err := net.SplitHostPort(host); err == nil {
+		host = hp
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if h.dns != nil && tondns.IsDomain(host) {
+		return host, true
+	}
+
+	if h.bagsDomain == "" {
+		return "", false
+	}
+
+	label, ok := strings.CutSuffix(host, "."+h.bagsDomain)
+	if !ok || label == "" {
+		return "", false
+	}
+
+	if h.dns != nil && tondns.IsDomain(label) {
+		return label, true
+	}
+
+	return bagIDFromLabel(label)
+}
+
+// bagIDFromLabel decodes a DNS label holding the bag ID either in hex or base32.
+func bagIDFromLabel(label string) (string, bool) {
+	if utils.ValidateBagID(label) {
+		return label, true
+	}
+
+	raw, err := bagIDBase32.DecodeString(strings.ToUpper(label))
+	if err != nil || len(raw) != 32 {
+		return "", false
+	}
+
+	return hex.EncodeToString(raw), true
+}
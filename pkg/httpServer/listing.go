@@ -0,0 +1,215 @@
+package httpServer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"mytonstorage-gateway/pkg/constants"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+	"mytonstorage-gateway/pkg/models/private"
+	"mytonstorage-gateway/pkg/utils"
+)
+
+const (
+	listingHTML   = "html"
+	listingJSON   = "json"
+	listingNDJSON = "ndjson"
+	listingText   = "text"
+
+	mimeNDJSON = "application/x-ndjson"
+
+	sortName  = "name"
+	sortSize  = "size"
+	orderAsc  = "asc"
+	orderDesc = "desc"
+
+	headerTotalCount = "X-Total-Count"
+)
+
+// listingOptions select and order the entries of a directory listing.
+type listingOptions struct {
+	sort  string
+	order string
+	// query is a case insensitive substring of the entry names
+	query string
+	page  int
+	// perPage is zero if all entries are listed on one page
+	perPage int
+}
+
+// parseListingOptions reads ?sort=name|size, ?order=asc|desc, ?q, ?page and ?per_page.
+// HTML listings are always paginated, other formats only if a page is requested.
+func parseListingOptions(c *fiber.Ctx, format string) (listingOptions, error) {
+	opts := listingOptions{
+		sort:  strings.ToLower(c.Query("sort", sortName)),
+		order: strings.ToLower(c.Query("order", orderAsc)),
+		query: strings.TrimSpace(c.Query("q")),
+		page:  c.QueryInt("page", 1),
+	}
+
+	if opts.sort != sortName && opts.sort != sortSize {
+		return opts, fiber.NewError(fiber.StatusBadRequest, "invalid sort, expected name or size")
+	}
+
+	if opts.order != orderAsc && opts.order != orderDesc {
+		return opts, fiber.NewError(fiber.StatusBadRequest, "invalid order, expected asc or desc")
+	}
+
+	opts.page = max(opts.page, 1)
+
+	perPage := 0
+	if format == listingHTML || c.Query("page") != "" {
+		perPage = constants.ListingPageSize
+	}
+	if v := c.QueryInt("per_page"); v > 0 {
+		perPage = v
+	}
+	opts.perPage = min(perPage, constants.MaxListingPageSize)
+
+	return opts, nil
+}
+
+// key identifies the selected entries for the entity tag.
+func (o listingOptions) key() string {
+	return fmt.Sprintf("%s:%s:%d:%d:%s", o.sort, o.order, o.page, o.perPage, o.query)
+}
+
+// apply filters, sorts and paginates the entries, folders are always listed first.
+// The number of entries matching the filter on all pages is returned as well.
+func (o listingOptions) apply(files []v1.File) ([]v1.File, int) {
+	query := strings.ToLower(o.query)
+
+	result := make([]v1.File, 0, len(files))
+	for _, f := range files {
+		if query == "" || strings.Contains(strings.ToLower(f.Name), query) {
+			result = append(result, f)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.IsFolder != b.IsFolder {
+			return a.IsFolder
+		}
+
+		if o.order == orderDesc {
+			a, b = b, a
+		}
+
+		if o.sort == sortSize && a.Size != b.Size {
+			return a.Size < b.Size
+		}
+
+		return a.Name < b.Name
+	})
+
+	total := len(result)
+	if o.perPage == 0 {
+		return result, total
+	}
+
+	// Pages past the end are empty, page is not bounded, so the offset must not be computed for them
+	start := total
+	if o.page-1 < (total+o.perPage-1)/o.perPage {
+		start = (o.page - 1) * o.perPage
+	}
+	end := min(start+o.perPage, total)
+
+	return result[start:end], total
+}
+
+// listingFormat picks the directory listing format from the format query parameter,
+// falling back to the Accept header. Browsers get HTML.
+func listingFormat(c *fiber.Ctx) string {
+	switch strings.ToLower(c.Query("format")) {
+	case listingJSON:
+		return listingJSON
+	case listingNDJSON:
+		return listingNDJSON
+	case listingText, "txt":
+		return listingText
+	case listingHTML:
+		return listingHTML
+	}
+
+	switch c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON, mimeNDJSON, fiber.MIMETextPlain) {
+	case fiber.MIMEApplicationJSON:
+		return listingJSON
+	case mimeNDJSON:
+		return listingNDJSON
+	case fiber.MIMETextPlain:
+		return listingText
+	}
+
+	return listingHTML
+}
+
+func pathInfoResponse(bagInfo private.FolderInfo, path string, opts listingOptions, total int) v1.PathInfo {
+	info := v1.PathInfo{
+		BagID:        strings.ToLower(bagInfo.BagID),
+		CommonPath:   path,
+		Description:  bagInfo.Description,
+		TotalSize:    bagInfo.TotalSize,
+		FilesCount:   bagInfo.FilesCount,
+		PeersCount:   bagInfo.PeersCount,
+		Files:        make([]v1.File, 0, len(bagInfo.Files)),
+		EntriesCount: total,
+	}
+
+	if opts.perPage > 0 {
+		info.Page = opts.page
+		info.PerPage = opts.perPage
+	}
+
+	for _, f := range bagInfo.Files {
+		f.Path = filepath.ToSlash(filepath.Join(path, f.Name))
+		info.Files = append(info.Files, f)
+	}
+
+	return info
+}
+
+// serveNDJSONListing streams one JSON object per directory entry, so huge directories
+// can be consumed line by line.
+func serveNDJSONListing(c *fiber.Ctx, info v1.PathInfo) error {
+	c.Set(fiber.HeaderContentType, mimeNDJSON)
+
+	streamEncoded(c, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, f := range info.Files {
+			if err := enc.Encode(f); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return nil
+}
+
+func textListing(info v1.PathInfo) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# tonstorage://%s/%s\n", info.BagID, strings.TrimPrefix(info.CommonPath, "."))
+	if info.Description != "" {
+		fmt.Fprintf(&sb, "# %s\n", strings.ReplaceAll(info.Description, "\n", " "))
+	}
+	fmt.Fprintf(&sb, "# total size: %s, files: %d, peers: %d\n", utils.FormatSize(info.TotalSize), info.FilesCount, info.PeersCount)
+
+	for _, f := range info.Files {
+		if f.IsFolder {
+			fmt.Fprintf(&sb, "%12s  %s/\n", "<dir>", f.Path)
+		} else {
+			fmt.Fprintf(&sb, "%12d  %s\n", f.Size, f.Path)
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,160 @@
+package httpServer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+	"mytonstorage-gateway/pkg/models/private"
+	"mytonstorage-gateway/pkg/utils"
+)
+
+const (
+	manifestJSON   = "json"
+	manifestCSV    = "csv"
+	manifestNDJSON = "ndjson"
+
+	mimeCSV = "text/csv"
+)
+
+var manifestCSVHeader = []string{"index", "path", "size", "from_piece", "to_piece", "from_piece_offset", "to_piece_offset"}
+
+// manifestFormat picks the manifest format from the format query parameter,
+// falling back to the Accept header. JSON is the default.
+func manifestFormat(c *fiber.Ctx) (string, error) {
+	switch format := strings.ToLower(c.Query("format")); format {
+	case manifestJSON, manifestCSV, manifestNDJSON:
+		return format, nil
+	case "":
+	default:
+		return "", fiber.NewError(fiber.StatusBadRequest, "unsupported manifest format, expected json, csv or ndjson")
+	}
+
+	switch c.Accepts(fiber.MIMEApplicationJSON, mimeCSV, mimeNDJSON) {
+	case mimeCSV:
+		return manifestCSV, nil
+	case mimeNDJSON:
+		return manifestNDJSON, nil
+	}
+
+	return manifestJSON, nil
+}
+
+func (h *handler) getManifest(c *fiber.Ctx) (err error) {
+	bagid := strings.ToLower(c.Params("bagid"))
+	log := h.logger.With(
+		slog.String("func", "getManifest"),
+		slog.String("bagid", bagid),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	bagid, err = h.resolveBagID(c, bagid, log)
+	if err != nil {
+		return errorHandler(c, err)
+	}
+
+	if !utils.ValidateBagID(bagid) {
+		log.Error("invalid bagid format")
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid bagid"))
+	}
+
+	format, err := manifestFormat(c)
+	if err != nil {
+		return errorHandler(c, err)
+	}
+	c.Vary(fiber.HeaderAccept)
+
+	etag := listingETag(bagid, "", "manifest:"+format, "")
+	setCacheHeaders(c, etag)
+	if notModified(c, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	manifest, err := h.files.Manifest(c.Context(), bagid)
+	if err != nil {
+		return errorHandler(c, mapPathInfoError(err, private.FolderInfo{}, log))
+	}
+
+	switch format {
+	case manifestCSV:
+		return serveCSVManifest(c, manifest)
+	case manifestNDJSON:
+		return serveNDJSONManifest(c, manifest)
+	}
+
+	return c.JSON(manifest)
+}
+
+// serveNDJSONManifest streams the bag info without files on the first line, then one file per line.
+func serveNDJSONManifest(c *fiber.Ctx, manifest v1.Manifest) error {
+	c.Set(fiber.HeaderContentType, mimeNDJSON)
+
+	files := manifest.Files
+	manifest.Files = nil
+
+	streamEncoded(c, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(manifest); err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if err := enc.Encode(f); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return nil
+}
+
+// serveCSVManifest streams one row per file, the bag info is sent in the response headers.
+func serveCSVManifest(c *fiber.Ctx, manifest v1.Manifest) error {
+	c.Set(fiber.HeaderContentType, mimeCSV+"; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, contentDisposition("attachment", manifest.BagID+".csv"))
+	c.Set("X-Bag-Merkle-Hash", manifest.MerkleHash)
+	c.Set("X-Bag-Piece-Size", strconv.FormatUint(uint64(manifest.PieceSize), 10))
+	c.Set("X-Bag-Pieces-Count", strconv.FormatUint(uint64(manifest.PiecesCount), 10))
+	c.Set("X-Bag-Size", strconv.FormatUint(manifest.BagSize, 10))
+	c.Set("X-Bag-Total-Size", strconv.FormatUint(manifest.TotalSize, 10))
+	c.Set("X-Bag-Files-Count", strconv.Itoa(manifest.FilesCount))
+	// The description is free text, percent-encoded like filename* of Content-Disposition
+	c.Set("X-Bag-Description", extValue(manifest.Description))
+
+	streamEncoded(c, func(w io.Writer) error {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(manifestCSVHeader); err != nil {
+			return err
+		}
+
+		for _, f := range manifest.Files {
+			err := cw.Write([]string{
+				strconv.FormatUint(uint64(f.Index), 10),
+				f.Path,
+				strconv.FormatUint(f.Size, 10),
+				strconv.FormatUint(uint64(f.FromPiece), 10),
+				strconv.FormatUint(uint64(f.ToPiece), 10),
+				strconv.FormatUint(uint64(f.FromPieceOffset), 10),
+				strconv.FormatUint(uint64(f.ToPieceOffset), 10),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		cw.Flush()
+		return cw.Error()
+	})
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package httpServer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"mytonstorage-gateway/pkg/constants"
+	"mytonstorage-gateway/pkg/models"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+	"mytonstorage-gateway/pkg/models/private"
+	htmlTemplates "mytonstorage-gateway/pkg/templates"
+)
+
+// readmeFiles are shown under directory listings, looked up in the order listed
+var readmeFiles = []string{"readme.md", "readme.txt"}
+
+// readmeFile returns the name of the directory README if the directory has one.
+func readmeFile(files []v1.File) (string, bool) {
+	for _, name := range readmeFiles {
+		for _, f := range files {
+			if !f.IsFolder && strings.EqualFold(f.Name, name) {
+				return f.Name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// bagFileSize returns the size of a file resolved by GetPathInfo.
+func bagFileSize(bagInfo private.FolderInfo) (uint64, bool) {
+	if bagInfo.StreamFile != nil {
+		return bagInfo.StreamFile.Size, true
+	}
+
+	if bagInfo.SingleFilePath != "" {
+		if f, err := os.Stat(bagInfo.SingleFilePath); err == nil {
+			return uint64(f.Size()), true
+		}
+	}
+
+	return 0, false
+}
+
+// readBagFile reads a whole file resolved by GetPathInfo from local or remote storage.
+func (h *handler) readBagFile(ctx context.Context, bagInfo private.FolderInfo, path string) ([]byte, error) {
+	if bagInfo.SingleFilePath != "" {
+		return os.ReadFile(bagInfo.SingleFilePath)
+	}
+
+	if bagInfo.StreamFile == nil {
+		return nil, models.NewAppError(models.NotFoundErrorCode, "file not found")
+	}
+
+	if bagInfo.StreamFile.Size == 0 {
+		return nil, nil
+	}
+
+	stream, err := h.files.StreamFile(ctx, bagInfo.BagID, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.FileStream.Close()
+
+	buf := make([]byte, bagInfo.StreamFile.Size)
+	if _, err := io.ReadFull(stream.FileStream, buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// serveMarkdownFile renders the markdown file to a sanitized HTML page.
+func (h *handler) serveMarkdownFile(c *fiber.Ctx, bagInfo private.FolderInfo, path string, log *slog.Logger) error {
+	c.Type("html", "utf-8")
+	c.Set(fiber.HeaderContentDisposition, contentDisposition("inline", filepath.Base(path)))
+
+	if c.Method() == fiber.MethodHead {
+		// Rendered page length is unknown without reading the file
+		return nil
+	}
+
+	var limits streamLimits
+	if err := h.checkQuota(c, bagInfo.BagID, &limits); err != nil {
+		return errorHandler(c, err)
+	}
+
+	content, err := h.readBagFile(c.Context(), bagInfo, path)
+	if err != nil {
+		return errorHandler(c, mapPathInfoError(err, bagInfo, log))
+	}
+
+	if limits.charge != nil {
+		_ = limits.charge(len(content))
+	}
+
+	if _, ok := domainTTL(c); ok {
+		// Links must stay on the domain
+		bagInfo.BagID = strings.ToLower(c.Params("bagid"))
+	}
+
+	page, err := h.templates.MarkdownWithTemplate(bagInfo, path, content)
+	if err != nil {
+		log.Error("failed to render markdown template", slog.String("error", err.Error()))
+		return errorHandler(c, fiber.NewError(fiber.StatusInternalServerError, ""))
+	}
+
+	return c.SendString(page)
+}
+
+// readme fetches the README of the listed directory the same way as any other file.
+// Errors are only logged, the listing is shown without the README then.
+func (h *handler) readme(c *fiber.Ctx, bagid, path string, files []v1.File, log *slog.Logger) *htmlTemplates.Readme {
+	name, ok := readmeFile(files)
+	if !ok {
+		return nil
+	}
+
+	filePath := filepath.Join(path, name)
+	info, err := h.websitePage(c.Context(), bagid, filePath)
+	if err != nil {
+		log.Warn("failed to get README", slog.String("path", filePath), slog.String("error", err.Error()))
+		return nil
+	}
+
+	if size, ok := bagFileSize(info); !ok || size > constants.MaxMarkdownFileSize {
+		return nil
+	}
+
+	content, err := h.readBagFile(c.Context(), info, filePath)
+	if err != nil {
+		log.Warn("failed to read README", slog.String("path", filePath), slog.String("error", err.Error()))
+		return nil
+	}
+
+	return &htmlTemplates.Readme{
+		Name:    name,
+		Content: content,
+	}
+}
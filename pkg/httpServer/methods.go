@@ -3,11 +3,14 @@ package httpServer
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/adaptor/v2"
 	"github.com/gofiber/fiber/v2"
@@ -17,6 +20,7 @@ import (
 	v1 "mytonstorage-gateway/pkg/models/api/v1"
 	"mytonstorage-gateway/pkg/models/private"
 	htmlTemplates "mytonstorage-gateway/pkg/templates"
+	"mytonstorage-gateway/pkg/utils"
 )
 
 func (h *handler) limitReached(c *fiber.Ctx) error {
@@ -24,6 +28,7 @@ func (h *handler) limitReached(c *fiber.Ctx) error {
 		slog.String("method", "limitReached"),
 		slog.String("method", c.Method()),
 		slog.String("url", c.OriginalURL()),
+		slog.String("ip", clientIP(c)),
 		slog.Any("headers", c.GetReqHeaders()),
 	)
 
@@ -152,7 +157,7 @@ func (h *handler) getReportsByBagID(c *fiber.Ctx) (err error) {
 		slog.Any("headers", c.GetReqHeaders()),
 	)
 
-	if !validateBagID(bagID) {
+	if !utils.ValidateBagID(bagID) {
 		log.Error("invalid bagid format")
 		err = fiber.NewError(fiber.StatusBadRequest, "invalid bagid")
 		return errorHandler(c, err)
@@ -179,7 +184,7 @@ func (h *handler) getBan(c *fiber.Ctx) (err error) {
 		slog.Any("headers", c.GetReqHeaders()),
 	)
 
-	if !validateBagID(bagID) {
+	if !utils.ValidateBagID(bagID) {
 		log.Error("invalid bagid format")
 		err = fiber.NewError(fiber.StatusBadRequest, "invalid bagid")
 		return errorHandler(c, err)
@@ -202,6 +207,7 @@ func (h *handler) addReport(c *fiber.Ctx) (err error) {
 		slog.String("func", "addReport"),
 		slog.String("method", c.Method()),
 		slog.String("url", c.OriginalURL()),
+		slog.String("ip", clientIP(c)),
 		slog.Any("headers", c.GetReqHeaders()),
 		slog.Int("body_length", len(body)),
 		slog.String("content_type", c.Get("Content-Type")),
@@ -219,8 +225,9 @@ func (h *handler) addReport(c *fiber.Ctx) (err error) {
 	}
 
 	report.BagID = strings.ToLower(report.BagID)
+	report.SenderIP = clientIP(c)
 
-	if !validateBagID(report.BagID) {
+	if !utils.ValidateBagID(report.BagID) {
 		log.Error("invalid bagid format")
 		err = fiber.NewError(fiber.StatusBadRequest, "invalid bagid")
 		return errorHandler(c, err)
@@ -235,7 +242,13 @@ func (h *handler) addReport(c *fiber.Ctx) (err error) {
 }
 
 func (h *handler) getBagInfoResponse(c *fiber.Ctx, bagid, path string, log *slog.Logger) (err error) {
-	if !validateBagID(bagid) {
+	domain := bagid
+	bagid, err = h.resolveBagID(c, bagid, log)
+	if err != nil {
+		return errorHandler(c, err)
+	}
+
+	if !utils.ValidateBagID(bagid) {
 		log.Error("invalid bagid format")
 		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid bagid"))
 	}
@@ -246,31 +259,90 @@ func (h *handler) getBagInfoResponse(c *fiber.Ctx, bagid, path string, log *slog
 		return errorHandler(c, err)
 	}
 
+	website, isWebsite := h.website(c, bagid)
+
 	bagInfo, err := h.files.GetPathInfo(c.Context(), bagid, path)
 	if err != nil {
+		if isWebsite {
+			err = h.serveWebsiteFallback(c, bagid, bagInfo, website, err, log)
+			if err == nil {
+				return nil
+			}
+		}
+
 		mapped := mapPathInfoError(err, bagInfo, log)
 		return errorHandler(c, mapped)
 	}
 
 	// File response branch
 	if bagInfo.StreamFile != nil || bagInfo.SingleFilePath != "" {
-		if bagInfo.SingleFilePath != "" {
-			sanitized, sErr := sanitizePath(bagInfo.SingleFilePath)
-			if sErr != nil {
-				log.Error("invalid single file path", slog.String("path", bagInfo.SingleFilePath))
-				return errorHandler(c, sErr)
-			}
+		return h.serveBagFile(c, bagInfo, path, log)
+	}
 
-			bagInfo.SingleFilePath = sanitized
-			_, file := filepath.Split(bagInfo.SingleFilePath)
-			return h.serveFile(c, bagInfo, h.templates.ContentType(file))
-		}
+	if format := c.Query("archive"); format != "" {
+		return h.serveArchive(c, bagid, path, format, log)
+	}
 
-		return h.serveFile(c, bagInfo, h.templates.ContentType(path))
+	if query := c.Query("search"); query != "" {
+		return h.serveSearch(c, bagid, domain, path, query, log)
 	}
 
 	// Directory listing
-	html, rerr := h.templates.HtmlFilesListWithTemplate(bagInfo, path)
+	format := listingFormat(c)
+	c.Vary(fiber.HeaderAccept)
+
+	if isWebsite && format == listingHTML {
+		if index, ok := indexFile(bagInfo.Files); ok {
+			return h.serveWebsiteIndex(c, bagid, path, index, log)
+		}
+	}
+
+	opts, err := parseListingOptions(c, format)
+	if err != nil {
+		return errorHandler(c, err)
+	}
+
+	etag := listingETag(bagid, path, format, opts.key())
+	setCacheHeaders(c, etag)
+	if notModified(c, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	// README is looked up among all entries, not only the ones on the page
+	allFiles := bagInfo.Files
+
+	var total int
+	bagInfo.Files, total = opts.apply(bagInfo.Files)
+	c.Set(headerTotalCount, strconv.Itoa(total))
+
+	switch format {
+	case listingJSON:
+		return c.JSON(pathInfoResponse(bagInfo, path, opts, total))
+	case listingNDJSON:
+		return serveNDJSONListing(c, pathInfoResponse(bagInfo, path, opts, total))
+	case listingText:
+		return c.Type("txt", "utf-8").SendString(textListing(pathInfoResponse(bagInfo, path, opts, total)))
+	}
+
+	// README of remote bags is streamed, HEAD must never open file streams
+	var readme *htmlTemplates.Readme
+	if c.Method() != fiber.MethodHead {
+		readme = h.readme(c, bagid, path, allFiles, log)
+	}
+
+	if _, ok := domainTTL(c); ok {
+		// Links must stay on the domain
+		bagInfo.BagID = domain
+	}
+
+	html, rerr := h.templates.HtmlFilesListWithTemplate(bagInfo, path, readme, htmlTemplates.Listing{
+		Sort:    opts.sort,
+		Order:   opts.order,
+		Query:   opts.query,
+		Page:    opts.page,
+		PerPage: opts.perPage,
+		Total:   total,
+	})
 	if rerr != nil {
 		log.Error("failed to render directory template", slog.String("error", rerr.Error()))
 		return errorHandler(c, fiber.NewError(fiber.StatusInternalServerError, ""))
@@ -279,7 +351,41 @@ func (h *handler) getBagInfoResponse(c *fiber.Ctx, bagid, path string, log *slog
 	return c.Type("html").SendString(html)
 }
 
-func (h *handler) serveFile(c *fiber.Ctx, bagInfo private.FolderInfo, ct htmlTemplates.ContentType) error {
+// serveBagFile serves a single file resolved by GetPathInfo.
+func (h *handler) serveBagFile(c *fiber.Ctx, bagInfo private.FolderInfo, path string, log *slog.Logger) error {
+	if bagInfo.SingleFilePath != "" {
+		sanitized, sErr := sanitizePath(bagInfo.SingleFilePath)
+		if sErr != nil {
+			log.Error("invalid single file path", slog.String("path", bagInfo.SingleFilePath))
+			return errorHandler(c, sErr)
+		}
+
+		bagInfo.SingleFilePath = sanitized
+		_, file := filepath.Split(bagInfo.SingleFilePath)
+		return h.serveFile(c, bagInfo, path, h.templates.ContentType(file), log)
+	}
+
+	return h.serveFile(c, bagInfo, path, h.templates.ContentType(servedFileName(bagInfo, path)), log)
+}
+
+func (h *handler) serveFile(c *fiber.Ctx, bagInfo private.FolderInfo, path string, ct htmlTemplates.ContentType, log *slog.Logger) error {
+	if c.Query("thumb") != "" {
+		return h.serveThumbnail(c, bagInfo, path, ct, log)
+	}
+
+	etag := fileETag(bagInfo)
+	setCacheHeaders(c, etag)
+	if notModified(c, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	isHead := c.Method() == fiber.MethodHead
+
+	// Remote files are sniffed from the stream that is served, see sniffStream
+	if ct.NeedsSniffing && bagInfo.SingleFilePath != "" {
+		ct = h.sniffLocalFile(bagInfo.SingleFilePath, ct)
+	}
+
 	// Force download for large HTML files
 	if ct.IsHtml && bagInfo.SingleFilePath != "" {
 		f, sErr := os.Lstat(bagInfo.SingleFilePath)
@@ -288,40 +394,128 @@ func (h *handler) serveFile(c *fiber.Ctx, bagInfo private.FolderInfo, ct htmlTem
 		}
 
 		if f.Size() >= constants.MaxHTMLFileSize {
-			ct.Header = "Content-Disposition"
-			ct.Value = `attachment; filename="` + bagInfo.SingleFilePath + `"`
 			ct.IsDownload = true
+			ct.ForceDownload = true
 			ct.IsHtml = false
 		}
+	} else if ct.IsHtml && bagInfo.StreamFile != nil && bagInfo.StreamFile.Size >= constants.MaxHTMLFileSize {
+		// HTML pages are read into memory to be wrapped
+		ct.IsDownload = true
+		ct.ForceDownload = true
+		ct.IsHtml = false
 	}
 
-	if ct.IsDownload {
-		c.Response().Header.Set(ct.Header, ct.Value)
-	} else {
-		c.Response().Header.SetContentType(ct.Value)
+	ct = withDispositionQuery(c, ct)
+
+	if c.Query("view") == "preview" && ct.Preview != "" && !ct.IsDownload {
+		return h.servePreview(c, bagInfo, path, ct, log)
 	}
 
+	if ct.IsMarkdown && !ct.IsDownload && !c.QueryBool("raw") {
+		if size, ok := bagFileSize(bagInfo); ok && size <= constants.MaxMarkdownFileSize {
+			return h.serveMarkdownFile(c, bagInfo, path, log)
+		}
+	}
+
+	name := servedFileName(bagInfo, path)
+	setFileTypeHeaders(c, ct, name)
+
 	if ct.IsHtml {
-		return serveHTMLFile(c, bagInfo)
+		if bagInfo.StreamFile != nil && isHead {
+			// Wrapped page length is unknown without reading the remote file
+			return nil
+		}
+
+		var limits streamLimits
+		if err := h.checkQuota(c, bagInfo.BagID, &limits); err != nil {
+			return errorHandler(c, err)
+		}
+
+		if bagInfo.StreamFile != nil {
+			stream, err := h.files.StreamFile(c.Context(), bagInfo.BagID, path, nil)
+			if err != nil {
+				return errorHandler(c, mapPathInfoError(err, bagInfo, log))
+			}
+			bagInfo.StreamFile = stream
+		}
+
+		if err := serveHTMLFile(c, bagInfo); err != nil {
+			return err
+		}
+
+		if limits.charge != nil && !isHead {
+			_ = limits.charge(len(c.Response().Body()))
+		}
+
+		return nil
 	}
 
 	if bagInfo.StreamFile != nil {
-		// Size check is done before on service layer
-		return streamWithDeadline(c, bagInfo.StreamFile.FileStream, int(bagInfo.StreamFile.Size))
+		limits, ok := h.streamLimits(bagInfo.StreamFile.Size)
+		if !ok {
+			log.Warn("file too large to serve", slog.Uint64("size", bagInfo.StreamFile.Size))
+			return errorHandler(c, fiber.NewError(fiber.StatusRequestEntityTooLarge, "file too large, use https://github.com/xssnick/TON-Torrent"))
+		}
+
+		if isHead {
+			return headContent(c, bagInfo.StreamFile.Size, time.Time{})
+		}
+
+		if err := h.checkQuota(c, bagInfo.BagID, &limits); err != nil {
+			return errorHandler(c, err)
+		}
+
+		// Ranges after the first one are opened while the body is sent, after the handler has returned
+		ctx := c.Context()
+		open := func(rng *private.ByteRange) (io.ReadCloser, error) {
+			stream, err := h.files.StreamFile(ctx, bagInfo.BagID, path, rng)
+			if err != nil {
+				return nil, mapPathInfoError(err, bagInfo, log)
+			}
+
+			return stream.FileStream, nil
+		}
+
+		if ct.NeedsSniffing {
+			open = h.sniffStream(c, bagInfo.StreamFile.Size, name, open)
+		}
+
+		return serveContent(c, bagInfo.StreamFile.Size, time.Time{}, limits, open)
 	} else if bagInfo.SingleFilePath != "" {
 		f, err := os.Stat(bagInfo.SingleFilePath)
 		if errors.Is(err, os.ErrNotExist) {
 			return errorHandler(c, fiber.NewError(fiber.StatusNotFound, "file not found"))
 		}
 
-		if int(f.Size()) > constants.MaxFileServeSize {
+		limits, ok := h.streamLimits(uint64(f.Size()))
+		if !ok {
+			log.Warn("file too large to serve", slog.Int64("size", f.Size()))
 			return errorHandler(c, fiber.NewError(fiber.StatusRequestEntityTooLarge, "file too large, use https://github.com/xssnick/TON-Torrent"))
 		}
-		file, err := os.Open(bagInfo.SingleFilePath)
-		if err != nil {
-			return errorHandler(c, fiber.NewError(fiber.StatusInternalServerError, ""))
+
+		if isHead {
+			return headContent(c, uint64(f.Size()), f.ModTime())
+		}
+
+		if err := h.checkQuota(c, bagInfo.BagID, &limits); err != nil {
+			return errorHandler(c, err)
 		}
-		return streamWithDeadline(c, file, int(f.Size()))
+
+		return serveContent(c, uint64(f.Size()), f.ModTime(), limits, func(rng *private.ByteRange) (io.ReadCloser, error) {
+			file, err := os.Open(bagInfo.SingleFilePath)
+			if err != nil {
+				return nil, fiber.NewError(fiber.StatusInternalServerError, "")
+			}
+
+			if rng != nil {
+				if _, err := file.Seek(int64(rng.Start), io.SeekStart); err != nil {
+					file.Close()
+					return nil, fiber.NewError(fiber.StatusInternalServerError, "")
+				}
+			}
+
+			return file, nil
+		})
 	}
 
 	return errorHandler(c, fiber.NewError(fiber.StatusNotFound, "file not found"))
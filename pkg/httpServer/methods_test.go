@@ -0,0 +1,197 @@
+package httpServer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"mytonstorage-gateway/pkg/models"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+	"mytonstorage-gateway/pkg/models/private"
+	htmlTemplates "mytonstorage-gateway/pkg/templates"
+)
+
+// fakeFiles serves one remote file and counts the streams opened, pages are the paths GetPathInfo resolves.
+type fakeFiles struct {
+	content []byte
+	pages   map[string]private.FolderInfo
+	streams int
+}
+
+func (f *fakeFiles) GetPathInfo(_ context.Context, _, path string) (private.FolderInfo, error) {
+	page, ok := f.pages[path]
+	if !ok {
+		return private.FolderInfo{}, models.NewAppError(models.NotFoundErrorCode, "")
+	}
+
+	return page, nil
+}
+
+func (f *fakeFiles) ListTree(context.Context, string, string) (private.FileTree, error) {
+	return private.FileTree{}, errors.New("not implemented")
+}
+
+func (f *fakeFiles) StreamFile(_ context.Context, _, _ string, rng *private.ByteRange) (*private.StreamFile, error) {
+	f.streams++
+
+	data := f.content
+	if rng != nil {
+		data = data[rng.Start : rng.End+1]
+	}
+
+	return &private.StreamFile{
+		FileStream: io.NopCloser(bytes.NewReader(data)),
+		Size:       uint64(len(data)),
+	}, nil
+}
+
+func (f *fakeFiles) Manifest(context.Context, string) (v1.Manifest, error) {
+	return v1.Manifest{}, errors.New("not implemented")
+}
+
+func (f *fakeFiles) FileProof(context.Context, string, string, *private.ByteRange) (v1.FileProof, error) {
+	return v1.FileProof{}, errors.New("not implemented")
+}
+
+func newTestHandler(t *testing.T, files files) *handler {
+	t.Helper()
+
+	templates, err := htmlTemplates.New("../../templates")
+	if err != nil {
+		t.Fatalf("templates: %v", err)
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+
+	return &handler{
+		files:      files,
+		templates:  templates,
+		sizeTiers:  parseSizeTiers(nil, logger),
+		ipResolver: newClientIPResolver(nil, ""),
+		logger:     logger,
+	}
+}
+
+// remoteFileInfo is what GetPathInfo returns for the only file of a remote bag.
+func remoteFileInfo(name string, size int) private.FolderInfo {
+	return private.FolderInfo{
+		BagID:      "bag",
+		Files:      []v1.File{{Name: name, Size: uint64(size)}},
+		FilesCount: 1,
+		StreamFile: &private.StreamFile{Size: uint64(size)},
+	}
+}
+
+func serveTestFile(t *testing.T, h *handler, info private.FolderInfo, path string, req *http.Request) (*http.Response, []byte) {
+	t.Helper()
+
+	app := fiber.New()
+	app.Get("/*", func(c *fiber.Ctx) error {
+		return h.serveBagFile(c, info, path, h.logger)
+	})
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+
+	return resp, body
+}
+
+func TestServeFileSingleFileBagRoot(t *testing.T) {
+	h := newTestHandler(t, &fakeFiles{content: []byte("movie")})
+
+	resp, _ := serveTestFile(t, h, remoteFileInfo("movie.mp4", 5), ".", httptest.NewRequest(fiber.MethodGet, "/?download=1", nil))
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	want := `attachment; filename="movie.mp4"; filename*=UTF-8''movie.mp4`
+	if got := resp.Header.Get(fiber.HeaderContentDisposition); got != want {
+		t.Fatalf("Content-Disposition = %q, want %q", got, want)
+	}
+
+	if got := resp.Header.Get(fiber.HeaderContentType); got != "video/mp4" {
+		t.Fatalf("Content-Type = %q, want video/mp4", got)
+	}
+}
+
+func TestServeFileSniffsServedStream(t *testing.T) {
+	files := &fakeFiles{content: []byte("%PDF-1.7 document")}
+	h := newTestHandler(t, files)
+
+	resp, body := serveTestFile(t, h, remoteFileInfo("doc.unknownext", len(files.content)), "doc.unknownext", httptest.NewRequest(fiber.MethodGet, "/", nil))
+
+	if got := resp.Header.Get(fiber.HeaderContentType); got != "application/pdf" {
+		t.Fatalf("Content-Type = %q, want application/pdf", got)
+	}
+
+	if string(body) != string(files.content) {
+		t.Fatalf("body = %q, want %q", body, files.content)
+	}
+
+	if files.streams != 1 {
+		t.Fatalf("opened %d streams, want 1", files.streams)
+	}
+}
+
+func TestServeFileSniffSkippedForLaterRange(t *testing.T) {
+	files := &fakeFiles{content: []byte("%PDF-1.7 document")}
+	h := newTestHandler(t, files)
+
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	req.Header.Set(fiber.HeaderRange, "bytes=9-")
+
+	resp, body := serveTestFile(t, h, remoteFileInfo("doc.unknownext", len(files.content)), "doc.unknownext", req)
+	if resp.StatusCode != fiber.StatusPartialContent || string(body) != "document" {
+		t.Fatalf("response = %d %q, want 206 document", resp.StatusCode, body)
+	}
+
+	if got := resp.Header.Get(fiber.HeaderContentType); got == "application/pdf" {
+		t.Fatalf("Content-Type = %q, want the fallback type", got)
+	}
+
+	if files.streams != 1 {
+		t.Fatalf("opened %d streams, want 1", files.streams)
+	}
+}
+
+func TestWebsiteNotFoundPageIsNotCachedAsImmutable(t *testing.T) {
+	files := &fakeFiles{content: []byte("<h1>Not found</h1>")}
+	files.pages = map[string]private.FolderInfo{websiteNotFound: remoteFileInfo(websiteNotFound, len(files.content))}
+	h := newTestHandler(t, files)
+
+	app := fiber.New()
+	app.Get("/*", func(c *fiber.Ctx) error {
+		notFound := models.NewAppError(models.NotFoundErrorCode, "")
+		return h.serveWebsiteFallback(c, "bag", private.FolderInfo{FilesCount: 1}, websiteSettings{}, notFound, h.logger)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/missing.html", nil), -1)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("status = %d, want 404", resp.StatusCode)
+	}
+
+	if got := resp.Header.Get(fiber.HeaderCacheControl); got != "no-cache" {
+		t.Fatalf("Cache-Control = %q, want no-cache", got)
+	}
+}
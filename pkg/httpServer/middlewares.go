@@ -3,6 +3,7 @@ package httpServer
 import (
 	"crypto/md5"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,18 +12,11 @@ import (
 // requirePermission создает middleware для проверки конкретного разрешения
 func (h *handler) requirePermission(permission string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		accessToken := c.Get("Authorization")
-		if accessToken == "" {
+		tokenHash := accessTokenHash(c)
+		if tokenHash == "" {
 			return errorHandler(c, fiber.NewError(fiber.StatusUnauthorized, "unauthorized"))
 		}
 
-		if strings.HasPrefix(strings.ToLower(accessToken), "bearer ") {
-			accessToken = accessToken[7:]
-		}
-
-		hash := md5.Sum([]byte(accessToken))
-		tokenHash := fmt.Sprintf("%x", hash[:])
-
 		tokenPermissions, exists := h.accessTokens[tokenHash]
 		if !exists {
 			return errorHandler(c, fiber.NewError(fiber.StatusForbidden, "forbidden"))
@@ -36,6 +30,12 @@ func (h *handler) requirePermission(permission string) fiber.Handler {
 			hasPermission = tokenPermissions.Reports
 		case "metrics":
 			hasPermission = tokenPermissions.Metrics
+		case "aliases":
+			hasPermission = tokenPermissions.Aliases
+		case "pins":
+			hasPermission = tokenPermissions.Pins
+		case "uploads":
+			hasPermission = tokenPermissions.Uploads
 		}
 
 		if !hasPermission {
@@ -46,6 +46,32 @@ func (h *handler) requirePermission(permission string) fiber.Handler {
 	}
 }
 
+// accessTokenHash returns md5 hash of the bearer token, or empty string if there is no token.
+func accessTokenHash(c *fiber.Ctx) string {
+	accessToken := c.Get("Authorization")
+	if accessToken == "" {
+		return ""
+	}
+
+	if strings.HasPrefix(strings.ToLower(accessToken), "bearer ") {
+		accessToken = accessToken[7:]
+	}
+
+	hash := md5.Sum([]byte(accessToken))
+	return fmt.Sprintf("%x", hash[:])
+}
+
+// hasValidToken reports whether the request carries a known access token with any permissions.
+func (h *handler) hasValidToken(c *fiber.Ctx) bool {
+	tokenHash := accessTokenHash(c)
+	if tokenHash == "" {
+		return false
+	}
+
+	_, exists := h.accessTokens[tokenHash]
+	return exists
+}
+
 func (h *handler) requireBans() fiber.Handler {
 	return h.requirePermission("bans")
 }
@@ -58,6 +84,18 @@ func (h *handler) requireMetrics() fiber.Handler {
 	return h.requirePermission("metrics")
 }
 
+func (h *handler) requireAliases() fiber.Handler {
+	return h.requirePermission("aliases")
+}
+
+func (h *handler) requirePins() fiber.Handler {
+	return h.requirePermission("pins")
+}
+
+func (h *handler) requireUploads() fiber.Handler {
+	return h.requirePermission("uploads")
+}
+
 func (h *handler) loggerMiddleware(c *fiber.Ctx) error {
 	headers := c.GetReqHeaders()
 	delete(headers, "Authorization")
@@ -74,23 +112,67 @@ func (h *handler) loggerMiddleware(c *fiber.Ctx) error {
 		"status_code", c.Response().StatusCode(),
 		"method", c.Method(),
 		"url", c.OriginalURL(),
+		"ip", clientIP(c),
 		"headers", headers,
-		"body_length", len(c.Body()),
+		"body_length", requestBodyLength(c),
 	)
 
 	return res
 }
 
+// bodyLimitMiddleware keeps the server body limit on every route but uploads.
+// With uploads enabled request bodies are streamed, so that upload routes take
+// larger bodies once the token is checked. Other bodies are read here up to the limit.
+func (h *handler) bodyLimitMiddleware(c *fiber.Ctx) error {
+	if !c.Request().IsBodyStream() {
+		return c.Next()
+	}
+
+	if !strings.HasPrefix(c.Path(), uploadsBase) {
+		body, err := readBody(c, h.server.Config().BodyLimit)
+		if err != nil {
+			// The rest of the body is left unread
+			c.Context().SetConnectionClose()
+			return errorHandler(c, err)
+		}
+
+		c.Request().SetBody(body)
+		return c.Next()
+	}
+
+	err := c.Next()
+
+	// The rest of a body the handler did not read would be parsed as the next request
+	if stream := c.Context().RequestBodyStream(); stream != nil {
+		if _, rerr := io.CopyN(io.Discard, stream, 1); rerr != io.EOF {
+			c.Context().SetConnectionClose()
+		}
+	}
+
+	return err
+}
+
 // securityHeadersMiddleware adds security headers for gateway routes
 func (h *handler) securityHeadersMiddleware(c *fiber.Ctx) error {
-	// Content-Security-Policy with sandbox directives to restrict capabilities
-	// allow-scripts - allows script execution
-	// allow-forms - allows form submission
-	// NOT including allow-same-origin - this prevents access to localStorage, cookies, etc.
-	c.Set("Content-Security-Policy", "sandbox allow-scripts allow-forms allow-downloads")
-
-	// X-Frame-Options to prevent clickjacking
-	c.Set("X-Frame-Options", "DENY")
+	if isBagOrigin(c) {
+		// Each bag has its own origin here, so the content can't reach other bags
+		// or the gateway itself and the sandbox may keep the origin:
+		// allow-same-origin - gives the bag its own localStorage, cookies, etc.
+		// allow-popups, allow-modals - for links opened in new tabs and alert/confirm dialogs
+		c.Set("Content-Security-Policy", "sandbox allow-scripts allow-forms allow-downloads allow-same-origin allow-popups allow-modals")
+
+		// The bag can embed its own pages
+		c.Set("X-Frame-Options", "SAMEORIGIN")
+	} else {
+		// Content-Security-Policy with sandbox directives to restrict capabilities
+		// allow-scripts - allows script execution
+		// allow-forms - allows form submission
+		// NOT including allow-same-origin - this prevents access to localStorage, cookies, etc.
+		c.Set("Content-Security-Policy", "sandbox allow-scripts allow-forms allow-downloads")
+
+		// X-Frame-Options to prevent clickjacking
+		c.Set("X-Frame-Options", "DENY")
+	}
 
 	// X-Content-Type-Options to prevent MIME-sniffing
 	c.Set("X-Content-Type-Options", "nosniff")
@@ -0,0 +1,122 @@
+package httpServer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+	"mytonstorage-gateway/pkg/utils"
+)
+
+func (h *handler) getAllPins(c *fiber.Ctx) error {
+	log := h.logger.With(
+		slog.String("func", "getAllPins"),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	pins, err := h.pins.GetAllPins(c.Context())
+	if err != nil {
+		log.Error("failed to get pins", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"pins": pins,
+	})
+}
+
+func (h *handler) getPin(c *fiber.Ctx) (err error) {
+	bagID := strings.ToLower(c.Params("bagid"))
+	log := h.logger.With(
+		slog.String("func", "getPin"),
+		slog.String("bagID", bagID),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	if !utils.ValidateBagID(bagID) {
+		log.Error("invalid bagid format")
+		err = fiber.NewError(fiber.StatusBadRequest, "invalid bagid")
+		return errorHandler(c, err)
+	}
+
+	pin, err := h.pins.GetPin(c.Context(), bagID)
+	if err != nil {
+		log.Error("failed to get pin", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	if pin == nil {
+		return errorHandler(c, fiber.NewError(fiber.StatusNotFound, "bag is not pinned"))
+	}
+
+	return c.JSON(fiber.Map{
+		"pin": pin,
+	})
+}
+
+// addPin adds the bag to the local daemon, the download goes on in background, see getPin for the progress.
+func (h *handler) addPin(c *fiber.Ctx) (err error) {
+	body := c.Body()
+	log := h.logger.With(
+		slog.String("func", "addPin"),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+		slog.Int("body_length", len(body)),
+	)
+
+	if len(body) == 0 || body[0] != '{' {
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid request body"))
+	}
+
+	var req v1.PinRequest
+	if err = json.Unmarshal(body, &req); err != nil {
+		log.Error("failed to parse request body", slog.String("error", err.Error()))
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid request body"))
+	}
+
+	req.BagID = strings.ToLower(req.BagID)
+	if !utils.ValidateBagID(req.BagID) {
+		log.Error("invalid bagid format")
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid bagid"))
+	}
+
+	if err = h.pins.AddPin(c.Context(), req.BagID, req.DownloadAll); err != nil {
+		log.Error("failed to add pin", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// deletePin removes the bag from the local daemon, ?with_files=true deletes the downloaded files too.
+func (h *handler) deletePin(c *fiber.Ctx) (err error) {
+	bagID := strings.ToLower(c.Params("bagid"))
+	log := h.logger.With(
+		slog.String("func", "deletePin"),
+		slog.String("bagID", bagID),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	if !utils.ValidateBagID(bagID) {
+		log.Error("invalid bagid format")
+		err = fiber.NewError(fiber.StatusBadRequest, "invalid bagid")
+		return errorHandler(c, err)
+	}
+
+	if err = h.pins.RemovePin(c.Context(), bagID, c.QueryBool("with_files")); err != nil {
+		log.Error("failed to remove pin", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,66 @@
+package httpServer
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"mytonstorage-gateway/pkg/constants"
+	"mytonstorage-gateway/pkg/models/private"
+	htmlTemplates "mytonstorage-gateway/pkg/templates"
+)
+
+// servePreview serves the ?view=preview page of a text or media file. Text files are read
+// to be highlighted, media players load the file from its own URL.
+func (h *handler) servePreview(c *fiber.Ctx, bagInfo private.FolderInfo, path string, ct htmlTemplates.ContentType, log *slog.Logger) error {
+	c.Type("html", "utf-8")
+	c.Set(fiber.HeaderContentDisposition, contentDisposition("inline", filepath.Base(path)))
+
+	if c.Method() == fiber.MethodHead {
+		// Page length is unknown without reading the file
+		return nil
+	}
+
+	size, ok := bagFileSize(bagInfo)
+	if !ok {
+		return errorHandler(c, fiber.NewError(fiber.StatusNotFound, "file not found"))
+	}
+
+	var content []byte
+	if ct.Preview == htmlTemplates.PreviewText && size <= constants.MaxPreviewFileSize {
+		var limits streamLimits
+		if err := h.checkQuota(c, bagInfo.BagID, &limits); err != nil {
+			return errorHandler(c, err)
+		}
+
+		var err error
+		content, err = h.readBagFile(c.Context(), bagInfo, path)
+		if err != nil {
+			return errorHandler(c, mapPathInfoError(err, bagInfo, log))
+		}
+
+		if limits.charge != nil {
+			_ = limits.charge(len(content))
+		}
+
+		if content == nil {
+			// Empty file, nil means too large for the template
+			content = []byte{}
+		}
+	}
+
+	if _, ok := domainTTL(c); ok {
+		// Links must stay on the domain
+		bagInfo.BagID = strings.ToLower(c.Params("bagid"))
+	}
+
+	page, err := h.templates.PreviewWithTemplate(bagInfo, path, size, content)
+	if err != nil {
+		log.Error("failed to render preview template", slog.String("error", err.Error()))
+		return errorHandler(c, fiber.NewError(fiber.StatusInternalServerError, ""))
+	}
+
+	return c.SendString(page)
+}
@@ -0,0 +1,101 @@
+package httpServer
+
+import (
+	"log/slog"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"mytonstorage-gateway/pkg/models/private"
+	"mytonstorage-gateway/pkg/utils"
+)
+
+// parseProofRange parses the ?range=start-end query parameter, end is inclusive and optional.
+// The end is clamped to the file size by the files service.
+func parseProofRange(value string) (*private.ByteRange, error) {
+	value = strings.TrimSpace(strings.TrimPrefix(value, "bytes="))
+	if value == "" {
+		return nil, nil
+	}
+
+	startStr, endStr, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid range")
+	}
+
+	start, err := strconv.ParseUint(strings.TrimSpace(startStr), 10, 64)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid range")
+	}
+
+	end := uint64(math.MaxUint64)
+	if endStr = strings.TrimSpace(endStr); endStr != "" {
+		end, err = strconv.ParseUint(endStr, 10, 64)
+		if err != nil || end < start {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "invalid range")
+		}
+	}
+
+	return &private.ByteRange{Start: start, End: end}, nil
+}
+
+// getProof returns the merkle proofs of the pieces covering the file or its byte range,
+// so clients can verify the served bytes against the bag merkle hash.
+func (h *handler) getProof(c *fiber.Ctx) (err error) {
+	bagid := strings.ToLower(c.Params("bagid"))
+	rawPath := c.Params("*")
+	log := h.logger.With(
+		slog.String("func", "getProof"),
+		slog.String("bagid", bagid),
+		slog.String("raw_path", rawPath),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	bagid, err = h.resolveBagID(c, bagid, log)
+	if err != nil {
+		return errorHandler(c, err)
+	}
+
+	if !utils.ValidateBagID(bagid) {
+		log.Error("invalid bagid format")
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid bagid"))
+	}
+
+	decodedPath, err := url.QueryUnescape(rawPath)
+	if err != nil {
+		log.Error("failed to decode path", slog.String("error", err.Error()))
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid path encoding"))
+	}
+
+	path, err := sanitizePath(decodedPath)
+	if err != nil {
+		return errorHandler(c, err)
+	}
+
+	if path == "." {
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "file path is required"))
+	}
+
+	rng, err := parseProofRange(c.Query("range"))
+	if err != nil {
+		return errorHandler(c, err)
+	}
+
+	etag := listingETag(bagid, path, "proof", c.Query("range"))
+	setCacheHeaders(c, etag)
+	if notModified(c, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	proof, err := h.files.FileProof(c.Context(), bagid, path, rng)
+	if err != nil {
+		return errorHandler(c, mapPathInfoError(err, private.FolderInfo{}, log))
+	}
+
+	return c.JSON(proof)
+}
@@ -0,0 +1,30 @@
+package httpServer
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// quotaChargeBytes is how many streamed bytes are accounted at once, a stream
+// may exceed the quota by up to this much before it is stopped.
+const quotaChargeBytes = 1 << 20
+
+// checkQuota rejects the request if the client or the bag has used up its traffic quota.
+// Otherwise bytes streamed with limits are charged to both of them while they are sent.
+func (h *handler) checkQuota(c *fiber.Ctx, bagID string, limits *streamLimits) error {
+	if h.quotas == nil {
+		return nil
+	}
+
+	// Streams are charged after the handler has returned
+	ctx := c.Context()
+	ip := clientIP(c)
+	if err := h.quotas.Check(ctx, ip, bagID); err != nil {
+		return err
+	}
+
+	limits.charge = func(n int) error {
+		return h.quotas.Add(ctx, ip, bagID, uint64(n))
+	}
+
+	return nil
+}
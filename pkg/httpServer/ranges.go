@@ -0,0 +1,306 @@
+package httpServer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"mytonstorage-gateway/pkg/models/private"
+)
+
+const maxRanges = 16
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// httpRange is an inclusive byte range of a file.
+type httpRange struct {
+	start uint64
+	end   uint64
+}
+
+func (r httpRange) length() uint64 {
+	return r.end - r.start + 1
+}
+
+func (r httpRange) contentRange(size uint64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size)
+}
+
+// parseRange parses the Range header value against the file size.
+// It returns nil ranges if the header is absent or malformed, so the full file should be sent.
+// Overlapping and adjacent ranges are coalesced and sorted.
+func parseRange(header string, size uint64) ([]httpRange, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil, nil
+	}
+
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, nil
+	}
+
+	var ranges []httpRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		startStr, endStr, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, nil
+		}
+		startStr = strings.TrimSpace(startStr)
+		endStr = strings.TrimSpace(endStr)
+
+		var r httpRange
+		if startStr == "" {
+			// suffix range: last N bytes
+			n, err := strconv.ParseUint(endStr, 10, 64)
+			if err != nil {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = httpRange{start: size - n, end: size - 1}
+		} else {
+			start, err := strconv.ParseUint(startStr, 10, 64)
+			if err != nil {
+				return nil, nil
+			}
+
+			end := size - 1
+			if endStr != "" {
+				end, err = strconv.ParseUint(endStr, 10, 64)
+				if err != nil || end < start {
+					return nil, nil
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+
+			if start >= size {
+				continue
+			}
+			r = httpRange{start: start, end: end}
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		return nil, errRangeNotSatisfiable
+	}
+
+	ranges = coalesceRanges(ranges)
+	if len(ranges) > maxRanges {
+		// Too fragmented request, serve the whole file instead
+		return nil, nil
+	}
+
+	return ranges, nil
+}
+
+func coalesceRanges(ranges []httpRange) []httpRange {
+	slices.SortFunc(ranges, func(a, b httpRange) int {
+		switch {
+		case a.start < b.start:
+			return -1
+		case a.start > b.start:
+			return 1
+		}
+		return 0
+	})
+
+	result := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &result[len(result)-1]
+		if r.start <= last.end+1 {
+			last.end = max(last.end, r.end)
+			continue
+		}
+		result = append(result, r)
+	}
+
+	return result
+}
+
+// ifRangeMatches reports whether the If-Range precondition allows a partial response.
+// Entity tags are compared strongly, dates must match the Last-Modified value exactly.
+func ifRangeMatches(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	ifRange := strings.TrimSpace(c.Get(fiber.HeaderIfRange))
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return etag != "" && !strings.HasPrefix(ifRange, "W/") && ifRange == etag
+	}
+
+	t, err := time.Parse(time.RFC1123, ifRange)
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+
+	return lastModified.UTC().Truncate(time.Second).Equal(t.UTC())
+}
+
+// rangeBody produces the response body for the given ranges and returns the body length.
+// first is the opened first range, the other ones are opened with open when the body gets to them.
+// A single range produces raw bytes, several ranges produce a multipart/byteranges body.
+func rangeBody(first io.ReadCloser, open func(rng *private.ByteRange) (io.ReadCloser, error), ranges []httpRange, size uint64, contentType, boundary string) (io.ReadCloser, uint64) {
+	if len(ranges) == 1 {
+		return readCloser{
+			Reader: io.LimitReader(first, int64(ranges[0].length())),
+			Closer: first,
+		}, ranges[0].length()
+	}
+
+	var (
+		readers []io.Reader
+		parts   rangeReaders
+		total   uint64
+	)
+
+	for i, r := range ranges {
+		var header strings.Builder
+		if i > 0 {
+			header.WriteString("\r\n")
+		}
+		header.WriteString("--" + boundary + "\r\n")
+		if contentType != "" {
+			header.WriteString(fiber.HeaderContentType + ": " + contentType + "\r\n")
+		}
+		header.WriteString(fiber.HeaderContentRange + ": " + r.contentRange(size) + "\r\n\r\n")
+
+		part := &rangeReader{open: open, rng: r}
+		if i == 0 {
+			part.src = first
+		}
+
+		parts = append(parts, part)
+		readers = append(readers, strings.NewReader(header.String()), part)
+		total += uint64(header.Len()) + r.length()
+	}
+
+	trailer := "\r\n--" + boundary + "--\r\n"
+	readers = append(readers, strings.NewReader(trailer))
+	total += uint64(len(trailer))
+
+	return readCloser{
+		Reader: io.MultiReader(readers...),
+		Closer: parts,
+	}, total
+}
+
+func multipartBoundary() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// rangeReader reads exactly the bytes of one range, the range is opened on the first read
+// and closed once it's read.
+type rangeReader struct {
+	open    func(rng *private.ByteRange) (io.ReadCloser, error)
+	rng     httpRange
+	src     io.ReadCloser
+	section *sectionReader
+	closed  bool
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.section != nil && r.section.n == 0 {
+		return 0, io.EOF
+	}
+
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	if r.src == nil {
+		src, err := r.open(&private.ByteRange{Start: r.rng.start, End: r.rng.end})
+		if err != nil {
+			return 0, err
+		}
+		r.src = src
+	}
+
+	if r.section == nil {
+		r.section = &sectionReader{r: r.src, n: r.rng.length()}
+	}
+
+	n, err := r.section.Read(p)
+	if err == io.EOF {
+		// The stream of a remote range holds its download until closed
+		_ = r.Close()
+	}
+
+	return n, err
+}
+
+func (r *rangeReader) Close() error {
+	r.closed = true
+	if r.src == nil {
+		return nil
+	}
+
+	err := r.src.Close()
+	r.src = nil
+	return err
+}
+
+// rangeReaders closes all ranges of a multipart body, whether they were read or not.
+type rangeReaders []*rangeReader
+
+func (rs rangeReaders) Close() error {
+	var errs []error
+	for _, r := range rs {
+		errs = append(errs, r.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// sectionReader reads exactly n bytes of a range.
+type sectionReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (s *sectionReader) Read(p []byte) (int, error) {
+	if s.n == 0 {
+		return 0, io.EOF
+	}
+
+	if uint64(len(p)) > s.n {
+		p = p[:s.n]
+	}
+
+	n, err := s.r.Read(p)
+	s.n -= uint64(n)
+	if err == io.EOF && s.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
@@ -0,0 +1,111 @@
+package httpServer
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	htmlTemplates "mytonstorage-gateway/pkg/templates"
+)
+
+// RateLimits are the numbers of requests a client may send within Window, per route class.
+// Zero disables the limit of the class.
+type RateLimits struct {
+	Window time.Duration
+	// Default applies to routes without their own limit
+	Default int
+	// Gateway applies to bag content, websites load many files per page
+	Gateway int
+	// Reports applies to report submissions
+	Reports int
+}
+
+type rateCounter interface {
+	Hit(ctx context.Context, key string, window time.Duration) (int, time.Duration, error)
+}
+
+const (
+	headerRateLimitLimit     = "X-RateLimit-Limit"
+	headerRateLimitRemaining = "X-RateLimit-Remaining"
+	headerRateLimitReset     = "X-RateLimit-Reset"
+)
+
+const (
+	rateLimitDefault = "default"
+	rateLimitGateway = "gateway"
+	rateLimitReports = "reports"
+)
+
+// rateLimitClass picks the limit for the request. Routes are not matched yet, so the path is checked.
+func rateLimitClass(c *fiber.Ctx) string {
+	path := c.Path()
+
+	switch {
+	case c.Method() == fiber.MethodPost && strings.HasPrefix(path, "/api/v1/reports"):
+		return rateLimitReports
+	case strings.HasPrefix(path, htmlTemplates.APIBase+"/"), strings.HasPrefix(path, aliasesBase+"/"):
+		return rateLimitGateway
+	}
+
+	return rateLimitDefault
+}
+
+// rateLimiters returns a limiter per route class. Counters are kept under keys prefixed
+// with the class, requests with a valid access token are not limited.
+func (h *handler) rateLimiters() []fiber.Handler {
+	classes := []struct {
+		name string
+		max  int
+	}{
+		{rateLimitDefault, h.rateLimits.Default},
+		{rateLimitGateway, h.rateLimits.Gateway},
+		{rateLimitReports, h.rateLimits.Reports},
+	}
+
+	handlers := make([]fiber.Handler, 0, len(classes))
+	for _, class := range classes {
+		if class.max <= 0 {
+			continue
+		}
+
+		handlers = append(handlers, h.rateLimiter(class.name, class.max))
+	}
+
+	return handlers
+}
+
+// rateLimiter counts requests of the class per client IP within fixed windows.
+// The counter is incremented and read in one call, so a shared counter is exact across instances.
+func (h *handler) rateLimiter(class string, limit int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if rateLimitClass(c) != class || h.hasValidToken(c) {
+			return c.Next()
+		}
+
+		hits, reset, err := h.rateCounter.Hit(c.Context(), "limiter:"+class+":"+clientIP(c), h.rateLimits.Window)
+		if err != nil {
+			// Requests are not refused because the counter is unavailable
+			h.logger.Error("failed to count request for rate limit",
+				slog.String("class", class),
+				slog.String("error", err.Error()))
+			return c.Next()
+		}
+
+		resetSeconds := strconv.FormatInt(int64(math.Ceil(reset.Seconds())), 10)
+		if hits > limit {
+			c.Set(fiber.HeaderRetryAfter, resetSeconds)
+			return h.limitReached(c)
+		}
+
+		c.Set(headerRateLimitLimit, strconv.Itoa(limit))
+		c.Set(headerRateLimitRemaining, strconv.Itoa(limit-hits))
+		c.Set(headerRateLimitReset, resetSeconds)
+
+		return c.Next()
+	}
+}
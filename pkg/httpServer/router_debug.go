@@ -6,15 +6,7 @@
 package httpServer
 
 import (
-	"time"
-
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
-)
-
-const (
-	MaxRequests     = 100
-	RateLimitWindow = 60 * time.Second
 )
 
 func (h *handler) RegisterRoutes() {
@@ -36,16 +28,17 @@ func (h *handler) RegisterRoutes() {
 
 	m := newMetrics(h.namespace, h.subsystem)
 
+	h.server.Use(h.clientIPMiddleware)
+
 	h.server.Use(m.metricsMiddleware)
+	h.server.Use(h.bagHostMiddleware)
+	h.server.Use(h.bodyLimitMiddleware)
 
-	h.server.Use(limiter.New(limiter.Config{
-		Max:               MaxRequests,
-		Expiration:        RateLimitWindow,
-		LimitReached:      h.limitReached,
-		LimiterMiddleware: limiter.SlidingWindow{},
-	}))
+	for _, l := range h.rateLimiters() {
+		h.server.Use(l)
+	}
 
-	apiv1 := h.server.Group("/api/v1", h.loggerMiddleware)
+	apiv1 := h.server.Group("/api/v1", h.loggerMiddleware, h.compressMiddleware)
 
 	apiv1.Get("/health", h.health)
 	apiv1.Get("/metrics", h.requireMetrics(), h.metrics)
@@ -53,10 +46,27 @@ func (h *handler) RegisterRoutes() {
 	{
 		gateway := apiv1.Group("/gateway", h.securityHeadersMiddleware)
 
+		// Get registers HEAD routes as well, HEAD is answered from metadata
+		// without opening file streams (see serveFile)
 		gateway.Get("/:bagid", h.getBag)
 		gateway.Get("/:bagid/*", h.getPath)
 	}
 
+	{
+		// Human-readable names of bags, see aliases
+		g := h.server.Group(aliasesBase, h.loggerMiddleware, h.compressMiddleware, h.securityHeadersMiddleware)
+
+		g.Get("/:slug", h.getAliasPath)
+		g.Get("/:slug/*", h.getAliasPath)
+	}
+
+	{
+		bags := apiv1.Group("/bags")
+
+		bags.Get("/:bagid/manifest", h.getManifest)
+		bags.Get("/:bagid/proof/*", h.getProof)
+	}
+
 	{
 		reports := apiv1.Group("/reports")
 
@@ -72,4 +82,34 @@ func (h *handler) RegisterRoutes() {
 		bans.Put("", h.requireBans(), h.updateBanStatus)
 		bans.Get("/:bagid", h.requireBans(), h.getBan)
 	}
+
+	{
+		aliases := apiv1.Group("/aliases")
+
+		aliases.Get("", h.requireAliases(), h.getAllAliases)
+		aliases.Put("", h.requireAliases(), h.putAlias)
+		aliases.Get("/:slug", h.requireAliases(), h.getAlias)
+		aliases.Delete("/:slug", h.requireAliases(), h.deleteAlias)
+	}
+
+	{
+		pins := apiv1.Group("/pins")
+
+		pins.Get("", h.requirePins(), h.getAllPins)
+		pins.Post("", h.requirePins(), h.addPin)
+		pins.Get("/:bagid", h.requirePins(), h.getPin)
+		pins.Delete("/:bagid", h.requirePins(), h.deletePin)
+	}
+
+	if h.uploads != nil {
+		uploads := apiv1.Group("/uploads")
+
+		uploads.Post("", h.requireUploads(), h.upload)
+		uploads.Post("/sessions", h.requireUploads(), h.createUploadSession)
+		uploads.Get("/sessions/:id", h.requireUploads(), h.getUploadSession)
+		uploads.Delete("/sessions/:id", h.requireUploads(), h.deleteUploadSession)
+		uploads.Post("/sessions/:id/files", h.requireUploads(), h.uploadSessionFiles)
+		uploads.Put("/sessions/:id/files/*", h.requireUploads(), h.uploadSessionChunk)
+		uploads.Post("/sessions/:id/complete", h.requireUploads(), h.completeUploadSession)
+	}
 }
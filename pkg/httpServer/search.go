@@ -0,0 +1,159 @@
+package httpServer
+
+import (
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"mytonstorage-gateway/pkg/constants"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+	"mytonstorage-gateway/pkg/models/private"
+	htmlTemplates "mytonstorage-gateway/pkg/templates"
+)
+
+// searchMatcher returns the match function for the ?search query. Queries with glob
+// metacharacters are matched as patterns: against the file name if the pattern has no slash,
+// against the path from the bag root otherwise. Other queries are case insensitive substrings of the path.
+func searchMatcher(query string) (func(name string) bool, error) {
+	query = strings.ToLower(query)
+
+	if !strings.ContainsAny(query, "*?[") {
+		return func(name string) bool {
+			return strings.Contains(strings.ToLower(name), query)
+		}, nil
+	}
+
+	pattern := strings.Trim(query, "/")
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid search pattern")
+	}
+
+	fullPath := strings.Contains(pattern, "/")
+
+	return func(name string) bool {
+		name = strings.ToLower(name)
+		if !fullPath {
+			name = path.Base(name)
+		}
+
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}, nil
+}
+
+// searchFiles returns the files matching the query, names are relative to the bag root.
+// Truncated is set if there are more than constants.MaxSearchResults matches.
+func searchFiles(files []v1.File, match func(name string) bool) (result []v1.File, truncated bool) {
+	for _, f := range files {
+		name := filepath.ToSlash(f.Name)
+		if !match(name) {
+			continue
+		}
+
+		if len(result) == constants.MaxSearchResults {
+			return result, true
+		}
+
+		f.Name = name
+		result = append(result, f)
+	}
+
+	return result, false
+}
+
+// serveSearch searches all files under the directory path recursively, results are
+// sorted and paginated the same way as directory listings.
+func (h *handler) serveSearch(c *fiber.Ctx, bagid, domain, path, query string, log *slog.Logger) error {
+	query = strings.TrimSpace(query)
+	if len(query) > constants.MaxSearchQueryLength {
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "search query too long"))
+	}
+
+	format := listingFormat(c)
+	c.Vary(fiber.HeaderAccept)
+
+	if format != listingHTML && format != listingJSON {
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "search results are available as html or json"))
+	}
+
+	match, err := searchMatcher(query)
+	if err != nil {
+		return errorHandler(c, err)
+	}
+
+	opts, err := parseListingOptions(c, format)
+	if err != nil {
+		return errorHandler(c, err)
+	}
+
+	// Search results are always paginated
+	if opts.perPage == 0 {
+		opts.perPage = constants.ListingPageSize
+	}
+
+	// Matching stops at MaxSearchResults, so later pages are rejected before the tree is listed
+	if opts.page > constants.MaxSearchResults/opts.perPage+1 {
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "page out of range"))
+	}
+
+	etag := listingETag(bagid, path, "search:"+format, opts.key()+"\x00"+query)
+	setCacheHeaders(c, etag)
+	if notModified(c, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	tree, err := h.files.ListTree(c.Context(), bagid, path)
+	if err != nil {
+		return errorHandler(c, mapPathInfoError(err, private.FolderInfo{}, log))
+	}
+
+	matches, truncated := searchFiles(tree.Files, match)
+	files, total := opts.apply(matches)
+	c.Set(headerTotalCount, strconv.Itoa(total))
+
+	result := v1.SearchResult{
+		BagID:        bagid,
+		CommonPath:   path,
+		Query:        query,
+		Files:        make([]v1.File, 0, len(files)),
+		EntriesCount: total,
+		Page:         opts.page,
+		PerPage:      opts.perPage,
+		Truncated:    truncated,
+	}
+
+	for _, f := range files {
+		f.Path = f.Name
+		f.Name = filepath.Base(f.Name)
+		result.Files = append(result.Files, f)
+	}
+
+	if format == listingJSON {
+		return c.JSON(result)
+	}
+
+	if _, ok := domainTTL(c); ok {
+		// Links must stay on the domain
+		result.BagID = domain
+	}
+
+	html, rerr := h.templates.SearchWithTemplate(result, htmlTemplates.Listing{
+		Sort:    opts.sort,
+		Order:   opts.order,
+		Query:   opts.query,
+		Search:  query,
+		Page:    opts.page,
+		PerPage: opts.perPage,
+		Total:   total,
+	})
+	if rerr != nil {
+		log.Error("failed to render search template", slog.String("error", rerr.Error()))
+		return errorHandler(c, fiber.NewError(fiber.StatusInternalServerError, ""))
+	}
+
+	return c.Type("html").SendString(html)
+}
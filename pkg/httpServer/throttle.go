@@ -0,0 +1,198 @@
+package httpServer
+
+import (
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mytonstorage-gateway/pkg/constants"
+)
+
+// sizeTier limits the download speed of files up to maxSize bytes, zero rate means unlimited.
+type sizeTier struct {
+	maxSize uint64
+	rate    int64
+}
+
+// parseSizeTiers parses tiers in "maxSize:bytesPerSecond" format sorted by size.
+// Invalid tiers are skipped with a warning, so a typo never lifts a limit.
+// Without valid tiers files are served up to MaxFileServeSize without throttling.
+func parseSizeTiers(tiers []string, logger *slog.Logger) []sizeTier {
+	result := make([]sizeTier, 0, len(tiers))
+
+	for _, t := range tiers {
+		if strings.TrimSpace(t) == "" {
+			continue
+		}
+
+		maxSize, rate, _ := strings.Cut(t, ":")
+
+		size, err := strconv.ParseUint(strings.TrimSpace(maxSize), 10, 64)
+		if err != nil || size == 0 {
+			logger.Warn("invalid size tier, skipped", slog.String("tier", t))
+			continue
+		}
+
+		bps, err := strconv.ParseInt(strings.TrimSpace(rate), 10, 64)
+		if err != nil || bps < 0 {
+			logger.Warn("invalid size tier rate, tier skipped", slog.String("tier", t))
+			continue
+		}
+
+		result = append(result, sizeTier{
+			maxSize: size,
+			rate:    bps,
+		})
+	}
+
+	if len(result) == 0 {
+		return []sizeTier{{maxSize: constants.MaxFileServeSize}}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].maxSize < result[j].maxSize
+	})
+
+	return result
+}
+
+// streamLimits describes how fast and how long content may be streamed.
+type streamLimits struct {
+	// rate is the per connection limit in bytes per second, zero means unlimited
+	rate int64
+	// global is shared by all connections, nil means unlimited
+	global *tokenBucket
+	// size of the whole content, the deadline of chunked responses is based on it
+	size uint64
+	// charge is called with the number of bytes sent, if set. Sending stops once it fails.
+	charge func(n int) error
+}
+
+// streamLimits picks the size tier for the content. False is returned if the content is too large to serve.
+func (h *handler) streamLimits(size uint64) (streamLimits, bool) {
+	for _, tier := range h.sizeTiers {
+		if size <= tier.maxSize {
+			return streamLimits{
+				rate:   tier.rate,
+				global: h.bandwidth,
+				size:   size,
+			}, true
+		}
+	}
+
+	return streamLimits{}, false
+}
+
+// deadline allows the base download timeout plus the time to send n bytes
+// at the minimum expected speed or at the throttled speed if it is lower.
+func (l streamLimits) deadline(n uint64) time.Time {
+	speed := uint64(constants.MinDownloadBytesPerSecond)
+	if l.rate > 0 && uint64(l.rate) < speed {
+		speed = uint64(l.rate)
+	}
+
+	timeout := time.Second*constants.FileDownloadTimeoutSeconds + time.Duration(n/speed)*time.Second
+
+	return time.Now().Add(timeout)
+}
+
+// reader wraps r with the per connection and global token buckets.
+func (l streamLimits) reader(r io.Reader) *throttledReader {
+	t := &throttledReader{
+		r:      r,
+		local:  newTokenBucket(l.rate),
+		global: l.global,
+		chunk:  64 * 1024,
+	}
+
+	// Small chunks keep the stream smooth on low rates
+	for _, b := range []*tokenBucket{t.local, t.global} {
+		if b != nil {
+			t.chunk = min(t.chunk, max(int(b.rate/8), 1024))
+		}
+	}
+
+	return t
+}
+
+// tokenBucket limits throughput to rate bytes per second with bursts up to one second of traffic.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(bytesPerSecond int64) *tokenBucket {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &tokenBucket{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// take consumes n tokens and returns how long the caller must wait before using them.
+// Tokens may go below zero, so concurrent readers are queued one after another.
+func (b *tokenBucket) take(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type throttledReader struct {
+	r      io.Reader
+	local  *tokenBucket
+	global *tokenBucket
+	chunk  int
+	// globalWait is the time spent waiting for the global bucket beyond the per connection one.
+	// It's caused by other downloads, so it extends the deadline of this one.
+	globalWait time.Duration
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.chunk {
+		p = p[:t.chunk]
+	}
+
+	n, err := t.r.Read(p)
+	if n > 0 {
+		var localWait, globalWait time.Duration
+		if t.local != nil {
+			localWait = t.local.take(n)
+		}
+		if t.global != nil {
+			globalWait = t.global.take(n)
+		}
+
+		if wait := max(localWait, globalWait); wait > 0 {
+			time.Sleep(wait)
+		}
+
+		t.globalWait += max(globalWait-localWait, 0)
+	}
+
+	return n, err
+}
+
+// expired reports whether the deadline has passed, not counting the time spent on the global bucket.
+func (t *throttledReader) expired(deadline time.Time) bool {
+	return time.Now().After(deadline.Add(t.globalWait))
+}
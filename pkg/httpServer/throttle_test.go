@@ -0,0 +1,69 @@
+package httpServer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// The global bucket is shared by all downloads, waiting for it must not cut the stream off.
+func TestCopyThrottledGlobalBucket(t *testing.T) {
+	const size = 3 << 19 // 1.5 MiB, half a second over the burst of 1 MiB/s
+
+	limits := streamLimits{global: newTokenBucket(1 << 20)}
+	src := limits.reader(bytes.NewReader(make([]byte, size)))
+
+	var out bytes.Buffer
+	copyThrottled(&out, src, time.Now().Add(100*time.Millisecond), nil)
+
+	if out.Len() != size {
+		t.Fatalf("copied %d bytes, want %d", out.Len(), size)
+	}
+
+	if src.globalWait < 300*time.Millisecond {
+		t.Fatalf("global wait = %v, want about 500ms", src.globalWait)
+	}
+}
+
+func TestCopyThrottledConnectionRate(t *testing.T) {
+	const size = 3 << 19
+
+	limits := streamLimits{rate: 1 << 20, global: newTokenBucket(2 << 20)}
+	src := limits.reader(bytes.NewReader(make([]byte, size)))
+
+	var counted int
+	copyThrottled(io.Discard, src, time.Now().Add(100*time.Millisecond), func(n int) error {
+		counted += n
+		return nil
+	})
+
+	if counted >= size {
+		t.Fatalf("copied %d bytes, want the stream cut off at the deadline", counted)
+	}
+
+	if src.globalWait != 0 {
+		t.Fatalf("global wait = %v, want 0 when the connection rate is lower", src.globalWait)
+	}
+}
+
+func TestCopyThrottledStopsWhenQuotaIsUsedUp(t *testing.T) {
+	const size = 8 * quotaChargeBytes
+
+	src := streamLimits{}.reader(bytes.NewReader(make([]byte, size)))
+
+	var out bytes.Buffer
+	charges := 0
+	copyThrottled(&out, src, time.Now().Add(time.Minute), func(n int) error {
+		charges++
+		if charges == 2 {
+			return errors.New("quota exceeded")
+		}
+		return nil
+	})
+
+	if out.Len() != 2*quotaChargeBytes {
+		t.Fatalf("copied %d bytes, want %d", out.Len(), 2*quotaChargeBytes)
+	}
+}
@@ -0,0 +1,99 @@
+package httpServer
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"mytonstorage-gateway/pkg/constants"
+	"mytonstorage-gateway/pkg/models/private"
+	thumbnailsService "mytonstorage-gateway/pkg/services/thumbnails"
+	htmlTemplates "mytonstorage-gateway/pkg/templates"
+)
+
+// thumbnailTypes are the image types thumbnails can be made of
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// thumbnailETag derives the entity tag of the thumbnail from the tag of the image.
+func thumbnailETag(bagInfo private.FolderInfo, size int) string {
+	return fmt.Sprintf(`%s-thumb%d"`, strings.TrimSuffix(fileETag(bagInfo), `"`), size)
+}
+
+// serveThumbnail serves the JPEG thumbnail of an image requested with ?thumb=<size>.
+func (h *handler) serveThumbnail(c *fiber.Ctx, bagInfo private.FolderInfo, path string, ct htmlTemplates.ContentType, log *slog.Logger) error {
+	size := c.QueryInt("thumb")
+
+	// Checked before the tag is derived, so invalid sizes never get cached or answered with 304
+	if !slices.Contains(thumbnailsService.Sizes, size) {
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid thumbnail size"))
+	}
+
+	if !thumbnailTypes[ct.MimeType] {
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "thumbnails are supported for JPEG, PNG, GIF and WebP images"))
+	}
+
+	if len(bagInfo.Files) == 0 {
+		return errorHandler(c, fiber.NewError(fiber.StatusNotFound, "file not found"))
+	}
+
+	fileSize, ok := bagFileSize(bagInfo)
+	if !ok {
+		return errorHandler(c, fiber.NewError(fiber.StatusNotFound, "file not found"))
+	}
+
+	if fileSize > constants.MaxFileServeSize {
+		log.Warn("image too large for a thumbnail", slog.Uint64("size", fileSize))
+		return errorHandler(c, fiber.NewError(fiber.StatusRequestEntityTooLarge, "image is too large for a thumbnail"))
+	}
+
+	etag := thumbnailETag(bagInfo, size)
+	setCacheHeaders(c, etag)
+	if notModified(c, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Type("jpg")
+	c.Set(fiber.HeaderContentDisposition, "inline")
+
+	if c.Method() == fiber.MethodHead {
+		// Thumbnail length is unknown until it's generated
+		return nil
+	}
+
+	var limits streamLimits
+	if err := h.checkQuota(c, bagInfo.BagID, &limits); err != nil {
+		return errorHandler(c, err)
+	}
+
+	data, err := h.thumbnails.Get(c.Context(), bagInfo.BagID, bagInfo.Files[0].Index, size, func() (io.ReadCloser, error) {
+		if bagInfo.SingleFilePath != "" {
+			return os.Open(bagInfo.SingleFilePath)
+		}
+
+		stream, err := h.files.StreamFile(c.Context(), bagInfo.BagID, path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return stream.FileStream, nil
+	})
+	if err != nil {
+		return errorHandler(c, mapPathInfoError(err, bagInfo, log))
+	}
+
+	if limits.charge != nil {
+		_ = limits.charge(len(data))
+	}
+
+	return c.Send(data)
+}
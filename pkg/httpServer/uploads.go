@@ -0,0 +1,430 @@
+package httpServer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+	htmlTemplates "mytonstorage-gateway/pkg/templates"
+)
+
+const (
+	uploadsBase = "/api/v1/uploads"
+
+	// uploadFormMemory is the part of a multipart form kept in memory, the rest goes to temporary files
+	uploadFormMemory = 1 << 20
+)
+
+var errBodyTooLarge = fiber.NewError(fiber.StatusRequestEntityTooLarge, "request body too large")
+
+type uploadSessionRequest struct {
+	Description string `json:"description"`
+}
+
+// upload creates a bag of the files of a multipart form in one request:
+// "files" parts, optional "paths" values with their paths inside the bag and optional "description".
+// Large files should be uploaded in chunks through an upload session instead.
+func (h *handler) upload(c *fiber.Ctx) error {
+	log := h.logger.With(
+		slog.String("func", "upload"),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	form, err := h.multipartForm(c, log)
+	if err != nil {
+		return errorHandler(c, err)
+	}
+	defer form.RemoveAll()
+
+	tokenHash := accessTokenHash(c)
+
+	session, err := h.uploads.CreateSession(c.Context(), tokenHash, formValue(form.Value, "description", 0))
+	if err != nil {
+		log.Error("failed to create upload session", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	log = log.With(slog.String("id", session.ID))
+
+	if err = h.writeFormFiles(c, session.ID, form, log); err == nil {
+		var result v1.UploadResult
+		if result, err = h.uploads.Complete(c.Context(), tokenHash, session.ID); err == nil {
+			result.URL = h.uploadURL(result.BagID)
+			return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+				"upload": result,
+			})
+		}
+
+		log.Error("failed to complete upload", slog.String("error", err.Error()))
+	}
+
+	if aErr := h.uploads.Abort(c.Context(), tokenHash, session.ID); aErr != nil {
+		log.Error("failed to abort upload session", slog.String("error", aErr.Error()))
+	}
+
+	return errorHandler(c, err)
+}
+
+func (h *handler) createUploadSession(c *fiber.Ctx) error {
+	log := h.logger.With(
+		slog.String("func", "createUploadSession"),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	// Upload routes stream their bodies, this one is small
+	body, err := readBody(c, h.server.Config().BodyLimit)
+	if err != nil {
+		return errorHandler(c, err)
+	}
+
+	var req uploadSessionRequest
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			log.Error("failed to parse request body", slog.String("error", err.Error()))
+			return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid request body"))
+		}
+	}
+
+	session, err := h.uploads.CreateSession(c.Context(), accessTokenHash(c), req.Description)
+	if err != nil {
+		log.Error("failed to create upload session", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"session": session,
+	})
+}
+
+// getUploadSession reports the bytes received for every file, an interrupted upload is resumed from them.
+func (h *handler) getUploadSession(c *fiber.Ctx) error {
+	id := c.Params("id")
+	log := h.logger.With(
+		slog.String("func", "getUploadSession"),
+		slog.String("id", id),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	session, err := h.uploads.GetSession(c.Context(), accessTokenHash(c), id)
+	if err != nil {
+		log.Error("failed to get upload session", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"session": session,
+	})
+}
+
+// uploadSessionFiles adds whole files of a multipart form to the session, see upload for the form fields.
+func (h *handler) uploadSessionFiles(c *fiber.Ctx) error {
+	id := c.Params("id")
+	log := h.logger.With(
+		slog.String("func", "uploadSessionFiles"),
+		slog.String("id", id),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	form, err := h.multipartForm(c, log)
+	if err != nil {
+		return errorHandler(c, err)
+	}
+	defer form.RemoveAll()
+
+	if err := h.writeFormFiles(c, id, form, log); err != nil {
+		return errorHandler(c, err)
+	}
+
+	return h.getUploadSession(c)
+}
+
+// uploadSessionChunk writes the request body to the file at the path inside the bag.
+// Content-Range: bytes <start>-<end>/<size> uploads a chunk, chunks must be sent in order.
+// Without Content-Range the body is the whole file. The body is streamed to the file.
+func (h *handler) uploadSessionChunk(c *fiber.Ctx) error {
+	id := c.Params("id")
+	rawPath := c.Params("*")
+	length := c.Request().Header.ContentLength()
+	log := h.logger.With(
+		slog.String("func", "uploadSessionChunk"),
+		slog.String("id", id),
+		slog.String("raw_path", rawPath),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+		slog.Int("body_length", length),
+	)
+
+	// The chunk length is part of Content-Range, so chunked bodies are not accepted
+	if length < 0 {
+		return errorHandler(c, fiber.NewError(fiber.StatusLengthRequired, "content length required"))
+	}
+
+	if length > h.uploadBodyLimit {
+		return errorHandler(c, errBodyTooLarge)
+	}
+
+	path, err := url.QueryUnescape(rawPath)
+	if err != nil {
+		log.Error("failed to decode path", slog.String("error", err.Error()))
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid path encoding"))
+	}
+
+	offset, total, ok := parseContentRange(c.Get(fiber.HeaderContentRange), uint64(length))
+	if !ok {
+		return errorHandler(c, fiber.NewError(fiber.StatusBadRequest, "invalid content range"))
+	}
+
+	body := requestBody(c, int64(length))
+	file, err := h.uploads.WriteFile(c.Context(), accessTokenHash(c), id, path, offset, total, body, uint64(length))
+	if err != nil {
+		log.Error("failed to write file", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"file": file,
+	})
+}
+
+func (h *handler) completeUploadSession(c *fiber.Ctx) error {
+	id := c.Params("id")
+	log := h.logger.With(
+		slog.String("func", "completeUploadSession"),
+		slog.String("id", id),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	result, err := h.uploads.Complete(c.Context(), accessTokenHash(c), id)
+	if err != nil {
+		log.Error("failed to complete upload", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	result.URL = h.uploadURL(result.BagID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"upload": result,
+	})
+}
+
+func (h *handler) deleteUploadSession(c *fiber.Ctx) error {
+	id := c.Params("id")
+	log := h.logger.With(
+		slog.String("func", "deleteUploadSession"),
+		slog.String("id", id),
+		slog.String("method", c.Method()),
+		slog.String("url", c.OriginalURL()),
+		slog.Any("headers", c.GetReqHeaders()),
+	)
+
+	if err := h.uploads.Abort(c.Context(), accessTokenHash(c), id); err != nil {
+		log.Error("failed to abort upload session", slog.String("error", err.Error()))
+		return errorHandler(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// multipartForm reads the multipart form from the request body of at most the upload request limit.
+// Files of the form are kept in temporary files, the caller removes them with form.RemoveAll.
+func (h *handler) multipartForm(c *fiber.Ctx, log *slog.Logger) (*multipart.Form, error) {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid multipart form")
+	}
+
+	if c.Request().Header.ContentLength() > h.uploadBodyLimit {
+		return nil, errBodyTooLarge
+	}
+
+	form, err := multipart.NewReader(requestBody(c, int64(h.uploadBodyLimit)), boundary).ReadForm(uploadFormMemory)
+	if err != nil {
+		log.Error("failed to parse multipart form", slog.String("error", err.Error()))
+		if errors.Is(err, errBodyTooLarge) {
+			return nil, errBodyTooLarge
+		}
+
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid multipart form")
+	}
+
+	return form, nil
+}
+
+// writeFormFiles writes the "files" parts of the multipart form to the session.
+func (h *handler) writeFormFiles(c *fiber.Ctx, id string, form *multipart.Form, log *slog.Logger) error {
+	files := form.File["files"]
+	if len(files) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "no files in the form")
+	}
+
+	tokenHash := accessTokenHash(c)
+	for i, fh := range files {
+		// The file name of a part has no directories, so paths are sent separately
+		path := formValue(form.Value, "paths", i)
+		if path == "" {
+			path = fh.Filename
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			log.Error("failed to open form file", slog.String("path", path), slog.String("error", err.Error()))
+			return fiber.NewError(fiber.StatusBadRequest, "invalid multipart form")
+		}
+
+		_, err = h.uploads.WriteFile(c.Context(), tokenHash, id, path, 0, uint64(fh.Size), f, uint64(fh.Size))
+		f.Close()
+		if err != nil {
+			log.Error("failed to write file", slog.String("path", path), slog.String("error", err.Error()))
+			return err
+		}
+	}
+
+	return nil
+}
+
+func formValue(values map[string][]string, key string, i int) string {
+	if i < len(values[key]) {
+		return values[key][i]
+	}
+
+	return ""
+}
+
+// parseContentRange parses "bytes <start>-<end>/<size>" of a chunk of length bytes.
+// An empty header means the chunk is the whole file.
+func parseContentRange(header string, length uint64) (offset, total uint64, ok bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, length, true
+	}
+
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, false
+	}
+
+	rng, size, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, false
+	}
+
+	total, err := strconv.ParseUint(strings.TrimSpace(size), 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	// "bytes */<size>" declares an empty file
+	if strings.TrimSpace(rng) == "*" {
+		return 0, total, length == 0 && total == 0
+	}
+
+	startStr, endStr, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseUint(strings.TrimSpace(startStr), 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	end, err := strconv.ParseUint(strings.TrimSpace(endStr), 10, 64)
+	if err != nil || end < start || end >= total || end-start+1 != length {
+		return 0, 0, false
+	}
+
+	return start, total, true
+}
+
+// requestBody returns the request body that fails with errBodyTooLarge past limit bytes.
+// Streamed bodies are read from the connection without buffering.
+func requestBody(c *fiber.Ctx, limit int64) io.Reader {
+	var r io.Reader
+	if c.Request().IsBodyStream() {
+		r = c.Context().RequestBodyStream()
+	} else {
+		r = bytes.NewReader(c.Body())
+	}
+
+	return &limitedBody{r: r, n: limit}
+}
+
+// readBody reads the whole request body of at most limit bytes.
+func readBody(c *fiber.Ctx, limit int) ([]byte, error) {
+	if !c.Request().IsBodyStream() {
+		return c.Body(), nil
+	}
+
+	body, err := io.ReadAll(requestBody(c, int64(limit)))
+	if errors.Is(err, errBodyTooLarge) {
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "failed to read request body")
+	}
+
+	return body, nil
+}
+
+// requestBodyLength returns the request body length without reading a streamed body.
+func requestBodyLength(c *fiber.Ctx) int {
+	if c.Request().IsBodyStream() {
+		return c.Request().Header.ContentLength()
+	}
+
+	return len(c.Body())
+}
+
+// limitedBody is io.LimitReader that tells a body over the limit from a body of exactly the limit.
+type limitedBody struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		var b [1]byte
+		if n, err := l.r.Read(b[:]); n > 0 {
+			return 0, errBodyTooLarge
+		} else if err != nil {
+			return 0, err
+		}
+
+		return 0, nil
+	}
+
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// uploadURL returns the gateway link of the created bag. Host and X-Forwarded-* headers
+// are controlled by the client, so the origin comes from the config only.
+func (h *handler) uploadURL(bagID string) string {
+	return h.publicURL + htmlTemplates.APIBase + "/" + bagID
+}
@@ -0,0 +1,151 @@
+package httpServer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"mytonstorage-gateway/pkg/models"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+	"mytonstorage-gateway/pkg/models/private"
+	"mytonstorage-gateway/pkg/utils"
+)
+
+// Website mode files, looked up in the order listed
+var (
+	websiteIndexFiles = []string{"index.html", "index.htm"}
+	websiteNotFound   = "404.html"
+)
+
+// websiteFallbackLocal is set when a fallback page is served instead of the requested path,
+// so the response isn't cached as the content of that path.
+const websiteFallbackLocal = "websiteFallback"
+
+type websiteSettings struct {
+	// spaEntry is served for unknown paths, relative to the bag root. Empty means no SPA fallback.
+	spaEntry string
+}
+
+// parseWebsites parses per-bag website settings in "bagid[:spa_entry]" format.
+func parseWebsites(websites []string) map[string]websiteSettings {
+	result := make(map[string]websiteSettings)
+
+	for _, w := range websites {
+		bagID, spaEntry, _ := strings.Cut(w, ":")
+		bagID = strings.ToLower(strings.TrimSpace(bagID))
+		if !utils.ValidateBagID(bagID) {
+			continue
+		}
+
+		result[bagID] = websiteSettings{
+			spaEntry: strings.Trim(strings.TrimSpace(spaEntry), "/"),
+		}
+	}
+
+	return result
+}
+
+// website reports whether the bag is served as a static website.
+// It's enabled for bags from config, for TON DNS domains and for any bag with ?website=1, ?website=0 turns it off.
+func (h *handler) website(c *fiber.Ctx, bagid string) (websiteSettings, bool) {
+	settings, ok := h.websites[bagid]
+	if _, isDomain := domainTTL(c); isDomain {
+		ok = true
+	}
+
+	return settings, c.QueryBool("website", ok)
+}
+
+// indexFile returns the name of the directory index page if the directory has one.
+func indexFile(files []v1.File) (string, bool) {
+	for _, name := range websiteIndexFiles {
+		for _, f := range files {
+			if !f.IsFolder && f.Name == name {
+				return name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// serveWebsiteIndex serves the index page of the directory. Relative links of the page
+// are resolved against the directory, so the URL must end with a slash.
+func (h *handler) serveWebsiteIndex(c *fiber.Ctx, bagid, path, index string, log *slog.Logger) error {
+	target, query, _ := strings.Cut(c.OriginalURL(), "?")
+	if !strings.HasSuffix(target, "/") {
+		target += "/"
+		if query != "" {
+			target += "?" + query
+		}
+
+		return c.Redirect(target, fiber.StatusMovedPermanently)
+	}
+
+	page, err := h.websitePage(c.Context(), bagid, filepath.Join(path, index))
+	if err != nil {
+		return errorHandler(c, mapPathInfoError(err, page, log))
+	}
+
+	return h.serveBagFile(c, page, filepath.Join(path, index), log)
+}
+
+// serveWebsiteFallback answers a request to an unknown path of a website:
+// with the SPA entry page if it's configured, otherwise with the bag's own 404.html.
+// If there is neither, the original error is returned. bagInfo is the result of the failed lookup,
+// fallbacks are looked up only if the bag itself was found, so a missing bag isn't waited for again.
+func (h *handler) serveWebsiteFallback(c *fiber.Ctx, bagid string, bagInfo private.FolderInfo, settings websiteSettings, notFound error, log *slog.Logger) error {
+	if !isNotFound(notFound) || bagInfo.FilesCount == 0 {
+		return notFound
+	}
+
+	c.Locals(websiteFallbackLocal, true)
+
+	if settings.spaEntry != "" {
+		page, err := h.websitePage(c.Context(), bagid, settings.spaEntry)
+		if err == nil {
+			return h.serveBagFile(c, page, settings.spaEntry, log)
+		}
+
+		log.Warn("failed to get SPA entry page", slog.String("path", settings.spaEntry), slog.String("error", err.Error()))
+		if !isNotFound(err) {
+			return notFound
+		}
+	}
+
+	page, err := h.websitePage(c.Context(), bagid, websiteNotFound)
+	if err != nil {
+		return notFound
+	}
+
+	c.Status(fiber.StatusNotFound)
+	return h.serveBagFile(c, page, websiteNotFound, log)
+}
+
+func isNotFound(err error) bool {
+	var appErr *models.AppError
+	return errors.As(err, &appErr) && appErr.Code == models.NotFoundErrorCode
+}
+
+// websitePage resolves a single file of the bag.
+func (h *handler) websitePage(ctx context.Context, bagid, path string) (private.FolderInfo, error) {
+	path, err := sanitizePath(path)
+	if err != nil {
+		return private.FolderInfo{}, err
+	}
+
+	page, err := h.files.GetPathInfo(ctx, bagid, path)
+	if err != nil {
+		return page, err
+	}
+
+	if page.StreamFile == nil && page.SingleFilePath == "" {
+		return page, models.NewAppError(models.NotFoundErrorCode, "file not found")
+	}
+
+	return page, nil
+}
@@ -12,16 +12,21 @@ import (
 type Options struct {
 	AllowScripts bool
 	AllowForms   bool
+	// AllowSameOrigin must be set only when the page is served from an origin dedicated to its bag
+	AllowSameOrigin bool
 }
 
 func WrapHTML(userHTML string, o Options) (string, error) {
-	iframeAttrs := make([]string, 0, 3)
+	iframeAttrs := make([]string, 0, 4)
 	if o.AllowScripts {
 		iframeAttrs = append(iframeAttrs, "allow-scripts")
 	}
 	if o.AllowForms {
 		iframeAttrs = append(iframeAttrs, "allow-forms")
 	}
+	if o.AllowSameOrigin {
+		iframeAttrs = append(iframeAttrs, "allow-same-origin")
+	}
 
 	sandbox := strings.Join(iframeAttrs, " ")
 
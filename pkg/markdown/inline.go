@@ -0,0 +1,541 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// safeSchemes are the only schemes kept in links and images, relative links are always kept
+var safeSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+	"ton":    true,
+}
+
+// isPunct reports whether c is ASCII punctuation, only it can be escaped with a backslash
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isSpaceAt(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return true
+	}
+
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return unicode.IsSpace(r)
+}
+
+func isAlnumBefore(s string, i int) bool {
+	if i <= 0 {
+		return false
+	}
+
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isAlnumAt(s string, i int) bool {
+	if i >= len(s) {
+		return false
+	}
+
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func unescapeBackslashes(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// codeSpanEnd returns the end of the code span opened at i, or -1 if it isn't closed.
+func codeSpanEnd(s string, i int) (contentEnd, end int) {
+	n := 0
+	for i+n < len(s) && s[i+n] == '`' {
+		n++
+	}
+
+	for j := i + n; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+
+		m := 0
+		for j+m < len(s) && s[j+m] == '`' {
+			m++
+		}
+		if m == n {
+			return j, j + m
+		}
+		j += m
+	}
+
+	return -1, -1
+}
+
+// skipInline returns the index after an escape or a code span at i, they can't contain delimiters.
+func skipInline(s string, i int) int {
+	switch s[i] {
+	case '\\':
+		return min(i+2, len(s))
+	case '`':
+		if _, end := codeSpanEnd(s, i); end > 0 {
+			return end
+		}
+
+		n := 0
+		for i+n < len(s) && s[i+n] == '`' {
+			n++
+		}
+		return i + n
+	}
+
+	return i + 1
+}
+
+// renderInline renders the inline content of a block.
+func renderInline(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			b.WriteString("<br>\n")
+			i += 2
+
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+
+		case c == '`':
+			contentEnd, end := codeSpanEnd(s, i)
+			if end < 0 {
+				n := skipInline(s, i) - i
+				b.WriteString(s[i : i+n])
+				i += n
+				continue
+			}
+
+			n := end - contentEnd
+			code := strings.ReplaceAll(s[i+n:contentEnd], "\n", " ")
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+
+			b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+			i = end
+
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			if out, end, ok := renderLink(s, i+1, true); ok {
+				b.WriteString(out)
+				i = end
+				continue
+			}
+
+			b.WriteByte('!')
+			i++
+
+		case c == '[':
+			if out, end, ok := renderLink(s, i, false); ok {
+				b.WriteString(out)
+				i = end
+				continue
+			}
+
+			b.WriteByte('[')
+			i++
+
+		case c == '<':
+			if out, end, ok := renderAutolink(s, i); ok {
+				b.WriteString(out)
+				i = end
+				continue
+			}
+
+			b.WriteString("&lt;")
+			i++
+
+		case c == '*' || c == '_' || c == '~':
+			out, end := renderEmphasis(s, i)
+			b.WriteString(out)
+			i = end
+
+		case c == '&':
+			if end := entityEnd(s, i); end > 0 {
+				b.WriteString(s[i:end])
+				i = end
+				continue
+			}
+
+			b.WriteString("&amp;")
+			i++
+
+		case c == ' ':
+			n := 0
+			for i+n < len(s) && s[i+n] == ' ' {
+				n++
+			}
+
+			switch {
+			case i+n < len(s) && s[i+n] == '\n' && n >= 2:
+				b.WriteString("<br>")
+			case i+n < len(s) && s[i+n] == '\n':
+			default:
+				b.WriteString(s[i : i+n])
+			}
+			i += n
+
+		default:
+			b.WriteString(html.EscapeString(s[i : i+1]))
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+// entityEnd returns the end of the HTML entity reference at i, or -1 if there is none.
+func entityEnd(s string, i int) int {
+	end := strings.IndexByte(s[i:], ';')
+	if end < 2 || end > 32 {
+		return -1
+	}
+
+	name := s[i+1 : i+end]
+	for j := 0; j < len(name); j++ {
+		if !isAlnumAt(name, j) && (j != 0 || name[0] != '#') {
+			return -1
+		}
+	}
+
+	if strings.HasPrefix(name, "#") {
+		digits := name[1:]
+		if strings.HasPrefix(digits, "x") || strings.HasPrefix(digits, "X") {
+			digits = digits[1:]
+		}
+		if digits == "" || len(digits) > 7 {
+			return -1
+		}
+	}
+
+	// Unknown names are escaped
+	if html.UnescapeString(s[i:i+end+1]) == s[i:i+end+1] {
+		return -1
+	}
+
+	return i + end + 1
+}
+
+// renderEmphasis renders emphasis opened by the delimiter run at i, or the run as text.
+func renderEmphasis(s string, i int) (string, int) {
+	c := s[i]
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+
+	canOpen := !isSpaceAt(s, i+n) && (c != '_' || !isAlnumBefore(s, i))
+	if !canOpen || n > 3 || (c == '~' && n != 2) {
+		return html.EscapeString(s[i : i+n]), i + n
+	}
+
+	if end := findCloser(s, i+n, c, n); end > 0 {
+		inner := renderInline(s[i+n : end])
+
+		var out string
+		switch {
+		case c == '~':
+			out = "<del>" + inner + "</del>"
+		case n == 1:
+			out = "<em>" + inner + "</em>"
+		case n == 2:
+			out = "<strong>" + inner + "</strong>"
+		default:
+			out = "<em><strong>" + inner + "</strong></em>"
+		}
+
+		return out, end + n
+	}
+
+	// "***a** b*" and "***a* b**" close the inner emphasis first
+	if n == 3 && c != '~' {
+		for _, m := range []int{2, 1} {
+			mid := findCloser(s, i+n, c, m)
+			if mid < 0 {
+				continue
+			}
+
+			if end := findCloser(s, mid+m, c, n-m); end > 0 {
+				inner, rest := renderInline(s[i+n:mid]), renderInline(s[mid+m:end])
+				if m == 2 {
+					return "<em><strong>" + inner + "</strong>" + rest + "</em>", end + n - m
+				}
+
+				return "<strong><em>" + inner + "</em>" + rest + "</strong>", end + n - m
+			}
+		}
+	}
+
+	// "***text**" is a literal star followed by strong text
+	if n > 1 && c != '~' {
+		return html.EscapeString(s[i : i+1]), i + 1
+	}
+
+	return html.EscapeString(s[i : i+n]), i + n
+}
+
+// findCloser returns the start of the delimiter run of exactly n characters c closing emphasis at start.
+func findCloser(s string, start int, c byte, n int) int {
+	for j := start; j < len(s); {
+		if s[j] == '\\' || s[j] == '`' {
+			j = skipInline(s, j)
+			continue
+		}
+
+		// Links bind tighter than emphasis, delimiters inside them can't close it
+		if s[j] == '[' {
+			if textEnd := linkTextEnd(s, j); textEnd > 0 {
+				if _, _, end, ok := parseDestination(s, textEnd+1); ok {
+					j = end
+					continue
+				}
+			}
+		}
+
+		if s[j] != c {
+			j++
+			continue
+		}
+
+		m := 0
+		for j+m < len(s) && s[j+m] == c {
+			m++
+		}
+
+		if m == n && j > start && !isSpaceAt(s, j-1) && (c != '_' || !isAlnumAt(s, j+m)) {
+			return j
+		}
+		j += m
+	}
+
+	return -1
+}
+
+// linkTextEnd returns the index of the bracket closing the link text opened at i.
+func linkTextEnd(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); {
+		switch s[j] {
+		case '\\', '`':
+			j = skipInline(s, j)
+			continue
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+		j++
+	}
+
+	return -1
+}
+
+// parseDestination parses "(url "title")" at i and returns the url, title and the index after ")".
+func parseDestination(s string, i int) (dest, title string, end int, ok bool) {
+	if i >= len(s) || s[i] != '(' {
+		return "", "", 0, false
+	}
+
+	j := i + 1
+	for j < len(s) && (s[j] == ' ' || s[j] == '\n') {
+		j++
+	}
+
+	if j < len(s) && s[j] == '<' {
+		close := strings.IndexAny(s[j+1:], ">\n")
+		if close < 0 || s[j+1+close] != '>' {
+			return "", "", 0, false
+		}
+
+		dest = s[j+1 : j+1+close]
+		j += close + 2
+	} else {
+		start, depth := j, 0
+		for ; j < len(s) && s[j] > ' '; j++ {
+			if s[j] == '\\' && j+1 < len(s) {
+				j++
+				continue
+			}
+			if s[j] == '(' {
+				depth++
+			}
+			if s[j] == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+		}
+
+		dest = s[start:j]
+	}
+
+	for j < len(s) && (s[j] == ' ' || s[j] == '\n') {
+		j++
+	}
+
+	if j < len(s) && (s[j] == '"' || s[j] == '\'' || s[j] == '(') {
+		closeChar := s[j]
+		if closeChar == '(' {
+			closeChar = ')'
+		}
+
+		close := strings.IndexByte(s[j+1:], closeChar)
+		if close < 0 {
+			return "", "", 0, false
+		}
+
+		title = s[j+1 : j+1+close]
+		j += close + 2
+
+		for j < len(s) && (s[j] == ' ' || s[j] == '\n') {
+			j++
+		}
+	}
+
+	if j >= len(s) || s[j] != ')' {
+		return "", "", 0, false
+	}
+
+	return unescapeBackslashes(dest), unescapeBackslashes(title), j + 1, true
+}
+
+// safeURL returns the URL escaped for an attribute, false is returned for unsafe schemes.
+func safeURL(u string) (string, bool) {
+	u = strings.TrimSpace(u)
+	for i := 0; i < len(u); i++ {
+		// Browsers ignore control characters in schemes, "java\tscript:" is still a script
+		if u[i] < ' ' || u[i] == 0x7f {
+			return "", false
+		}
+	}
+
+	if colon := strings.IndexByte(u, ':'); colon >= 0 {
+		if slash := strings.IndexAny(u, "/?#"); slash < 0 || colon < slash {
+			if !safeSchemes[strings.ToLower(u[:colon])] {
+				return "", false
+			}
+		}
+	}
+
+	return html.EscapeString(strings.ReplaceAll(u, " ", "%20")), true
+}
+
+// plainText returns inline content without markup for image alt texts.
+func plainText(s string) string {
+	out := renderInline(s)
+
+	var b strings.Builder
+	inTag := false
+	for i := 0; i < len(out); i++ {
+		switch {
+		case out[i] == '<':
+			inTag = true
+		case out[i] == '>':
+			inTag = false
+		case !inTag:
+			b.WriteByte(out[i])
+		}
+	}
+
+	return b.String()
+}
+
+// renderLink renders a link or an image whose text starts at the bracket at i.
+func renderLink(s string, i int, image bool) (string, int, bool) {
+	textEnd := linkTextEnd(s, i)
+	if textEnd < 0 {
+		return "", 0, false
+	}
+
+	dest, title, end, ok := parseDestination(s, textEnd+1)
+	if !ok {
+		return "", 0, false
+	}
+
+	text := s[i+1 : textEnd]
+	href, safe := safeURL(dest)
+
+	var titleAttr string
+	if title != "" {
+		titleAttr = ` title="` + html.EscapeString(title) + `"`
+	}
+
+	if image {
+		if !safe {
+			return html.EscapeString(unescapeBackslashes(text)), end, true
+		}
+
+		return `<img src="` + href + `" alt="` + plainText(text) + `"` + titleAttr + ` loading="lazy">`, end, true
+	}
+
+	// Links can't be nested, the innermost one is the link and outer brackets are the text
+	inner := renderInline(text)
+	if strings.Contains(inner, "<a ") {
+		return "", 0, false
+	}
+
+	if !safe {
+		return inner, end, true
+	}
+
+	return `<a href="` + href + `"` + titleAttr + ` rel="nofollow noopener">` + inner + `</a>`, end, true
+}
+
+// renderAutolink renders "<https://...>" and "<user@example.com>" links.
+func renderAutolink(s string, i int) (string, int, bool) {
+	close := strings.IndexAny(s[i+1:], "<> \n")
+	if close <= 0 || s[i+1+close] != '>' {
+		return "", 0, false
+	}
+
+	target := s[i+1 : i+1+close]
+	end := i + close + 2
+
+	href := target
+	if !strings.Contains(target, ":") {
+		at := strings.IndexByte(target, '@')
+		if at <= 0 || at == len(target)-1 {
+			return "", 0, false
+		}
+
+		href = "mailto:" + target
+	}
+
+	escaped, ok := safeURL(href)
+	if !ok {
+		return "", 0, false
+	}
+
+	return `<a href="` + escaped + `" rel="nofollow noopener">` + html.EscapeString(target) + `</a>`, end, true
+}
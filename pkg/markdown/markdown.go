@@ -0,0 +1,580 @@
+// Package markdown renders the commonly used subset of CommonMark and GitHub tables to HTML.
+// Raw HTML of the source is escaped instead of passed through and links are limited to safe
+// schemes, so the result can be embedded into gateway pages as is.
+package markdown
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Render converts markdown source to sanitized HTML.
+func Render(src []byte) string {
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.ReplaceAll(text, "\x00", "�")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+
+	var b strings.Builder
+	renderBlocks(&b, lines, false)
+
+	return b.String()
+}
+
+// expandTabs replaces tabs of the leading whitespace, indentation decides the block structure.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+
+	var b strings.Builder
+	col := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			b.WriteByte(' ')
+			col++
+		case '\t':
+			n := 4 - col%4
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+		default:
+			b.WriteString(line[i:])
+			return b.String()
+		}
+	}
+
+	return b.String()
+}
+
+// renderBlocks renders lines as a sequence of blocks. Paragraphs of tight list items aren't wrapped into <p>.
+func renderBlocks(b *strings.Builder, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if isBlank(line) {
+			i++
+			continue
+		}
+
+		indent := indentOf(line)
+		if indent >= 4 {
+			i = renderIndentedCode(b, lines, i)
+			continue
+		}
+
+		trimmed := line[indent:]
+		switch {
+		case isFence(trimmed):
+			i = renderFencedCode(b, lines, i, indent)
+		case headingLevel(trimmed) > 0:
+			renderHeading(b, trimmed)
+			i++
+		case isThematicBreak(trimmed):
+			b.WriteString("<hr>\n")
+			i++
+		case trimmed[0] == '>':
+			i = renderBlockquote(b, lines, i)
+		case isListItem(trimmed):
+			i = renderList(b, lines, i)
+		case isTableStart(lines, i):
+			i = renderTable(b, lines, i)
+		default:
+			i = renderParagraph(b, lines, i, tight)
+		}
+	}
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// startsBlock reports whether the line interrupts a paragraph.
+func startsBlock(line string) bool {
+	indent := indentOf(line)
+	if indent >= 4 || isBlank(line) {
+		return false
+	}
+
+	trimmed := line[indent:]
+	if isFence(trimmed) || headingLevel(trimmed) > 0 || isThematicBreak(trimmed) || trimmed[0] == '>' {
+		return true
+	}
+
+	// Only lists which can't be a part of the text interrupt paragraphs
+	if m, ok := parseListMarker(trimmed); ok && !isBlank(trimmed[m.width:]) {
+		return !m.ordered || m.start == 1
+	}
+
+	return false
+}
+
+func renderIndentedCode(b *strings.Builder, lines []string, i int) int {
+	var code []string
+	for ; i < len(lines); i++ {
+		if !isBlank(lines[i]) && indentOf(lines[i]) < 4 {
+			break
+		}
+
+		if len(lines[i]) >= 4 {
+			code = append(code, lines[i][4:])
+		} else {
+			code = append(code, "")
+		}
+	}
+
+	for len(code) > 0 && isBlank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+
+	b.WriteString("<pre><code>")
+	for _, line := range code {
+		b.WriteString(html.EscapeString(line))
+		b.WriteByte('\n')
+	}
+	b.WriteString("</code></pre>\n")
+
+	return i
+}
+
+func isFence(s string) bool {
+	if len(s) < 3 || (s[0] != '`' && s[0] != '~') {
+		return false
+	}
+
+	n := fenceLength(s)
+	if n < 3 {
+		return false
+	}
+
+	// Backticks can't be in the info string of a backtick fence
+	return s[0] != '`' || !strings.Contains(s[n:], "`")
+}
+
+func fenceLength(s string) int {
+	n := 0
+	for n < len(s) && s[n] == s[0] {
+		n++
+	}
+
+	return n
+}
+
+func renderFencedCode(b *strings.Builder, lines []string, i, indent int) int {
+	open := lines[i][indent:]
+	fence, n := open[0], fenceLength(open)
+	lang, _, _ := strings.Cut(strings.TrimSpace(open[n:]), " ")
+
+	var code []string
+	for i++; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " ")
+		if indentOf(line) < 4 && len(trimmed) > 0 && trimmed[0] == fence &&
+			fenceLength(trimmed) >= n && isBlank(trimmed[fenceLength(trimmed):]) {
+			i++
+			break
+		}
+
+		// Content is unindented by the indent of the opening fence
+		strip := min(indent, indentOf(line))
+		code = append(code, line[strip:])
+	}
+
+	if lang != "" {
+		b.WriteString(`<pre><code class="language-` + html.EscapeString(unescapeBackslashes(lang)) + `">`)
+	} else {
+		b.WriteString("<pre><code>")
+	}
+	for _, line := range code {
+		b.WriteString(html.EscapeString(line))
+		b.WriteByte('\n')
+	}
+	b.WriteString("</code></pre>\n")
+
+	return i
+}
+
+func headingLevel(s string) int {
+	n := 0
+	for n < len(s) && s[n] == '#' {
+		n++
+	}
+
+	if n == 0 || n > 6 || (n < len(s) && s[n] != ' ') {
+		return 0
+	}
+
+	return n
+}
+
+func renderHeading(b *strings.Builder, s string) {
+	level := headingLevel(s)
+	text := strings.TrimSpace(s[level:])
+
+	// Closing sequence: "## Title ##"
+	if stripped := strings.TrimRight(text, "#"); stripped == "" || strings.HasSuffix(stripped, " ") {
+		text = strings.TrimSpace(stripped)
+	}
+
+	writeHeading(b, level, text)
+}
+
+func writeHeading(b *strings.Builder, level int, text string) {
+	tag := "h" + strconv.Itoa(level)
+	b.WriteString("<" + tag + ">" + renderInline(text) + "</" + tag + ">\n")
+}
+
+func isThematicBreak(s string) bool {
+	if s == "" || (s[0] != '-' && s[0] != '*' && s[0] != '_') {
+		return false
+	}
+
+	count := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case s[0]:
+			count++
+		case ' ':
+		default:
+			return false
+		}
+	}
+
+	return count >= 3
+}
+
+// setextLevel returns the heading level if the line underlines a paragraph.
+func setextLevel(line string) int {
+	if indentOf(line) >= 4 {
+		return 0
+	}
+
+	s := strings.TrimSpace(line)
+	if s == "" || strings.Trim(s, string(s[0])) != "" {
+		return 0
+	}
+
+	switch s[0] {
+	case '=':
+		return 1
+	case '-':
+		return 2
+	}
+
+	return 0
+}
+
+func renderBlockquote(b *strings.Builder, lines []string, i int) int {
+	var inner []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " ")
+
+		if indentOf(line) < 4 && strings.HasPrefix(trimmed, ">") {
+			trimmed = trimmed[1:]
+			trimmed = strings.TrimPrefix(trimmed, " ")
+			inner = append(inner, trimmed)
+			continue
+		}
+
+		// Lazy continuation of a paragraph inside the quote
+		if isBlank(line) || startsBlock(line) || len(inner) == 0 || isBlank(inner[len(inner)-1]) {
+			break
+		}
+
+		inner = append(inner, line)
+	}
+
+	b.WriteString("<blockquote>\n")
+	renderBlocks(b, inner, false)
+	b.WriteString("</blockquote>\n")
+
+	return i
+}
+
+type listMarker struct {
+	ordered bool
+	start   int
+	// delim is the bullet character or the delimiter after the number
+	delim byte
+	// width of the marker with the following spaces, content of the item starts after it
+	width int
+}
+
+func parseListMarker(s string) (listMarker, bool) {
+	var m listMarker
+
+	n := 0
+	switch {
+	case s != "" && (s[0] == '-' || s[0] == '*' || s[0] == '+'):
+		m.delim = s[0]
+		n = 1
+	default:
+		for n < len(s) && n < 9 && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		if n == 0 || n >= len(s) || (s[n] != '.' && s[n] != ')') {
+			return m, false
+		}
+
+		m.ordered = true
+		m.start, _ = strconv.Atoi(s[:n])
+		m.delim = s[n]
+		n++
+	}
+
+	if n < len(s) && s[n] != ' ' {
+		return m, false
+	}
+
+	spaces := indentOf(s[n:])
+	if spaces == 0 || spaces > 4 || n+spaces == len(s) {
+		// Empty items and items starting with indented code keep one space
+		spaces = 1
+	}
+	m.width = n + min(spaces, len(s)-n)
+
+	return m, true
+}
+
+func isListItem(s string) bool {
+	_, ok := parseListMarker(s)
+	return ok && !isThematicBreak(s)
+}
+
+func renderList(b *strings.Builder, lines []string, i int) int {
+	indent := indentOf(lines[i])
+	first, _ := parseListMarker(lines[i][indent:])
+
+	var (
+		items      [][]string
+		loose      bool
+		blankAfter bool
+		content    int
+	)
+
+	for i < len(lines) {
+		line := lines[i]
+
+		if isBlank(line) {
+			if len(items) > 0 {
+				items[len(items)-1] = append(items[len(items)-1], "")
+			}
+			blankAfter = true
+			i++
+			continue
+		}
+
+		lineIndent := indentOf(line)
+		if lineIndent >= content && len(items) > 0 {
+			// Continuation of the current item
+			if blankAfter {
+				loose = true
+			}
+			items[len(items)-1] = append(items[len(items)-1], line[content:])
+			blankAfter = false
+			i++
+			continue
+		}
+
+		trimmed := line[lineIndent:]
+		if m, ok := parseListMarker(trimmed); ok && lineIndent < 4 && !isThematicBreak(trimmed) &&
+			m.ordered == first.ordered && m.delim == first.delim {
+			if len(items) > 0 && blankAfter {
+				loose = true
+			}
+
+			content = lineIndent + m.width
+			items = append(items, []string{line[min(content, len(line)):]})
+			blankAfter = false
+			i++
+			continue
+		}
+
+		// Lazy continuation of the last paragraph
+		if !blankAfter && len(items) > 0 && !startsBlock(line) && setextLevel(line) == 0 {
+			items[len(items)-1] = append(items[len(items)-1], trimmed)
+			i++
+			continue
+		}
+
+		break
+	}
+
+	// Blank lines at the end belong to the surrounding block
+	for len(items) > 0 {
+		last := items[len(items)-1]
+		if len(last) == 0 || !isBlank(last[len(last)-1]) {
+			break
+		}
+		items[len(items)-1] = last[:len(last)-1]
+	}
+
+	switch {
+	case !first.ordered:
+		b.WriteString("<ul>\n")
+	case first.start != 1:
+		b.WriteString(`<ol start="` + strconv.Itoa(first.start) + `">` + "\n")
+	default:
+		b.WriteString("<ol>\n")
+	}
+
+	for _, item := range items {
+		b.WriteString("<li>")
+		renderBlocks(b, item, !loose)
+		b.WriteString("</li>\n")
+	}
+
+	if first.ordered {
+		b.WriteString("</ol>\n")
+	} else {
+		b.WriteString("</ul>\n")
+	}
+
+	return i
+}
+
+func renderParagraph(b *strings.Builder, lines []string, i int, tight bool) int {
+	var text []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) {
+			break
+		}
+
+		if len(text) > 0 {
+			if level := setextLevel(line); level > 0 {
+				writeHeading(b, level, strings.Join(text, "\n"))
+				return i + 1
+			}
+
+			if startsBlock(line) {
+				break
+			}
+		}
+
+		text = append(text, strings.TrimLeft(line, " "))
+	}
+
+	content := renderInline(strings.TrimRight(strings.Join(text, "\n"), " "))
+	if tight {
+		b.WriteString(content + "\n")
+	} else {
+		b.WriteString("<p>" + content + "</p>\n")
+	}
+
+	return i
+}
+
+// splitTableRow splits a table row into cells, escaped pipes are kept in the cells.
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var (
+		cells []string
+		cell  strings.Builder
+	)
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// tableAlignments parses the delimiter row, false is returned if the line is not one.
+func tableAlignments(line string) ([]string, bool) {
+	if !strings.Contains(line, "-") {
+		return nil, false
+	}
+
+	cells := splitTableRow(line)
+	aligns := make([]string, len(cells))
+	for i, cell := range cells {
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		dashes := strings.Trim(cell, ":")
+		if dashes == "" || strings.Trim(dashes, "-") != "" {
+			return nil, false
+		}
+
+		switch {
+		case left && right:
+			aligns[i] = "center"
+		case left:
+			aligns[i] = "left"
+		case right:
+			aligns[i] = "right"
+		}
+	}
+
+	return aligns, true
+}
+
+func isTableStart(lines []string, i int) bool {
+	if i+1 >= len(lines) || !strings.Contains(lines[i], "|") || indentOf(lines[i+1]) >= 4 {
+		return false
+	}
+
+	aligns, ok := tableAlignments(lines[i+1])
+	return ok && len(aligns) == len(splitTableRow(lines[i]))
+}
+
+func renderTable(b *strings.Builder, lines []string, i int) int {
+	header := splitTableRow(lines[i])
+	aligns, _ := tableAlignments(lines[i+1])
+
+	writeRow := func(cells []string, tag string) {
+		b.WriteString("<tr>\n")
+		for j, align := range aligns {
+			var cell string
+			if j < len(cells) {
+				cell = cells[j]
+			}
+
+			if align != "" {
+				b.WriteString("<" + tag + ` style="text-align:` + align + `">`)
+			} else {
+				b.WriteString("<" + tag + ">")
+			}
+			b.WriteString(renderInline(cell) + "</" + tag + ">\n")
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	b.WriteString("<table>\n<thead>\n")
+	writeRow(header, "th")
+	b.WriteString("</thead>\n")
+
+	i += 2
+	if i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i]) {
+		b.WriteString("<tbody>\n")
+		for ; i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i]); i++ {
+			writeRow(splitTableRow(lines[i]), "td")
+		}
+		b.WriteString("</tbody>\n")
+	}
+
+	b.WriteString("</table>\n")
+
+	return i
+}
@@ -0,0 +1,205 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type renderCase struct {
+	name string
+	src  string
+	want string
+}
+
+func runRenderCases(t *testing.T, cases []renderCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Render([]byte(tc.src)); got != tc.want {
+				t.Errorf("Render(%q)\n got: %q\nwant: %q", tc.src, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderUnsafeURLs(t *testing.T) {
+	runRenderCases(t, []renderCase{
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"mixed case scheme", "[x](JaVaScRiPt:alert(1))", "<p>x</p>\n"},
+		{"leading space", "[x]( javascript:alert(1))", "<p>x</p>\n"},
+		{"angle destination", "[x](<javascript:alert(1)>)", "<p>x</p>\n"},
+		{"control character in scheme", "[x](java\tscript:alert(1))", "<p>[x](java\tscript:alert(1))</p>\n"},
+		{"vbscript", "[x](vbscript:msgbox(1))", "<p>x</p>\n"},
+		{"file", "[x](file:///etc/passwd)", "<p>x</p>\n"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>\n"},
+		{"data image", "![x](data:image/png;base64,AAAA)", "<p>x</p>\n"},
+		{"javascript image", "![x](javascript:alert(1))", "<p>x</p>\n"},
+		{"emphasis kept in unsafe link", "[*a*](javascript:x)", "<p><em>a</em></p>\n"},
+		{"autolink with unsafe scheme", "<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>\n"},
+		{
+			"entity in scheme stays relative",
+			"[x](&#106;avascript:alert(1))",
+			`<p><a href="&amp;#106;avascript:alert(1)" rel="nofollow noopener">x</a></p>` + "\n",
+		},
+		{
+			"entity colon stays relative",
+			"[x](javascript&colon;alert(1))",
+			`<p><a href="javascript&amp;colon;alert(1)" rel="nofollow noopener">x</a></p>` + "\n",
+		},
+		{
+			"quote can't leave the attribute",
+			`[x](https://example.com/"onmouseover="alert(1))`,
+			`<p><a href="https://example.com/&#34;onmouseover=&#34;alert(1)" rel="nofollow noopener">x</a></p>` + "\n",
+		},
+		{
+			"quote in autolink",
+			`<https://example.com/"onmouseover="alert(1)>`,
+			`<p><a href="https://example.com/&#34;onmouseover=&#34;alert(1)" rel="nofollow noopener">https://example.com/&#34;onmouseover=&#34;alert(1)</a></p>` + "\n",
+		},
+		{
+			"safe schemes and relative links",
+			"[a](mailto:a@b.c) [b](#frag) [c](a:b/c) [d](./a:b)",
+			`<p><a href="mailto:a@b.c" rel="nofollow noopener">a</a> <a href="#frag" rel="nofollow noopener">b</a> c <a href="./a:b" rel="nofollow noopener">d</a></p>` + "\n",
+		},
+		{
+			"image attributes",
+			`![a *b* <c>](/x.png "t<")`,
+			`<p><img src="/x.png" alt="a b &lt;c&gt;" title="t&lt;" loading="lazy"></p>` + "\n",
+		},
+	})
+}
+
+func TestRenderRawHTML(t *testing.T) {
+	runRenderCases(t, []renderCase{
+		{"script", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"event handler", "<img src=x onerror=alert(1)>", "<p>&lt;img src=x onerror=alert(1)&gt;</p>\n"},
+		{"html block", "<div>\n*x*\n</div>", "<p>&lt;div&gt;\n<em>x</em>\n&lt;/div&gt;</p>\n"},
+		{"escaped bracket", `\<script>`, "<p>&lt;script&gt;</p>\n"},
+		{"code span", "`<b>`", "<p><code>&lt;b&gt;</code></p>\n"},
+		{"heading", "# <h1> *x*", "<h1>&lt;h1&gt; <em>x</em></h1>\n"},
+		{"blockquote", "> <script>\n> [x](vbscript:y)", "<blockquote>\n<p>&lt;script&gt;\nx</p>\n</blockquote>\n"},
+		{"list", "- <b>\n- [x](file:///etc/passwd)", "<ul>\n<li>&lt;b&gt;\n</li>\n<li>x\n</li>\n</ul>\n"},
+		{
+			"fenced code closing tags",
+			"```\n</code></pre><script>\n```",
+			"<pre><code>&lt;/code&gt;&lt;/pre&gt;&lt;script&gt;\n</code></pre>\n",
+		},
+		{
+			"fence info string",
+			"```js\"><script>\ncode\n```",
+			`<pre><code class="language-js&#34;&gt;&lt;script&gt;">code` + "\n</code></pre>\n",
+		},
+		{
+			"table",
+			"| a | <b> |\n|---|---|\n| [x](javascript:y) | `<i>` |",
+			"<table>\n<thead>\n<tr>\n<th>a</th>\n<th>&lt;b&gt;</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td>x</td>\n<td><code>&lt;i&gt;</code></td>\n</tr>\n</tbody>\n</table>\n",
+		},
+	})
+}
+
+func TestRenderEntities(t *testing.T) {
+	runRenderCases(t, []renderCase{
+		{"named", "&lt;script&gt;", "<p>&lt;script&gt;</p>\n"},
+		{"double escaped", "&amp;lt;script&amp;gt;", "<p>&amp;lt;script&amp;gt;</p>\n"},
+		{"decimal", "&#60;script&#62;", "<p>&#60;script&#62;</p>\n"},
+		{"hex", "&#x3C;script&#x3E;", "<p>&#x3C;script&#x3E;</p>\n"},
+		{"unknown name", "&unknown;", "<p>&amp;unknown;</p>\n"},
+		{"unterminated", "&lt script", "<p>&amp;lt script</p>\n"},
+		{"bare ampersand", "a & b", "<p>a &amp; b</p>\n"},
+	})
+}
+
+func TestRenderEmphasisAndLinks(t *testing.T) {
+	runRenderCases(t, []renderCase{
+		{"strong in emphasis", "*a **b** c*", "<p><em>a <strong>b</strong> c</em></p>\n"},
+		{"emphasis in strong", "**a *b* c**", "<p><strong>a <em>b</em> c</strong></p>\n"},
+		{"both", "***a***", "<p><em><strong>a</strong></em></p>\n"},
+		{"strong closed first", "***a** b*", "<p><em><strong>a</strong> b</em></p>\n"},
+		{"emphasis closed first", "***a* b**", "<p><strong><em>a</em> b</strong></p>\n"},
+		{"unclosed", "**a", "<p>**a</p>\n"},
+		{"intraword underscore", "snake_case_name", "<p>snake_case_name</p>\n"},
+		{"strikethrough", "~~a~~", "<p><del>a</del></p>\n"},
+		{"strong link text", "[**a**](/x)", `<p><a href="/x" rel="nofollow noopener"><strong>a</strong></a></p>` + "\n"},
+		{"link in emphasis", "*a [b](/c) d*", `<p><em>a <a href="/c" rel="nofollow noopener">b</a> d</em></p>` + "\n"},
+		{"link before emphasis", "*a [b*](/c)", `<p>*a <a href="/c" rel="nofollow noopener">b*</a></p>` + "\n"},
+		{"nested links", "[a [b](/c) d](/e)", `<p>[a <a href="/c" rel="nofollow noopener">b</a> d](/e)</p>` + "\n"},
+		{
+			"autolink in link",
+			"[a <https://b.c>](/e)",
+			`<p>[a <a href="https://b.c" rel="nofollow noopener">https://b.c</a>](/e)</p>` + "\n",
+		},
+		{
+			"image in link",
+			"[![a](/i.png)](/e)",
+			`<p><a href="/e" rel="nofollow noopener"><img src="/i.png" alt="a" loading="lazy"></a></p>` + "\n",
+		},
+		{"brackets without destination", "[a] [b]", "<p>[a] [b]</p>\n"},
+	})
+}
+
+var (
+	tagRe  = regexp.MustCompile(`^</?([a-z0-9]+)((?: [a-z-]+="[^"<>]*")*)>`)
+	attrRe = regexp.MustCompile(` ([a-z-]+)="([^"]*)"`)
+)
+
+// allowedTags are all the tags Render produces
+var allowedTags = map[string]bool{
+	"p": true, "br": true, "hr": true, "em": true, "strong": true, "del": true, "code": true, "pre": true,
+	"a": true, "img": true, "blockquote": true, "ul": true, "ol": true, "li": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"table": true, "thead": true, "tbody": true, "tr": true, "th": true, "td": true,
+}
+
+// checkSafeHTML fails if the output has a tag or attribute Render doesn't produce itself,
+// or a link to a scheme other than the safe ones.
+func checkSafeHTML(t *testing.T, src, out string) {
+	t.Helper()
+
+	for i := strings.IndexByte(out, '<'); i >= 0; i = strings.IndexByte(out, '<') {
+		out = out[i:]
+
+		m := tagRe.FindStringSubmatch(out)
+		if m == nil || !allowedTags[m[1]] {
+			t.Fatalf("Render(%q): unexpected markup at %q", src, out)
+		}
+
+		for _, a := range attrRe.FindAllStringSubmatch(m[2], -1) {
+			switch a[1] {
+			case "href", "src":
+				u := strings.ToLower(html.UnescapeString(a[2]))
+				if colon := strings.IndexByte(u, ':'); colon >= 0 && !strings.ContainsAny(u[:colon], "/?#") && !safeSchemes[u[:colon]] {
+					t.Fatalf("Render(%q): unsafe url %q", src, a[2])
+				}
+			case "title", "alt", "class", "rel", "loading", "start", "align":
+			default:
+				t.Fatalf("Render(%q): unexpected attribute %q", src, a[1])
+			}
+		}
+
+		out = out[len(m[0]):]
+	}
+}
+
+func FuzzRender(f *testing.F) {
+	for _, src := range []string{
+		"[x](javascript:alert(1))",
+		"![x](data:image/svg+xml,<svg onload=alert(1)>)",
+		"<a href=\"javascript:alert(1)\">x</a>",
+		"<img src=x onerror=alert(1)>",
+		"[a [b](/c) d](/e) *a [b*](/c) ***a** b*",
+		"&#106;avascript: &lt;script&gt; &#x3C;",
+		"```\"><script>\n</code>\n```",
+		"| <b> | `<i>` |\n|---|---|\n| [x](vbscript:y) | <https://a\"b> |",
+		"> - # <h1> [*x*](<javascript:y> \"t\")",
+		"1. a\n2. <user@example.com\"onclick=x>",
+	} {
+		f.Add(src)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		checkSafeHTML(t, src, Render([]byte(src)))
+	})
+}
@@ -1,13 +1,91 @@
 package v1
 
 type PathInfo struct {
-	IsValid    bool   `json:"is_valid"`
+	BagID       string `json:"bag_id"`
+	CommonPath  string `json:"common_path"`
+	Description string `json:"description"`
+	TotalSize   uint64 `json:"total_size"`
+	FilesCount  int    `json:"files_count"`
+	PeersCount  int    `json:"peers_count"`
+	Files       []File `json:"files"`
+	// Entries matching the filter on all pages
+	EntriesCount int `json:"entries_count"`
+	// Page and PerPage are set if the listing is paginated
+	Page    int `json:"page,omitempty"`
+	PerPage int `json:"per_page,omitempty"`
+}
+
+type SearchResult struct {
+	BagID      string `json:"bag_id"`
 	CommonPath string `json:"common_path"`
-	Files      []File `json:"files"`
+	Query      string `json:"query"`
+	// Files names are base names, paths are relative to the bag root
+	Files        []File `json:"files"`
+	EntriesCount int    `json:"entries_count"`
+	Page         int    `json:"page"`
+	PerPage      int    `json:"per_page"`
+	// Truncated is set if matching stopped at the results limit
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Manifest is the complete file inventory of a bag
+type Manifest struct {
+	BagID       string `json:"bag_id"`
+	Description string `json:"description"`
+	MerkleHash  string `json:"merkle_hash"`
+	PieceSize   uint32 `json:"piece_size"`
+	PiecesCount uint32 `json:"pieces_count"`
+	// BagSize includes the torrent header, TotalSize is the size of the files only
+	BagSize    uint64         `json:"bag_size"`
+	TotalSize  uint64         `json:"total_size"`
+	FilesCount int            `json:"files_count"`
+	Files      []ManifestFile `json:"files,omitempty"`
+}
+
+// ManifestFile is a file of the bag with the pieces it's stored in, ToPieceOffset is exclusive
+type ManifestFile struct {
+	Index           uint32 `json:"index"`
+	Path            string `json:"path"`
+	Size            uint64 `json:"size"`
+	FromPiece       uint32 `json:"from_piece"`
+	ToPiece         uint32 `json:"to_piece"`
+	FromPieceOffset uint32 `json:"from_piece_offset"`
+	ToPieceOffset   uint32 `json:"to_piece_offset"`
+}
+
+// FileProof lets clients verify the bytes of a file served by the gateway against the bag merkle hash
+type FileProof struct {
+	BagID       string       `json:"bag_id"`
+	MerkleHash  string       `json:"merkle_hash"`
+	PieceSize   uint32       `json:"piece_size"`
+	PiecesCount uint32       `json:"pieces_count"`
+	File        ManifestFile `json:"file"`
+	// Start and End are the inclusive byte range of the file covered by the pieces
+	Start  uint64       `json:"start"`
+	End    uint64       `json:"end"`
+	Pieces []PieceProof `json:"pieces"`
+}
+
+// PieceProof is a piece covering a part of the requested bytes. The piece data is Head, then Length
+// bytes of the file from FileOffset, then Tail, its sha256 is Hash. Proof is the serialized merkle proof
+// cell of the piece hash against the bag merkle hash.
+type PieceProof struct {
+	Index      uint32 `json:"index"`
+	Hash       string `json:"hash"`
+	Proof      []byte `json:"proof"`
+	FileOffset uint64 `json:"file_offset"`
+	Length     uint64 `json:"length"`
+	Head       []byte `json:"head,omitempty"`
+	Tail       []byte `json:"tail,omitempty"`
+	// Incomplete is set if Head or Tail include the torrent header, which the gateway can't read
+	// for bags of the local daemon, such a piece can't be verified
+	Incomplete bool `json:"incomplete,omitempty"`
 }
 
 type File struct {
+	Index    uint32 `json:"-"`
 	Name     string `json:"name"`
+	Path     string `json:"path,omitempty"`
 	Size     uint64 `json:"size"`
 	IsFolder bool   `json:"is_folder,omitempty"`
 }
@@ -18,6 +96,8 @@ type Report struct {
 	Sender    string `json:"sender"`
 	Comment   string `json:"comment"`
 	CreatedAt uint64 `json:"created_at"`
+	// SenderIP is set by the server from the request, it's never read from the body
+	SenderIP string `json:"-"`
 }
 
 type BanInfo struct {
@@ -34,3 +114,76 @@ type BanStatus struct {
 	Comment string `json:"comment"`
 	Status  bool   `json:"status"`
 }
+
+type Alias struct {
+	Slug      string `json:"slug"`
+	BagID     string `json:"bag_id"`
+	Path      string `json:"path"`
+	Admin     string `json:"admin"`
+	Comment   string `json:"comment"`
+	CreatedAt uint64 `json:"created_at,omitempty"`
+	UpdatedAt uint64 `json:"updated_at,omitempty"`
+	// History lists the previous targets, newest first
+	History []AliasTarget `json:"history,omitempty"`
+}
+
+type AliasTarget struct {
+	BagID      string `json:"bag_id"`
+	Path       string `json:"path"`
+	Admin      string `json:"admin"`
+	Comment    string `json:"comment"`
+	SetAt      uint64 `json:"set_at"`
+	ReplacedAt uint64 `json:"replaced_at"`
+}
+
+// Pin is a bag on the local TON Storage daemon
+type Pin struct {
+	BagID       string `json:"bag_id"`
+	Description string `json:"description"`
+	Size        uint64 `json:"size"`
+	Downloaded  uint64 `json:"downloaded"`
+	// Progress is the downloaded share of Size in percents
+	Progress      float64 `json:"progress"`
+	Completed     bool    `json:"completed"`
+	FilesCount    uint64  `json:"files_count"`
+	PeersCount    uint64  `json:"peers_count"`
+	DownloadSpeed uint64  `json:"download_speed"`
+	UploadSpeed   uint64  `json:"upload_speed"`
+	HeaderLoaded  bool    `json:"header_loaded"`
+	InfoLoaded    bool    `json:"info_loaded"`
+	Active        bool    `json:"active"`
+	Seeding       bool    `json:"seeding"`
+}
+
+type PinRequest struct {
+	BagID string `json:"bag_id"`
+	// DownloadAll downloads all files at once, otherwise files are fetched on demand
+	DownloadAll bool `json:"download_all"`
+}
+
+// UploadSession collects files of a new bag, files can be uploaded in chunks and resumed
+type UploadSession struct {
+	ID          string       `json:"id"`
+	Description string       `json:"description"`
+	Files       []UploadFile `json:"files"`
+	// Size is the declared size of all files, Received is the number of bytes staged so far
+	Size      uint64 `json:"size"`
+	Received  uint64 `json:"received"`
+	CreatedAt uint64 `json:"created_at"`
+	UpdatedAt uint64 `json:"updated_at"`
+	// ExpiresAt is when the session is removed unless more data is uploaded
+	ExpiresAt uint64 `json:"expires_at"`
+}
+
+type UploadFile struct {
+	Path     string `json:"path"`
+	Size     uint64 `json:"size"`
+	Received uint64 `json:"received"`
+}
+
+type UploadResult struct {
+	BagID      string `json:"bag_id"`
+	Size       uint64 `json:"size"`
+	FilesCount int    `json:"files_count"`
+	URL        string `json:"url"`
+}
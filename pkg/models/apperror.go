@@ -12,6 +12,8 @@ const (
 	InternalServerErrorCode = http.StatusInternalServerError
 	BadRequestErrorCode     = http.StatusBadRequest
 	NotAcceptableErrorCode  = http.StatusNotAcceptable
+	TooManyRequestsCode     = http.StatusTooManyRequests
+	ConflictCode            = http.StatusConflict
 )
 
 var defaultMessages = map[int]string{
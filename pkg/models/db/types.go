@@ -6,6 +6,7 @@ type Report struct {
 	BagID     string     `json:"bag_id"`
 	Reason    string     `json:"reason"`
 	Sender    string     `json:"sender"`
+	SenderIP  string     `json:"-"`
 	Comment   string     `json:"comment"`
 	CreatedAt *time.Time `json:"created_at,omitempty"`
 }
@@ -18,3 +19,57 @@ type BanStatus struct {
 	Status    bool       `json:"status"`
 	CreatedAt *time.Time `json:"created_at,omitempty"`
 }
+
+// BandwidthUsage is the number of bytes served to a subject (client IP or bag) within a time window.
+type BandwidthUsage struct {
+	SubjectType string    `json:"subject_type"`
+	Subject     string    `json:"subject"`
+	WindowStart time.Time `json:"window_start"`
+	Bytes       uint64    `json:"bytes"`
+}
+
+// BandwidthTotal is the number of bytes served to a subject since the hourly and daily cutoffs.
+type BandwidthTotal struct {
+	SubjectType string `json:"subject_type"`
+	Subject     string `json:"subject"`
+	Hourly      uint64 `json:"hourly"`
+	Daily       uint64 `json:"daily"`
+}
+
+// Alias maps a slug to a bag ID and an optional path inside the bag.
+type Alias struct {
+	Slug      string     `json:"slug"`
+	BagID     string     `json:"bag_id"`
+	Path      string     `json:"path"`
+	Admin     string     `json:"admin"`
+	Comment   string     `json:"comment"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// AliasTarget is a previous target of an alias, SetAt is when it was set and ReplacedAt when it was replaced or deleted.
+type AliasTarget struct {
+	BagID      string     `json:"bag_id"`
+	Path       string     `json:"path"`
+	Admin      string     `json:"admin"`
+	Comment    string     `json:"comment"`
+	SetAt      *time.Time `json:"set_at,omitempty"`
+	ReplacedAt *time.Time `json:"replaced_at,omitempty"`
+}
+
+// PromotedBag is a remote bag downloaded to the local daemon by the promotion policy.
+type PromotedBag struct {
+	BagID      string    `json:"bag_id"`
+	Size       uint64    `json:"size"`
+	PromotedAt time.Time `json:"promoted_at"`
+}
+
+// Upload is a bag created from files uploaded with the access token of TokenHash.
+type Upload struct {
+	BagID       string    `json:"bag_id"`
+	TokenHash   string    `json:"token_hash"`
+	Size        uint64    `json:"size"`
+	FilesCount  int       `json:"files_count"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
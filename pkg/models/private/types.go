@@ -7,6 +7,7 @@ import (
 )
 
 type FolderInfo struct {
+	// StreamFile describes a remote file, its FileStream is opened separately
 	StreamFile     *StreamFile
 	Files          []v1.File
 	TotalSize      uint64
@@ -17,8 +18,23 @@ type FolderInfo struct {
 	SingleFilePath string
 }
 
+// FileTree is a flat recursive list of files, names are relative to the bag root
+type FileTree struct {
+	BagID string
+	// LocalRoot is set when the bag is served by the local daemon
+	LocalRoot string
+	Files     []v1.File
+	TotalSize uint64
+}
+
 type StreamFile struct {
 	FileStream io.ReadCloser
 	Size       uint64
 	PeersCount int
 }
+
+// ByteRange is an inclusive range of bytes within a file.
+type ByteRange struct {
+	Start uint64
+	End   uint64
+}
@@ -74,6 +74,58 @@ func (c *cacheMiddleware) UpdateBanStatus(ctx context.Context, statuses []db.Ban
 	return
 }
 
+func (c *cacheMiddleware) AddBandwidthUsage(ctx context.Context, usage []db.BandwidthUsage, hourSince, daySince time.Time) (totals []db.BandwidthTotal, err error) {
+	return c.repo.AddBandwidthUsage(ctx, usage, hourSince, daySince)
+}
+
+func (c *cacheMiddleware) DeleteBandwidthUsage(ctx context.Context, before time.Time) (err error) {
+	return c.repo.DeleteBandwidthUsage(ctx, before)
+}
+
+func (c *cacheMiddleware) GetAlias(ctx context.Context, slug string) (*db.Alias, error) {
+	return c.repo.GetAlias(ctx, slug)
+}
+
+func (c *cacheMiddleware) GetAllAliases(ctx context.Context, limit int, offset int) ([]db.Alias, error) {
+	return c.repo.GetAllAliases(ctx, limit, offset)
+}
+
+func (c *cacheMiddleware) GetAliasHistory(ctx context.Context, slug string) ([]db.AliasTarget, error) {
+	return c.repo.GetAliasHistory(ctx, slug)
+}
+
+func (c *cacheMiddleware) SetAlias(ctx context.Context, alias db.Alias) error {
+	return c.repo.SetAlias(ctx, alias)
+}
+
+func (c *cacheMiddleware) DeleteAlias(ctx context.Context, slug string) (bool, error) {
+	return c.repo.DeleteAlias(ctx, slug)
+}
+
+func (c *cacheMiddleware) GetPromotedBags(ctx context.Context) ([]db.PromotedBag, error) {
+	return c.repo.GetPromotedBags(ctx)
+}
+
+func (c *cacheMiddleware) AddPromotedBag(ctx context.Context, bag db.PromotedBag) error {
+	return c.repo.AddPromotedBag(ctx, bag)
+}
+
+func (c *cacheMiddleware) IsPromotedBag(ctx context.Context, bagID string) (bool, error) {
+	return c.repo.IsPromotedBag(ctx, bagID)
+}
+
+func (c *cacheMiddleware) DeletePromotedBag(ctx context.Context, bagID string) error {
+	return c.repo.DeletePromotedBag(ctx, bagID)
+}
+
+func (c *cacheMiddleware) AddUpload(ctx context.Context, upload db.Upload) error {
+	return c.repo.AddUpload(ctx, upload)
+}
+
+func (c *cacheMiddleware) GetUploadedBytes(ctx context.Context, tokenHash string) (uint64, error) {
+	return c.repo.GetUploadedBytes(ctx, tokenHash)
+}
+
 func NewCache(repo Repository) Repository {
 	return &cacheMiddleware{
 		repo:  repo,
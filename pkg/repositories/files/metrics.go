@@ -94,6 +94,149 @@ func (m *metricsMiddleware) UpdateBanStatus(ctx context.Context, statuses []db.B
 	return m.repo.UpdateBanStatus(ctx, statuses)
 }
 
+func (m *metricsMiddleware) AddBandwidthUsage(ctx context.Context, usage []db.BandwidthUsage, hourSince, daySince time.Time) (totals []db.BandwidthTotal, err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"AddBandwidthUsage", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.AddBandwidthUsage(ctx, usage, hourSince, daySince)
+}
+
+func (m *metricsMiddleware) DeleteBandwidthUsage(ctx context.Context, before time.Time) (err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"DeleteBandwidthUsage", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.DeleteBandwidthUsage(ctx, before)
+}
+
+func (m *metricsMiddleware) GetAlias(ctx context.Context, slug string) (alias *db.Alias, err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"GetAlias", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.GetAlias(ctx, slug)
+}
+
+func (m *metricsMiddleware) GetAllAliases(ctx context.Context, limit int, offset int) (aliases []db.Alias, err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"GetAllAliases", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.GetAllAliases(ctx, limit, offset)
+}
+
+func (m *metricsMiddleware) GetAliasHistory(ctx context.Context, slug string) (history []db.AliasTarget, err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"GetAliasHistory", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.GetAliasHistory(ctx, slug)
+}
+
+func (m *metricsMiddleware) SetAlias(ctx context.Context, alias db.Alias) (err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"SetAlias", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.SetAlias(ctx, alias)
+}
+
+func (m *metricsMiddleware) DeleteAlias(ctx context.Context, slug string) (deleted bool, err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"DeleteAlias", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.DeleteAlias(ctx, slug)
+}
+
+func (m *metricsMiddleware) GetPromotedBags(ctx context.Context) (bags []db.PromotedBag, err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"GetPromotedBags", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.GetPromotedBags(ctx)
+}
+
+func (m *metricsMiddleware) AddPromotedBag(ctx context.Context, bag db.PromotedBag) (err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"AddPromotedBag", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.AddPromotedBag(ctx, bag)
+}
+
+func (m *metricsMiddleware) IsPromotedBag(ctx context.Context, bagID string) (promoted bool, err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"IsPromotedBag", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.IsPromotedBag(ctx, bagID)
+}
+
+func (m *metricsMiddleware) DeletePromotedBag(ctx context.Context, bagID string) (err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"DeletePromotedBag", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.DeletePromotedBag(ctx, bagID)
+}
+
+func (m *metricsMiddleware) AddUpload(ctx context.Context, upload db.Upload) (err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"AddUpload", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.AddUpload(ctx, upload)
+}
+
+func (m *metricsMiddleware) GetUploadedBytes(ctx context.Context, tokenHash string) (size uint64, err error) {
+	m.inFlightGauge.Inc()
+	defer func(s time.Time) {
+		labels := []string{"GetUploadedBytes", strconv.FormatBool(err != nil)}
+		m.reqCount.WithLabelValues(labels...).Inc()
+		m.reqDuration.WithLabelValues(labels...).Observe(time.Since(s).Seconds())
+		m.inFlightGauge.Dec()
+	}(time.Now())
+	return m.repo.GetUploadedBytes(ctx, tokenHash)
+}
+
 func NewMetrics(reqCount *prometheus.CounterVec, reqDuration *prometheus.HistogramVec, inFlight prometheus.Gauge, repo Repository) Repository {
 	return &metricsMiddleware{
 		reqCount:      reqCount,
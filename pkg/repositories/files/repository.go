@@ -2,6 +2,7 @@ package files
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -21,6 +22,19 @@ type Repository interface {
 	GetReportsByBagID(ctx context.Context, bagID string) ([]db.Report, error)
 	AddReport(ctx context.Context, report db.Report) error
 	UpdateBanStatus(ctx context.Context, statuses []db.BanStatus) error
+	AddBandwidthUsage(ctx context.Context, usage []db.BandwidthUsage, hourSince, daySince time.Time) ([]db.BandwidthTotal, error)
+	DeleteBandwidthUsage(ctx context.Context, before time.Time) error
+	GetAlias(ctx context.Context, slug string) (*db.Alias, error)
+	GetAllAliases(ctx context.Context, limit int, offset int) ([]db.Alias, error)
+	GetAliasHistory(ctx context.Context, slug string) ([]db.AliasTarget, error)
+	SetAlias(ctx context.Context, alias db.Alias) error
+	DeleteAlias(ctx context.Context, slug string) (bool, error)
+	GetPromotedBags(ctx context.Context) ([]db.PromotedBag, error)
+	AddPromotedBag(ctx context.Context, bag db.PromotedBag) error
+	IsPromotedBag(ctx context.Context, bagID string) (bool, error)
+	DeletePromotedBag(ctx context.Context, bagID string) error
+	AddUpload(ctx context.Context, upload db.Upload) error
+	GetUploadedBytes(ctx context.Context, tokenHash string) (uint64, error)
 }
 
 func (r *repository) HasBan(ctx context.Context, bagID string) (bool, error) {
@@ -144,9 +158,9 @@ func (r *repository) GetReportsByBagID(ctx context.Context, bagID string) (repor
 
 func (r *repository) AddReport(ctx context.Context, report db.Report) (err error) {
 	query := `
-		INSERT INTO files.reports (bagid, reason, sender, comment)
-		VALUES ($1, $2, $3, $4)`
-	_, err = r.db.Exec(ctx, query, report.BagID, report.Reason, report.Sender, report.Comment)
+		INSERT INTO files.reports (bagid, reason, sender, sender_ip, comment)
+		VALUES ($1, $2, $3, NULLIF($4, '')::inet, $5)`
+	_, err = r.db.Exec(ctx, query, report.BagID, report.Reason, report.Sender, report.SenderIP, report.Comment)
 	return
 }
 
@@ -181,6 +195,272 @@ func (r *repository) UpdateBanStatus(ctx context.Context, statuses []db.BanStatu
 	return
 }
 
+// AddBandwidthUsage adds bytes to the counters of the windows, creating missing ones, and returns
+// the totals of the subjects since hourSince and daySince including the added bytes.
+// Counters are incremented in place, so concurrent gateway instances never lose each other's bytes.
+func (r *repository) AddBandwidthUsage(ctx context.Context, usage []db.BandwidthUsage, hourSince, daySince time.Time) (totals []db.BandwidthTotal, err error) {
+	// Earlier windows are read from the table, the current ones from the upsert result
+	query := `
+		WITH added AS (
+			INSERT INTO files.bandwidth_usage AS u (subject_type, subject, window_start, bytes)
+			SELECT
+				c->> 'subject_type',
+				c->> 'subject',
+				(c->> 'window_start')::timestamptz,
+				(c->> 'bytes')::bigint
+			FROM jsonb_array_elements($1::jsonb) AS c
+			ON CONFLICT (subject_type, subject, window_start) DO UPDATE
+			SET bytes = u.bytes + EXCLUDED.bytes
+			RETURNING subject_type, subject, window_start, bytes
+		)
+		SELECT
+			a.subject_type,
+			a.subject,
+			(a.bytes + COALESCE(SUM(u.bytes) FILTER (WHERE u.window_start >= $2), 0))::bigint,
+			(a.bytes + COALESCE(SUM(u.bytes), 0))::bigint
+		FROM added a
+		LEFT JOIN files.bandwidth_usage u
+			ON u.subject_type = a.subject_type
+			AND u.subject = a.subject
+			AND u.window_start >= $3
+			AND u.window_start < a.window_start
+		GROUP BY a.subject_type, a.subject, a.bytes`
+
+	rows, err := r.db.Query(ctx, query, usage, hourSince, daySince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t db.BandwidthTotal
+		if err := rows.Scan(&t.SubjectType, &t.Subject, &t.Hourly, &t.Daily); err != nil {
+			return nil, err
+		}
+
+		totals = append(totals, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func (r *repository) DeleteBandwidthUsage(ctx context.Context, before time.Time) (err error) {
+	query := `DELETE FROM files.bandwidth_usage WHERE window_start < $1`
+	_, err = r.db.Exec(ctx, query, before)
+	return
+}
+
+func (r *repository) GetAlias(ctx context.Context, slug string) (*db.Alias, error) {
+	query := `
+		SELECT slug, bagid, path, admin, comment, created_at, updated_at
+		FROM files.aliases
+		WHERE slug = $1`
+
+	var a db.Alias
+	err := r.db.QueryRow(ctx, query, slug).Scan(&a.Slug, &a.BagID, &a.Path, &a.Admin, &a.Comment, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (r *repository) GetAllAliases(ctx context.Context, limit int, offset int) (aliases []db.Alias, err error) {
+	query := `
+		SELECT slug, bagid, path, admin, comment, created_at, updated_at
+		FROM files.aliases
+		ORDER BY slug
+		LIMIT $1
+		OFFSET $2`
+
+	rows, err := r.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a db.Alias
+		if err := rows.Scan(&a.Slug, &a.BagID, &a.Path, &a.Admin, &a.Comment, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		aliases = append(aliases, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func (r *repository) GetAliasHistory(ctx context.Context, slug string) (history []db.AliasTarget, err error) {
+	query := `
+		SELECT bagid, path, admin, comment, set_at, replaced_at
+		FROM files.aliases_history
+		WHERE slug = $1
+		ORDER BY replaced_at DESC`
+
+	rows, err := r.db.Query(ctx, query, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t db.AliasTarget
+		if err := rows.Scan(&t.BagID, &t.Path, &t.Admin, &t.Comment, &t.SetAt, &t.ReplacedAt); err != nil {
+			return nil, err
+		}
+
+		history = append(history, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// SetAlias creates or repoints the alias, the previous target is moved to the history if it changes.
+func (r *repository) SetAlias(ctx context.Context, alias db.Alias) (err error) {
+	query := `
+		WITH old AS (
+			SELECT slug, bagid, path, admin, comment, updated_at
+			FROM files.aliases
+			WHERE slug = $1
+			FOR UPDATE
+		),
+		history AS (
+			INSERT INTO files.aliases_history (slug, bagid, path, admin, comment, set_at)
+			SELECT slug, bagid, path, admin, comment, updated_at
+			FROM old
+			WHERE old.bagid <> $2 OR old.path <> $3
+		)
+		INSERT INTO files.aliases (slug, bagid, path, admin, comment)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (slug) DO UPDATE
+		SET
+			bagid = EXCLUDED.bagid,
+			path = EXCLUDED.path,
+			admin = EXCLUDED.admin,
+			comment = EXCLUDED.comment,
+			updated_at = NOW()
+	`
+
+	_, err = r.db.Exec(ctx, query, alias.Slug, alias.BagID, alias.Path, alias.Admin, alias.Comment)
+
+	return
+}
+
+// DeleteAlias deletes the alias, its last target is kept in the history.
+func (r *repository) DeleteAlias(ctx context.Context, slug string) (bool, error) {
+	query := `
+		WITH deleted AS (
+			DELETE FROM files.aliases
+			WHERE slug = $1
+			RETURNING slug, bagid, path, admin, comment, updated_at
+		)
+		INSERT INTO files.aliases_history (slug, bagid, path, admin, comment, set_at)
+		SELECT slug, bagid, path, admin, comment, updated_at
+		FROM deleted
+	`
+
+	tag, err := r.db.Exec(ctx, query, slug)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *repository) GetPromotedBags(ctx context.Context) (bags []db.PromotedBag, err error) {
+	query := `
+		SELECT bagid, size, promoted_at
+		FROM files.promoted_bags
+		ORDER BY promoted_at`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b db.PromotedBag
+		if err := rows.Scan(&b.BagID, &b.Size, &b.PromotedAt); err != nil {
+			return nil, err
+		}
+
+		bags = append(bags, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func (r *repository) AddPromotedBag(ctx context.Context, bag db.PromotedBag) (err error) {
+	query := `
+		INSERT INTO files.promoted_bags (bagid, size)
+		VALUES ($1, $2)
+		ON CONFLICT (bagid) DO UPDATE
+		SET size = EXCLUDED.size`
+
+	_, err = r.db.Exec(ctx, query, bag.BagID, bag.Size)
+
+	return
+}
+
+func (r *repository) IsPromotedBag(ctx context.Context, bagID string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM files.promoted_bags WHERE bagid = $1)`
+	var exists bool
+	err := r.db.QueryRow(ctx, query, bagID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *repository) DeletePromotedBag(ctx context.Context, bagID string) (err error) {
+	query := `DELETE FROM files.promoted_bags WHERE bagid = $1`
+	_, err = r.db.Exec(ctx, query, bagID)
+
+	return
+}
+
+func (r *repository) AddUpload(ctx context.Context, upload db.Upload) (err error) {
+	query := `
+		INSERT INTO files.uploads (bagid, token_hash, size, files_count, description)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (bagid) DO NOTHING`
+
+	_, err = r.db.Exec(ctx, query, upload.BagID, upload.TokenHash, upload.Size, upload.FilesCount, upload.Description)
+
+	return
+}
+
+// GetUploadedBytes returns the total size of bags created with the token.
+func (r *repository) GetUploadedBytes(ctx context.Context, tokenHash string) (size uint64, err error) {
+	query := `SELECT COALESCE(SUM(size), 0) FROM files.uploads WHERE token_hash = $1`
+	err = r.db.QueryRow(ctx, query, tokenHash).Scan(&size)
+
+	return
+}
+
 func NewRepository(db *pgxpool.Pool) Repository {
 	return &repository{
 		db: db,
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// retryInterval is how long the secondary counter is used alone after the primary one fails
+const retryInterval = 30 * time.Second
+
+// fallback uses the primary counter and switches to the secondary one when it fails,
+// so the limiter keeps working, although per instance, while the database is unavailable.
+// The primary counter is retried after retryInterval, not on every request.
+type fallback struct {
+	primary   Counter
+	secondary Counter
+	logger    *slog.Logger
+
+	mu        sync.Mutex
+	downUntil time.Time
+	down      bool
+}
+
+func (s *fallback) Hit(ctx context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	// Counted in both, so the fallback has recent state when it's needed
+	hits, reset, err := s.secondary.Hit(ctx, key, window)
+
+	if !s.primaryUp() {
+		return hits, reset, err
+	}
+
+	primaryHits, primaryReset, primaryErr := s.primary.Hit(ctx, key, window)
+	if primaryErr != nil {
+		s.trip(primaryErr)
+		return hits, reset, err
+	}
+
+	s.primaryAnswered()
+	return primaryHits, primaryReset, nil
+}
+
+func (s *fallback) Close() error {
+	_ = s.secondary.Close()
+	return s.primary.Close()
+}
+
+func (s *fallback) primaryUp() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.down || time.Now().After(s.downUntil)
+}
+
+// trip switches to the secondary counter for retryInterval, the failure is logged once per switch.
+func (s *fallback) trip(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.down && now.Before(s.downUntil) {
+		return
+	}
+
+	if !s.down {
+		s.logger.Warn("rate limit storage failed, using in-memory fallback",
+			slog.String("error", err.Error()),
+			slog.Duration("retry_interval", retryInterval))
+	}
+
+	s.down = true
+	s.downUntil = now.Add(retryInterval)
+}
+
+// primaryAnswered switches back to the primary counter after it has answered again.
+func (s *fallback) primaryAnswered() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down {
+		s.down = false
+		s.logger.Info("rate limit storage recovered")
+	}
+}
+
+func NewFallback(primary, secondary Counter, logger *slog.Logger) Counter {
+	return &fallback{
+		primary:   primary,
+		secondary: secondary,
+		logger:    logger,
+	}
+}
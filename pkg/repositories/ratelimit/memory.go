@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	hits      int
+	expiresAt time.Time
+}
+
+// memory is a process local Counter.
+type memory struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	done    chan struct{}
+}
+
+func (s *memory) Hit(_ context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		e = memoryEntry{expiresAt: now.Add(window)}
+	}
+
+	e.hits++
+	s.entries[key] = e
+
+	return e.hits, e.expiresAt.Sub(now), nil
+}
+
+func (s *memory) Close() error {
+	close(s.done)
+	return nil
+}
+
+func (s *memory) gc() {
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, e := range s.entries {
+				if !now.Before(e.expiresAt) {
+					delete(s.entries, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func NewMemory() Counter {
+	s := &memory{
+		entries: make(map[string]memoryEntry),
+		done:    make(chan struct{}),
+	}
+
+	go s.gc()
+
+	return s
+}
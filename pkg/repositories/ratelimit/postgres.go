@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// Every limited request waits for the query, so slow queries must fail fast
+	queryTimeout = 200 * time.Millisecond
+	gcInterval   = time.Minute
+)
+
+// Counter counts requests per key within fixed windows.
+type Counter interface {
+	// Hit counts a request of key and returns the number of requests in the current window
+	// including this one and the time left until the window resets.
+	Hit(ctx context.Context, key string, window time.Duration) (int, time.Duration, error)
+	Close() error
+}
+
+// postgres is a Counter shared by all gateway instances connected to the database.
+type postgres struct {
+	db   *pgxpool.Pool
+	done chan struct{}
+}
+
+// Hit increments the counter in one statement, so concurrent instances never lose each other's hits.
+func (s *postgres) Hit(ctx context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO files.rate_limits AS r (key, hits, expires_at)
+		VALUES ($1, 1, now() + make_interval(secs => $2))
+		ON CONFLICT (key) DO UPDATE
+		SET
+			hits = CASE WHEN r.expires_at > now() THEN r.hits + 1 ELSE 1 END,
+			expires_at = CASE WHEN r.expires_at > now() THEN r.expires_at ELSE EXCLUDED.expires_at END
+		RETURNING hits, EXTRACT(EPOCH FROM r.expires_at - now())::float8`
+
+	var (
+		hits  int
+		reset float64
+	)
+	if err := s.db.QueryRow(ctx, query, key, window.Seconds()).Scan(&hits, &reset); err != nil {
+		return 0, 0, err
+	}
+
+	return hits, time.Duration(reset * float64(time.Second)), nil
+}
+
+// Close stops the expired counters cleanup, the pool is owned by the caller.
+func (s *postgres) Close() error {
+	close(s.done)
+	return nil
+}
+
+func (s *postgres) gc() {
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			_, _ = s.db.Exec(context.Background(), `DELETE FROM files.rate_limits WHERE expires_at <= now()`)
+		}
+	}
+}
+
+func NewPostgres(db *pgxpool.Pool) Counter {
+	s := &postgres{
+		db:   db,
+		done: make(chan struct{}),
+	}
+
+	go s.gc()
+
+	return s
+}
@@ -0,0 +1,245 @@
+package aliases
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"mytonstorage-gateway/pkg/cache"
+	"mytonstorage-gateway/pkg/models"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+	"mytonstorage-gateway/pkg/models/db"
+	"mytonstorage-gateway/pkg/utils"
+)
+
+// Resolved aliases are cached for a short time, other gateway instances see a repointed alias after it
+const resolveCacheTTL = 1 * time.Minute
+
+var slugRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+type aliasesDb interface {
+	GetAlias(ctx context.Context, slug string) (*db.Alias, error)
+	GetAllAliases(ctx context.Context, limit int, offset int) ([]db.Alias, error)
+	GetAliasHistory(ctx context.Context, slug string) ([]db.AliasTarget, error)
+	SetAlias(ctx context.Context, alias db.Alias) error
+	DeleteAlias(ctx context.Context, slug string) (bool, error)
+}
+
+type service struct {
+	aliases aliasesDb
+	cache   *cache.SimpleCache
+	logger  *slog.Logger
+}
+
+type Aliases interface {
+	Resolve(ctx context.Context, slug string) (*v1.Alias, error)
+	GetAlias(ctx context.Context, slug string) (*v1.Alias, error)
+	GetAllAliases(ctx context.Context, limit int, offset int) ([]v1.Alias, error)
+	SetAlias(ctx context.Context, alias v1.Alias) error
+	DeleteAlias(ctx context.Context, slug string) error
+}
+
+// Resolve returns the current target of the alias, nil if there is no such alias.
+func (s *service) Resolve(ctx context.Context, slug string) (*v1.Alias, error) {
+	slug = strings.ToLower(slug)
+	if !slugRegexp.MatchString(slug) {
+		return nil, nil
+	}
+
+	if cached, ok := s.cache.Get(slug); ok {
+		return cached.(*v1.Alias), nil
+	}
+
+	log := s.logger.With(
+		slog.String("method", "Resolve"),
+		slog.String("slug", slug),
+	)
+
+	alias, err := s.aliases.GetAlias(ctx, slug)
+	if err != nil {
+		log.Error("failed to get alias", slog.String("error", err.Error()))
+		return nil, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	var result *v1.Alias
+	if alias != nil {
+		a := toAlias(*alias)
+		result = &a
+	}
+
+	s.cache.Set(slug, result)
+
+	return result, nil
+}
+
+// GetAlias returns the alias with the history of its targets, nil if there is no such alias.
+func (s *service) GetAlias(ctx context.Context, slug string) (*v1.Alias, error) {
+	slug = strings.ToLower(slug)
+	log := s.logger.With(
+		slog.String("method", "GetAlias"),
+		slog.String("slug", slug),
+	)
+
+	alias, err := s.aliases.GetAlias(ctx, slug)
+	if err != nil {
+		log.Error("failed to get alias", slog.String("error", err.Error()))
+		return nil, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	history, err := s.aliases.GetAliasHistory(ctx, slug)
+	if err != nil {
+		log.Error("failed to get alias history", slog.String("error", err.Error()))
+		return nil, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	if alias == nil && len(history) == 0 {
+		return nil, nil
+	}
+
+	// Deleted aliases are returned with the history only
+	result := v1.Alias{Slug: slug}
+	if alias != nil {
+		result = toAlias(*alias)
+	}
+
+	for _, t := range history {
+		result.History = append(result.History, v1.AliasTarget{
+			BagID:      t.BagID,
+			Path:       t.Path,
+			Admin:      t.Admin,
+			Comment:    t.Comment,
+			SetAt:      unixTime(t.SetAt),
+			ReplacedAt: unixTime(t.ReplacedAt),
+		})
+	}
+
+	return &result, nil
+}
+
+func (s *service) GetAllAliases(ctx context.Context, limit int, offset int) (aliases []v1.Alias, err error) {
+	log := s.logger.With(slog.String("method", "GetAllAliases"))
+
+	dbAliases, err := s.aliases.GetAllAliases(ctx, limit, offset)
+	if err != nil {
+		log.Error("failed to get aliases", slog.String("error", err.Error()))
+		return nil, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	for _, a := range dbAliases {
+		aliases = append(aliases, toAlias(a))
+	}
+
+	return aliases, nil
+}
+
+// SetAlias creates the alias or points it to a new target, the previous target is kept in the history.
+func (s *service) SetAlias(ctx context.Context, alias v1.Alias) error {
+	alias.Slug = strings.ToLower(alias.Slug)
+	log := s.logger.With(
+		slog.String("method", "SetAlias"),
+		slog.String("slug", alias.Slug),
+		slog.String("bagID", alias.BagID),
+	)
+
+	if !slugRegexp.MatchString(alias.Slug) {
+		return models.NewAppError(models.BadRequestErrorCode, "invalid slug, expected up to 63 lowercase letters, digits, '-' or '_'")
+	}
+
+	if !utils.ValidateBagID(alias.BagID) {
+		return models.NewAppError(models.BadRequestErrorCode, "invalid bag ID")
+	}
+
+	p, ok := cleanPath(alias.Path)
+	if !ok {
+		return models.NewAppError(models.BadRequestErrorCode, "invalid path")
+	}
+
+	err := s.aliases.SetAlias(ctx, db.Alias{
+		Slug:    alias.Slug,
+		BagID:   strings.ToLower(alias.BagID),
+		Path:    p,
+		Admin:   alias.Admin,
+		Comment: alias.Comment,
+	})
+	if err != nil {
+		log.Error("failed to set alias", slog.String("error", err.Error()))
+		return models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	s.cache.Release(alias.Slug)
+
+	return nil
+}
+
+func (s *service) DeleteAlias(ctx context.Context, slug string) error {
+	slug = strings.ToLower(slug)
+	log := s.logger.With(
+		slog.String("method", "DeleteAlias"),
+		slog.String("slug", slug),
+	)
+
+	deleted, err := s.aliases.DeleteAlias(ctx, slug)
+	if err != nil {
+		log.Error("failed to delete alias", slog.String("error", err.Error()))
+		return models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	s.cache.Release(slug)
+
+	if !deleted {
+		return models.NewAppError(models.NotFoundErrorCode, "alias not found")
+	}
+
+	return nil
+}
+
+func toAlias(a db.Alias) v1.Alias {
+	return v1.Alias{
+		Slug:      a.Slug,
+		BagID:     a.BagID,
+		Path:      a.Path,
+		Admin:     a.Admin,
+		Comment:   a.Comment,
+		CreatedAt: unixTime(a.CreatedAt),
+		UpdatedAt: unixTime(a.UpdatedAt),
+	}
+}
+
+func unixTime(t *time.Time) uint64 {
+	if t == nil {
+		return 0
+	}
+
+	return uint64(t.Unix())
+}
+
+// cleanPath normalizes the path inside the bag, empty path is the bag root.
+func cleanPath(p string) (string, bool) {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		return "", true
+	}
+
+	if strings.ContainsRune(p, '\x00') {
+		return "", false
+	}
+
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", false
+		}
+	}
+
+	return path.Clean(p), true
+}
+
+func NewService(aliases aliasesDb, logger *slog.Logger) Aliases {
+	return &service{
+		aliases: aliases,
+		cache:   cache.NewSimpleCache(resolveCacheTTL),
+		logger:  logger,
+	}
+}
@@ -6,18 +6,27 @@ import (
 	"time"
 
 	"mytonstorage-gateway/pkg/cache"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
 	"mytonstorage-gateway/pkg/models/private"
 )
 
+// hitsCounter counts requests to bags, it's nil if hot bags are not promoted to the local daemon.
+type hitsCounter interface {
+	Hit(bagID string)
+}
+
 type cacheMiddleware struct {
 	svc   Files
+	hits  hitsCounter
 	cache *cache.SimpleCache
 }
 
+// GetPathInfo counts a hit for every resolved path, cached or not.
 func (c *cacheMiddleware) GetPathInfo(ctx context.Context, bagID, path string) (info private.FolderInfo, err error) {
 	cacheKey := fmt.Sprintf("%s:%s", bagID, path)
 
 	if cachedInfo, ok := c.cache.Get(cacheKey); ok {
+		c.hit(bagID)
 		return cachedInfo.(private.FolderInfo), nil
 	}
 
@@ -26,6 +35,8 @@ func (c *cacheMiddleware) GetPathInfo(ctx context.Context, bagID, path string) (
 		return
 	}
 
+	c.hit(bagID)
+
 	if info.StreamFile != nil || info.SingleFilePath != "" {
 		return
 	}
@@ -35,11 +46,48 @@ func (c *cacheMiddleware) GetPathInfo(ctx context.Context, bagID, path string) (
 	return
 }
 
+func (c *cacheMiddleware) ListTree(ctx context.Context, bagID, path string) (private.FileTree, error) {
+	return c.svc.ListTree(ctx, bagID, path)
+}
+
+func (c *cacheMiddleware) StreamFile(ctx context.Context, bagID, path string, rng *private.ByteRange) (*private.StreamFile, error) {
+	return c.svc.StreamFile(ctx, bagID, path, rng)
+}
+
+func (c *cacheMiddleware) Manifest(ctx context.Context, bagID string) (m v1.Manifest, err error) {
+	cacheKey := "manifest:" + bagID
+
+	if cached, ok := c.cache.Get(cacheKey); ok {
+		return cached.(v1.Manifest), nil
+	}
+
+	m, err = c.svc.Manifest(ctx, bagID)
+	if err != nil {
+		return
+	}
+
+	c.cache.Set(cacheKey, m)
+
+	return
+}
+
+func (c *cacheMiddleware) FileProof(ctx context.Context, bagID, path string, rng *private.ByteRange) (v1.FileProof, error) {
+	return c.svc.FileProof(ctx, bagID, path, rng)
+}
+
+func (c *cacheMiddleware) hit(bagID string) {
+	if c.hits != nil {
+		c.hits.Hit(bagID)
+	}
+}
+
 func NewCacheMiddleware(
 	svc Files,
+	hits hitsCounter,
 ) Files {
 	return &cacheMiddleware{
 		svc:   svc,
+		hits:  hits,
 		cache: cache.NewSimpleCache(1 * time.Minute),
 	}
 }
@@ -0,0 +1,118 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+
+	remotes "mytonstorage-gateway/pkg/clients/remote-ton-storage"
+	tonstorageClient "mytonstorage-gateway/pkg/clients/ton-storage"
+	"mytonstorage-gateway/pkg/models"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+)
+
+// Manifest returns all files of the bag with their piece ranges and the torrent info,
+// from the local daemon if it has the bag or from the remote torrent header otherwise.
+func (s *service) Manifest(ctx context.Context, bagID string) (v1.Manifest, error) {
+	log := s.logger.With(
+		slog.String("method", "Manifest"),
+		slog.String("bagID", bagID),
+	)
+
+	if err := s.checkBan(ctx, bagID, log); err != nil {
+		return v1.Manifest{}, err
+	}
+
+	m, _, err := s.loadManifest(ctx, bagID, log)
+	return m, err
+}
+
+// loadManifest builds the manifest, the local bag is returned as well if the daemon has it.
+func (s *service) loadManifest(ctx context.Context, bagID string, log *slog.Logger) (v1.Manifest, *tonstorageClient.BagDetailed, error) {
+	if bag, err := s.tonstorage.GetBag(ctx, bagID); err == nil {
+		// The daemon doesn't report the header size, the bag is the header followed by the files
+		var dataSize uint64
+		for _, f := range bag.Files {
+			dataSize += f.Size
+		}
+
+		var headerSize uint64
+		if bag.BagSize > dataSize {
+			headerSize = bag.BagSize - dataSize
+		}
+
+		return manifest(bagID, bag.Description, strings.ToLower(bag.MerkleHash), bag.PieceSize, bag.BagSize, headerSize, bag.Files), bag, nil
+	}
+
+	if s.remoteTonStorage == nil {
+		log.Error("remote ton storage client is not configured")
+		return v1.Manifest{}, nil, models.NewAppError(models.NotFoundErrorCode, "bag not found")
+	}
+
+	info, err := s.remoteTonStorage.ListFiles(ctx, bagID)
+	if err != nil {
+		if errors.Is(err, remotes.ErrTimeout) {
+			log.Error("failed to list files from remote", slog.String("error", err.Error()))
+			return v1.Manifest{}, nil, models.NewAppError(models.TimeoutCode, "")
+		}
+
+		log.Error("remote-ton-storage ListFiles failed", slog.String("error", err.Error()))
+		return v1.Manifest{}, nil, models.NewAppError(models.NotFoundErrorCode, "bag not found")
+	}
+
+	return manifest(bagID, info.Description, info.MerkleHash, info.PieceSize, info.BagSize, info.HeaderSize, info.Files), nil, nil
+}
+
+// manifest lays the files out one after another in index order after the header
+// and maps them to pieces the same way the torrent does.
+func manifest(bagID, description, merkleHash string, pieceSize uint32, bagSize, headerSize uint64, files []tonstorageClient.File) v1.Manifest {
+	m := v1.Manifest{
+		BagID:       bagID,
+		Description: description,
+		MerkleHash:  merkleHash,
+		PieceSize:   pieceSize,
+		BagSize:     bagSize,
+		FilesCount:  len(files),
+		Files:       make([]v1.ManifestFile, 0, len(files)),
+	}
+
+	if pieceSize > 0 {
+		m.PiecesCount = uint32((bagSize + uint64(pieceSize) - 1) / uint64(pieceSize))
+	}
+
+	sorted := make([]tonstorageClient.File, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Index < sorted[j].Index
+	})
+
+	offset := headerSize
+	for _, f := range sorted {
+		mf := v1.ManifestFile{
+			Index: f.Index,
+			Path:  strings.Trim(f.Name, "/"),
+			Size:  f.Size,
+		}
+
+		if pieceSize > 0 {
+			ps := uint64(pieceSize)
+			end := offset + f.Size
+
+			mf.FromPiece = uint32(offset / ps)
+			mf.FromPieceOffset = uint32(offset % ps)
+			mf.ToPiece = mf.FromPiece
+			if end > offset {
+				mf.ToPiece = uint32((end - 1) / ps)
+			}
+			mf.ToPieceOffset = uint32(end - uint64(mf.ToPiece)*ps)
+		}
+
+		m.TotalSize += f.Size
+		m.Files = append(m.Files, mf)
+		offset += f.Size
+	}
+
+	return m
+}
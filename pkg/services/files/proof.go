@@ -0,0 +1,241 @@
+package files
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+
+	remotes "mytonstorage-gateway/pkg/clients/remote-ton-storage"
+	"mytonstorage-gateway/pkg/constants"
+	"mytonstorage-gateway/pkg/models"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+	"mytonstorage-gateway/pkg/models/private"
+)
+
+// FileProof returns the pieces covering rng of the file at path with their hashes and merkle proofs.
+// A nil rng covers the whole file, the end of rng is clamped to the file size.
+func (s *service) FileProof(ctx context.Context, bagID, path string, rng *private.ByteRange) (v1.FileProof, error) {
+	log := s.logger.With(
+		slog.String("method", "FileProof"),
+		slog.String("bagID", bagID),
+		slog.String("path", path),
+	)
+
+	if err := s.checkBan(ctx, bagID, log); err != nil {
+		return v1.FileProof{}, err
+	}
+
+	m, local, err := s.loadManifest(ctx, bagID, log)
+	if err != nil {
+		return v1.FileProof{}, err
+	}
+
+	rootHash, err := hex.DecodeString(m.MerkleHash)
+	if err != nil || len(rootHash) != 32 || m.PieceSize == 0 {
+		log.Error("bag info is not loaded", slog.String("merkle_hash", m.MerkleHash))
+		return v1.FileProof{}, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	idx := slices.IndexFunc(m.Files, func(f v1.ManifestFile) bool {
+		return f.Path == path
+	})
+	if idx < 0 {
+		return v1.FileProof{}, models.NewAppError(models.NotFoundErrorCode, "file not found")
+	}
+	file := m.Files[idx]
+
+	result := v1.FileProof{
+		BagID:       bagID,
+		MerkleHash:  m.MerkleHash,
+		PieceSize:   m.PieceSize,
+		PiecesCount: m.PiecesCount,
+		File:        file,
+		Pieces:      []v1.PieceProof{},
+	}
+
+	if file.Size == 0 {
+		return result, nil
+	}
+
+	result.End = file.Size - 1
+	if rng != nil {
+		if rng.Start > rng.End || rng.Start >= file.Size {
+			return v1.FileProof{}, models.NewAppError(models.BadRequestErrorCode, "invalid range")
+		}
+
+		result.Start = rng.Start
+		result.End = min(rng.End, file.Size-1)
+	}
+
+	// Offsets within the bag, end is exclusive
+	ps := uint64(m.PieceSize)
+	fileStart := uint64(file.FromPiece)*ps + uint64(file.FromPieceOffset)
+	start := fileStart + result.Start
+	end := fileStart + result.End + 1
+
+	// Checked before the list is built, the range may cover the whole bag
+	count := (end-1)/ps - start/ps + 1
+	if count > constants.MaxProofPieces {
+		msg := fmt.Sprintf("range covers %d pieces, at most %d are allowed", count, constants.MaxProofPieces)
+		return v1.FileProof{}, models.NewAppError(models.BadRequestErrorCode, msg)
+	}
+
+	pieces := make([]uint32, 0, count)
+	for p := uint32(start / ps); p <= uint32((end-1)/ps); p++ {
+		pieces = append(pieces, p)
+	}
+
+	var remotePieces []remotes.Piece
+	if local == nil {
+		remotePieces, err = s.remoteTonStorage.GetPieces(ctx, bagID, pieces)
+		if err != nil {
+			if errors.Is(err, remotes.ErrTimeout) {
+				log.Error("failed to get pieces from remote", slog.String("error", err.Error()))
+				return v1.FileProof{}, models.NewAppError(models.TimeoutCode, "")
+			}
+
+			log.Error("remote-ton-storage GetPieces failed", slog.String("error", err.Error()))
+			return v1.FileProof{}, models.NewAppError(models.InternalServerErrorCode, "")
+		}
+	}
+
+	for i, p := range pieces {
+		pieceStart := uint64(p) * ps
+		pieceEnd := min(pieceStart+ps, m.BagSize)
+		from := max(pieceStart, start)
+		to := min(pieceEnd, end)
+
+		pp := v1.PieceProof{
+			Index:      p,
+			FileOffset: from - fileStart,
+			Length:     to - from,
+		}
+
+		if local == nil {
+			data := remotePieces[i].Data
+			if uint64(len(data)) < to-pieceStart {
+				log.Error("piece is shorter than expected", slog.Uint64("piece", uint64(p)), slog.Int("size", len(data)))
+				return v1.FileProof{}, models.NewAppError(models.InternalServerErrorCode, "")
+			}
+
+			pp.Proof = remotePieces[i].Proof
+			pp.Head = data[:from-pieceStart]
+			pp.Tail = data[to-pieceStart:]
+		} else {
+			pp.Proof, err = s.tonstorage.GetPieceProof(ctx, bagID, p)
+			if err != nil {
+				log.Error("failed to get piece proof", slog.Uint64("piece", uint64(p)), slog.String("error", err.Error()))
+				return v1.FileProof{}, models.NewAppError(models.InternalServerErrorCode, "")
+			}
+
+			root := filepath.Join(local.Path, local.DirName)
+			head, headOK := readBagBytes(root, m, pieceStart, from)
+			tail, tailOK := readBagBytes(root, m, to, pieceEnd)
+
+			pp.Head, pp.Tail = head, tail
+			pp.Incomplete = !headOK || !tailOK
+		}
+
+		hash, err := pieceHash(pp.Proof, rootHash, p, m.PiecesCount)
+		if err != nil {
+			log.Error("invalid piece proof", slog.Uint64("piece", uint64(p)), slog.String("error", err.Error()))
+			return v1.FileProof{}, models.NewAppError(models.InternalServerErrorCode, "")
+		}
+		pp.Hash = hex.EncodeToString(hash)
+
+		result.Pieces = append(result.Pieces, pp)
+	}
+
+	return result, nil
+}
+
+// pieceHash checks the proof against the bag merkle hash and returns the piece hash from it.
+// Piece hashes are the leaves of a binary tree of depth ceil(log2(piecesCount)), bits of
+// the piece index from the highest one select the branch.
+func pieceHash(proof, rootHash []byte, piece, piecesCount uint32) ([]byte, error) {
+	c, err := cell.FromBOC(proof)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse proof: %w", err)
+	}
+
+	tree, err := cell.UnwrapProof(c, rootHash)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := bits.Len32(piecesCount-1) - 1; i >= 0; i-- {
+		ref := 0
+		if piece&(1<<i) != 0 {
+			ref = 1
+		}
+
+		if tree, err = tree.PeekRef(ref); err != nil {
+			return nil, fmt.Errorf("failed to follow proof branch: %w", err)
+		}
+	}
+
+	// Branches other than the proven one are pruned
+	if tree.GetType() == cell.PrunedCellType {
+		return nil, fmt.Errorf("piece %d is not proven", piece)
+	}
+
+	return tree.BeginParse().LoadSlice(256)
+}
+
+// readBagBytes reads the bag bytes in [from, to) from the files of a local bag.
+// The torrent header is not stored as a file, false is returned if the bytes include it
+// or the files are not downloaded completely.
+func readBagBytes(root string, m v1.Manifest, from, to uint64) ([]byte, bool) {
+	if from >= to {
+		return nil, true
+	}
+
+	if m.BagSize > m.TotalSize && from < m.BagSize-m.TotalSize {
+		return nil, false
+	}
+
+	ps := uint64(m.PieceSize)
+	buf := make([]byte, 0, to-from)
+	for _, f := range m.Files {
+		fileStart := uint64(f.FromPiece)*ps + uint64(f.FromPieceOffset)
+		fileEnd := fileStart + f.Size
+		if f.Size == 0 || fileEnd <= from || fileStart >= to {
+			continue
+		}
+
+		lo := max(from, fileStart)
+		hi := min(to, fileEnd)
+
+		part, err := readFileAt(filepath.Join(root, f.Path), int64(lo-fileStart), int(hi-lo))
+		if err != nil {
+			return nil, false
+		}
+
+		buf = append(buf, part...)
+	}
+
+	return buf, uint64(len(buf)) == to-from
+}
+
+func readFileAt(name string, offset int64, n int) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, n)
+	if _, err = f.ReadAt(buf, offset); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
@@ -11,12 +11,13 @@ import (
 
 	remotes "mytonstorage-gateway/pkg/clients/remote-ton-storage"
 	tonstorageClient "mytonstorage-gateway/pkg/clients/ton-storage"
-	"mytonstorage-gateway/pkg/constants"
 	"mytonstorage-gateway/pkg/models"
 	v1 "mytonstorage-gateway/pkg/models/api/v1"
 	"mytonstorage-gateway/pkg/models/private"
 )
 
+var errBagIncomplete = errors.New("bag is not downloaded completely")
+
 type service struct {
 	reports          reportsDb
 	tonstorage       storage
@@ -30,10 +31,15 @@ type reportsDb interface {
 
 type storage interface {
 	GetBag(ctx context.Context, bagId string) (*tonstorageClient.BagDetailed, error)
+	GetPieceProof(ctx context.Context, bagId string, piece uint32) ([]byte, error)
 }
 
 type Files interface {
 	GetPathInfo(ctx context.Context, bagID, path string) (private.FolderInfo, error)
+	ListTree(ctx context.Context, bagID, path string) (private.FileTree, error)
+	StreamFile(ctx context.Context, bagID, path string, rng *private.ByteRange) (*private.StreamFile, error)
+	Manifest(ctx context.Context, bagID string) (v1.Manifest, error)
+	FileProof(ctx context.Context, bagID, path string, rng *private.ByteRange) (v1.FileProof, error)
 }
 
 func (s *service) GetPathInfo(ctx context.Context, bagID, path string) (private.FolderInfo, error) {
@@ -42,28 +48,109 @@ func (s *service) GetPathInfo(ctx context.Context, bagID, path string) (private.
 		slog.String("bagID", bagID),
 		slog.String("path", path),
 	)
+
+	if err := s.checkBan(ctx, bagID, log); err != nil {
+		return private.FolderInfo{}, err
+	}
+
+	info, err := s.getFromLocalStorage(ctx, bagID, path, log)
+	// The local daemon lists all files of a bag it has, a path missing there is missing remotely too
+	if err != nil && info.FilesCount == 0 {
+		info, err = s.getFromRemoteStorage(ctx, bagID, path, log)
+	}
+
+	return info, err
+}
+
+// ListTree returns all files under the directory path recursively, names are relative to the bag root.
+func (s *service) ListTree(ctx context.Context, bagID, path string) (private.FileTree, error) {
+	log := s.logger.With(
+		slog.String("method", "ListTree"),
+		slog.String("bagID", bagID),
+		slog.String("path", path),
+	)
+
+	if err := s.checkBan(ctx, bagID, log); err != nil {
+		return private.FileTree{}, err
+	}
+
+	var (
+		tree  private.FileTree
+		files []tonstorageClient.File
+	)
+
+	if bag, err := s.completedBag(ctx, bagID, log); err == nil {
+		tree.LocalRoot = filepath.Join(bag.Path, bag.DirName)
+		files = bag.Files
+	} else {
+		if s.remoteTonStorage == nil {
+			log.Error("remote ton storage client is not configured")
+			return private.FileTree{}, models.NewAppError(models.NotFoundErrorCode, "bag not found")
+		}
+
+		bagInfo, err := s.remoteTonStorage.ListFiles(ctx, bagID)
+		if err != nil {
+			if errors.Is(err, remotes.ErrTimeout) {
+				log.Error("failed to list files from remote", slog.String("error", err.Error()))
+				return private.FileTree{}, models.NewAppError(models.TimeoutCode, "")
+			}
+
+			log.Error("remote-ton-storage ListFiles failed", slog.String("error", err.Error()))
+			return private.FileTree{}, models.NewAppError(models.NotFoundErrorCode, "bag not found")
+		}
+
+		files = bagInfo.Files
+	}
+
+	tree.BagID = bagID
+	tree.Files = lsRecursive(files, path)
+	if len(tree.Files) == 0 {
+		log.Warn("path not found", slog.String("path", path))
+		return private.FileTree{}, models.NewAppError(models.NotFoundErrorCode, "path not found")
+	}
+
+	for _, f := range tree.Files {
+		tree.TotalSize += f.Size
+	}
+
+	return tree, nil
+}
+
+func (s *service) checkBan(ctx context.Context, bagID string, log *slog.Logger) error {
 	isBanned, err := s.reports.HasBan(ctx, bagID)
 	if err != nil {
 		log.Error("failed to check ban status", slog.String("error", err.Error()))
-		return private.FolderInfo{}, models.NewAppError(models.InternalServerErrorCode, "")
+		return models.NewAppError(models.InternalServerErrorCode, "")
 	}
 
 	if isBanned {
 		log.Warn("bag is banned", slog.String("bagID", bagID))
-		return private.FolderInfo{}, models.NewAppError(models.NotAcceptableErrorCode, "bag is banned")
+		return models.NewAppError(models.NotAcceptableErrorCode, "bag is banned")
 	}
 
-	if info, err := s.getFromLocalStorage(ctx, bagID, path, log); err == nil {
-		return info, nil
+	return nil
+}
+
+// completedBag returns the bag from the local daemon only if all of its files are downloaded.
+// Bags still being downloaded, e.g. just promoted ones, are served from remote storage.
+func (s *service) completedBag(ctx context.Context, bagID string, log *slog.Logger) (*tonstorageClient.BagDetailed, error) {
+	bag, err := s.tonstorage.GetBag(ctx, bagID)
+	if err != nil {
+		log.Info("failed to get bag from local storage", slog.String("error", err.Error()))
+		return nil, err
 	}
 
-	return s.getFromRemoteStorage(ctx, bagID, path, log)
+	if !bag.Completed {
+		log.Info("bag is not downloaded completely in local storage", slog.Uint64("downloaded", bag.Downloaded))
+		return nil, errBagIncomplete
+	}
+
+	return bag, nil
 }
 
 func (s *service) getFromLocalStorage(ctx context.Context, bagID, path string, log *slog.Logger) (private.FolderInfo, error) {
-	bag, err := s.tonstorage.GetBag(ctx, bagID)
+	bag, err := s.completedBag(ctx, bagID, log)
 	if err != nil {
-		log.Info("failed to get bag from local storage", slog.String("error", err.Error()))
 		return private.FolderInfo{}, err
 	}
 
@@ -134,15 +221,11 @@ func (s *service) getFromRemoteStorage(ctx context.Context, bagID, path string,
 		return !f.IsFolder && strings.HasSuffix(path, f.Name)
 	}) {
 		if s.isSingleFile(info.Files, path) {
-			if info.Files[0].Size > constants.MaxFileServeSize {
-				log.Warn("file too large to serve", "path", path, slog.Uint64("size", info.Files[0].Size))
-				return private.FolderInfo{}, models.NewAppError(models.TooLargeCode, "file too large, use https://github.com/xssnick/TON-Torrent")
-			}
-
-			info.StreamFile, err = s.streamRemoteFile(ctx, bagID, path, log)
-			if err != nil {
-				log.Error("failed to stream file from remote", slog.String("error", err.Error()))
-				return info, err
+			// The stream itself is opened by StreamFile once the caller knows which bytes it needs,
+			// whether the file is small enough to be served is decided by the caller as well
+			info.StreamFile = &private.StreamFile{
+				Size:       info.Files[0].Size,
+				PeersCount: files.PeersCount,
 			}
 		}
 	} else if len(info.Files) == 0 {
@@ -157,8 +240,29 @@ func (s *service) isSingleFile(files []v1.File, path string) bool {
 	return len(files) == 1 && !files[0].IsFolder
 }
 
-func (s *service) streamRemoteFile(ctx context.Context, bagID, path string, log *slog.Logger) (*private.StreamFile, error) {
-	fs, err := s.remoteTonStorage.StreamFile(ctx, bagID, path)
+// StreamFile opens a remote file stream. If rng is not nil, only the requested bytes are streamed.
+// It must be called only for files of remote bags resolved by GetPathInfo or ListTree.
+func (s *service) StreamFile(ctx context.Context, bagID, path string, rng *private.ByteRange) (*private.StreamFile, error) {
+	log := s.logger.With(
+		slog.String("method", "StreamFile"),
+		slog.String("bagID", bagID),
+		slog.String("path", path),
+	)
+
+	if s.remoteTonStorage == nil {
+		log.Error("remote ton storage client is not configured")
+		return nil, models.NewAppError(models.NotFoundErrorCode, "bag not found")
+	}
+
+	var r *remotes.ByteRange
+	if rng != nil {
+		r = &remotes.ByteRange{
+			Start: rng.Start,
+			End:   rng.End,
+		}
+	}
+
+	fs, err := s.remoteTonStorage.StreamFile(ctx, bagID, path, r)
 	if err != nil {
 		if errors.Is(err, remotes.ErrTimeout) {
 			return &private.StreamFile{
@@ -166,6 +270,10 @@ func (s *service) streamRemoteFile(ctx context.Context, bagID, path string, log
 			}, models.NewAppError(models.TimeoutCode, "")
 		}
 
+		if errors.Is(err, remotes.ErrInvalidRange) {
+			return nil, models.NewAppError(models.BadRequestErrorCode, "invalid range")
+		}
+
 		log.Error("failed to stream file from remote", slog.String("error", err.Error()))
 		return nil, models.NewAppError(models.InternalServerErrorCode, "")
 	}
@@ -201,6 +309,7 @@ func ls(files []tonstorageClient.File, path string) []v1.File {
 				}
 			} else {
 				result = append(result, v1.File{
+					Index:    file.Index,
 					Name:     filepath.Base(fileName),
 					Size:     file.Size,
 					IsFolder: false,
@@ -221,6 +330,7 @@ func ls(files []tonstorageClient.File, path string) []v1.File {
 				}
 			} else {
 				result = append(result, v1.File{
+					Index:    file.Index,
 					Name:     filepath.Base(fileName),
 					Size:     file.Size,
 					IsFolder: false,
@@ -228,6 +338,7 @@ func ls(files []tonstorageClient.File, path string) []v1.File {
 			}
 		} else if normalizedPath == fileName {
 			result = append(result, v1.File{
+				Index:    file.Index,
 				Name:     filepath.Base(fileName),
 				Size:     file.Size,
 				IsFolder: false,
@@ -250,6 +361,33 @@ func ls(files []tonstorageClient.File, path string) []v1.File {
 	return result
 }
 
+// lsRecursive returns all files under the directory path with their full names.
+func lsRecursive(files []tonstorageClient.File, path string) []v1.File {
+	normalizedPath := strings.Trim(path, string(filepath.Separator))
+
+	var result []v1.File
+	for _, file := range files {
+		fileName := strings.Trim(file.Name, string(filepath.Separator))
+
+		if normalizedPath != "." && normalizedPath != "" &&
+			!strings.HasPrefix(fileName, normalizedPath+string(filepath.Separator)) {
+			continue
+		}
+
+		result = append(result, v1.File{
+			Index: file.Index,
+			Name:  fileName,
+			Size:  file.Size,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
 func NewService(
 	reports reportsDb,
 	tonstorage storage,
@@ -0,0 +1,128 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	remotes "mytonstorage-gateway/pkg/clients/remote-ton-storage"
+	tonstorageClient "mytonstorage-gateway/pkg/clients/ton-storage"
+)
+
+type fakeReports struct{}
+
+func (fakeReports) HasBan(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+// fakeStorage is the local daemon with a single bag.
+type fakeStorage struct {
+	bag *tonstorageClient.BagDetailed
+}
+
+func (s *fakeStorage) GetBag(_ context.Context, bagID string) (*tonstorageClient.BagDetailed, error) {
+	if s.bag == nil || s.bag.BagID != bagID {
+		return nil, errors.New("bag not found")
+	}
+
+	return s.bag, nil
+}
+
+func (s *fakeStorage) GetPieceProof(context.Context, string, uint32) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+// fakeRemote serves the same files as the local bag and counts ListFiles calls.
+type fakeRemote struct {
+	files     []tonstorageClient.File
+	listCalls int
+}
+
+func (r *fakeRemote) StreamFile(_ context.Context, _, _ string, _ *remotes.ByteRange) (remotes.FileStream, error) {
+	return remotes.FileStream{FileStream: io.NopCloser(bytes.NewReader(nil))}, nil
+}
+
+func (r *fakeRemote) ListFiles(context.Context, string) (remotes.BagInfo, error) {
+	r.listCalls++
+	return remotes.BagInfo{Files: r.files, PeersCount: 3}, nil
+}
+
+func (r *fakeRemote) GetPieces(context.Context, string, []uint32) ([]remotes.Piece, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (r *fakeRemote) Close() {}
+
+func newTestService(completed bool) (Files, *fakeRemote) {
+	files := []tonstorageClient.File{
+		{Index: 0, Name: "a.txt", Size: 10},
+		{Index: 1, Name: "dir/b.txt", Size: 20},
+	}
+
+	local := &fakeStorage{bag: &tonstorageClient.BagDetailed{
+		Bag: tonstorageClient.Bag{
+			BagID:     "bag",
+			DirName:   "bag",
+			Completed: completed,
+		},
+		Files: files,
+		Path:  "/storage",
+	}}
+	remote := &fakeRemote{files: files}
+
+	return NewService(fakeReports{}, local, remote, slog.New(slog.DiscardHandler)), remote
+}
+
+func TestGetPathInfoCompletedLocalBag(t *testing.T) {
+	svc, remote := newTestService(true)
+
+	info, err := svc.GetPathInfo(context.Background(), "bag", "a.txt")
+	if err != nil {
+		t.Fatalf("GetPathInfo: %v", err)
+	}
+
+	if info.SingleFilePath != "/storage/bag/a.txt" || info.StreamFile != nil {
+		t.Fatalf("GetPathInfo = %+v, want the file from local disk", info)
+	}
+
+	if remote.listCalls != 0 {
+		t.Fatalf("remote listed %d times, want 0", remote.listCalls)
+	}
+}
+
+func TestGetPathInfoIncompleteLocalBag(t *testing.T) {
+	svc, remote := newTestService(false)
+
+	info, err := svc.GetPathInfo(context.Background(), "bag", "a.txt")
+	if err != nil {
+		t.Fatalf("GetPathInfo: %v", err)
+	}
+
+	if info.SingleFilePath != "" || info.StreamFile == nil || info.StreamFile.Size != 10 {
+		t.Fatalf("GetPathInfo = %+v, want the file from remote storage", info)
+	}
+
+	if remote.listCalls != 1 {
+		t.Fatalf("remote listed %d times, want 1", remote.listCalls)
+	}
+}
+
+func TestListTreeIncompleteLocalBag(t *testing.T) {
+	svc, remote := newTestService(false)
+
+	tree, err := svc.ListTree(context.Background(), "bag", "")
+	if err != nil {
+		t.Fatalf("ListTree: %v", err)
+	}
+
+	if tree.LocalRoot != "" || len(tree.Files) != 2 {
+		t.Fatalf("ListTree = %+v, want remote files without a local root", tree)
+	}
+
+	if remote.listCalls != 1 {
+		t.Fatalf("remote listed %d times, want 1", remote.listCalls)
+	}
+}
@@ -0,0 +1,173 @@
+package pins
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+
+	tonstorageClient "mytonstorage-gateway/pkg/clients/ton-storage"
+	"mytonstorage-gateway/pkg/models"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+)
+
+type pinsDb interface {
+	HasBan(ctx context.Context, bagID string) (bool, error)
+	DeletePromotedBag(ctx context.Context, bagID string) error
+}
+
+type storage interface {
+	GetBag(ctx context.Context, bagId string) (*tonstorageClient.BagDetailed, error)
+	AddBag(ctx context.Context, bagId string, downloadAll bool) error
+	RemoveBag(ctx context.Context, bagId string, withFiles bool) error
+	ListBags(ctx context.Context) (*tonstorageClient.List, error)
+}
+
+type service struct {
+	db         pinsDb
+	tonstorage storage
+	// bagsLock is shared with the promotion, so a bag is never demoted while it's being pinned
+	bagsLock sync.Locker
+	logger   *slog.Logger
+}
+
+// Pins manages bags kept on the local TON Storage daemon.
+type Pins interface {
+	GetAllPins(ctx context.Context) ([]v1.Pin, error)
+	GetPin(ctx context.Context, bagID string) (*v1.Pin, error)
+	AddPin(ctx context.Context, bagID string, downloadAll bool) error
+	RemovePin(ctx context.Context, bagID string, withFiles bool) error
+}
+
+func (s *service) GetAllPins(ctx context.Context) ([]v1.Pin, error) {
+	log := s.logger.With(slog.String("method", "GetAllPins"))
+
+	list, err := s.tonstorage.ListBags(ctx)
+	if err != nil {
+		log.Error("failed to list bags", slog.String("error", err.Error()))
+		return nil, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	pins := make([]v1.Pin, 0, len(list.Bags))
+	for _, b := range list.Bags {
+		pins = append(pins, toPin(b))
+	}
+
+	return pins, nil
+}
+
+// GetPin returns the download state of the bag, nil if the bag is not on the daemon.
+func (s *service) GetPin(ctx context.Context, bagID string) (*v1.Pin, error) {
+	log := s.logger.With(
+		slog.String("method", "GetPin"),
+		slog.String("bagID", bagID),
+	)
+
+	bag, err := s.tonstorage.GetBag(ctx, bagID)
+	if err != nil {
+		if errors.Is(err, tonstorageClient.ErrNotFound) {
+			return nil, nil
+		}
+
+		log.Error("failed to get bag", slog.String("error", err.Error()))
+		return nil, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	pin := toPin(bag.Bag)
+
+	return &pin, nil
+}
+
+// AddPin adds the bag to the daemon, banned bags are refused.
+// A bag promoted automatically before is kept from then on, demotion only removes promoted bags.
+func (s *service) AddPin(ctx context.Context, bagID string, downloadAll bool) error {
+	log := s.logger.With(
+		slog.String("method", "AddPin"),
+		slog.String("bagID", bagID),
+		slog.Bool("downloadAll", downloadAll),
+	)
+
+	isBanned, err := s.db.HasBan(ctx, bagID)
+	if err != nil {
+		log.Error("failed to check ban status", slog.String("error", err.Error()))
+		return models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	if isBanned {
+		log.Warn("bag is banned")
+		return models.NewAppError(models.NotAcceptableErrorCode, "bag is banned")
+	}
+
+	s.bagsLock.Lock()
+	defer s.bagsLock.Unlock()
+
+	if err = s.tonstorage.AddBag(ctx, bagID, downloadAll); err != nil {
+		log.Error("failed to add bag", slog.String("error", err.Error()))
+		return models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	if err = s.db.DeletePromotedBag(ctx, bagID); err != nil {
+		log.Error("failed to delete promoted bag", slog.String("error", err.Error()))
+		return models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	log.Info("bag pinned")
+
+	return nil
+}
+
+// RemovePin removes the bag from the daemon, downloaded files are deleted only with withFiles.
+func (s *service) RemovePin(ctx context.Context, bagID string, withFiles bool) error {
+	log := s.logger.With(
+		slog.String("method", "RemovePin"),
+		slog.String("bagID", bagID),
+		slog.Bool("withFiles", withFiles),
+	)
+
+	if err := s.tonstorage.RemoveBag(ctx, bagID, withFiles); err != nil {
+		if errors.Is(err, tonstorageClient.ErrNotFound) {
+			return models.NewAppError(models.NotFoundErrorCode, "bag is not pinned")
+		}
+
+		log.Error("failed to remove bag", slog.String("error", err.Error()))
+		return models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	log.Info("bag unpinned")
+
+	return nil
+}
+
+func toPin(b tonstorageClient.Bag) v1.Pin {
+	var progress float64
+	if b.Size > 0 {
+		progress = float64(b.Downloaded) / float64(b.Size) * 100
+	}
+
+	return v1.Pin{
+		BagID:         strings.ToLower(b.BagID),
+		Description:   b.Description,
+		Size:          b.Size,
+		Downloaded:    b.Downloaded,
+		Progress:      progress,
+		Completed:     b.Completed,
+		FilesCount:    b.FilesCount,
+		PeersCount:    b.Peers,
+		DownloadSpeed: b.DownloadSpeed,
+		UploadSpeed:   b.UploadSpeed,
+		HeaderLoaded:  b.HeaderLoaded,
+		InfoLoaded:    b.InfoLoaded,
+		Active:        b.Active,
+		Seeding:       b.Seeding,
+	}
+}
+
+func NewService(db pinsDb, tonstorage storage, bagsLock sync.Locker, logger *slog.Logger) Pins {
+	return &service{
+		db:         db,
+		tonstorage: tonstorage,
+		bagsLock:   bagsLock,
+		logger:     logger,
+	}
+}
@@ -0,0 +1,48 @@
+package promotion
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	actionPromote = "promote"
+	actionDemote  = "demote"
+
+	resultOk         = "ok"
+	resultError      = "error"
+	resultOverBudget = "over_budget"
+)
+
+// Metrics holds Prometheus collectors of the promotion policy.
+type Metrics struct {
+	actions       *prometheus.CounterVec
+	promotedBags  prometheus.Gauge
+	promotedBytes prometheus.Gauge
+}
+
+func NewMetrics(namespace, subsystem string) *Metrics {
+	m := &Metrics{
+		actions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "bag_promotions_total",
+			Help:      "Promotions of hot remote bags to the local daemon and demotions of cold ones.",
+		}, []string{"action", "result"}),
+		promotedBags: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "promoted_bags",
+			Help:      "Current number of promoted bags on the local daemon.",
+		}),
+		promotedBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "promoted_bytes",
+			Help:      "Current total size of promoted bags, limited by the storage budget.",
+		}),
+	}
+
+	prometheus.MustRegister(m.actions, m.promotedBags, m.promotedBytes)
+
+	return m
+}
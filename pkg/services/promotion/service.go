@@ -0,0 +1,312 @@
+package promotion
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	remotes "mytonstorage-gateway/pkg/clients/remote-ton-storage"
+	tonstorageClient "mytonstorage-gateway/pkg/clients/ton-storage"
+	"mytonstorage-gateway/pkg/models/db"
+)
+
+// Requests are counted in hitBuckets buckets per window, so the window slides bucket by bucket.
+const hitBuckets = 6
+
+// Settings of the promotion policy.
+type Settings struct {
+	// Window is the period requests are counted over
+	Window time.Duration
+	// Bags requested at least HotThreshold times within the window are promoted
+	HotThreshold uint64
+	// Promoted bags requested fewer than ColdThreshold times within the window are demoted,
+	// bags promoted less than a window ago are kept
+	ColdThreshold uint64
+	// BudgetBytes caps the total size of promoted bags, zero means unlimited
+	BudgetBytes uint64
+}
+
+type promotedDb interface {
+	HasBan(ctx context.Context, bagID string) (bool, error)
+	GetPromotedBags(ctx context.Context) ([]db.PromotedBag, error)
+	AddPromotedBag(ctx context.Context, bag db.PromotedBag) error
+	IsPromotedBag(ctx context.Context, bagID string) (bool, error)
+	DeletePromotedBag(ctx context.Context, bagID string) error
+}
+
+type storage interface {
+	GetBag(ctx context.Context, bagId string) (*tonstorageClient.BagDetailed, error)
+	AddBag(ctx context.Context, bagId string, downloadAll bool) error
+	RemoveBag(ctx context.Context, bagId string, withFiles bool) error
+}
+
+type remoteStorage interface {
+	ListFiles(ctx context.Context, bagID string) (remotes.BagInfo, error)
+}
+
+type hitKey struct {
+	bagID  string
+	bucket int64
+}
+
+type service struct {
+	db         promotedDb
+	tonstorage storage
+	remote     remoteStorage
+	settings   Settings
+	metrics    *Metrics
+	logger     *slog.Logger
+	// bagsLock is shared with the pins, so a bag is never demoted while it's being pinned
+	bagsLock sync.Locker
+
+	mu   sync.Mutex
+	hits map[hitKey]uint64
+}
+
+// Promotion downloads often requested remote bags to the local daemon and removes them once they go cold.
+// Only bags promoted by the policy are ever removed, bags pinned by admins are left alone.
+type Promotion interface {
+	Hit(bagID string)
+	Check(ctx context.Context) error
+	Run(ctx context.Context, interval time.Duration)
+}
+
+// Hit counts a request to the bag.
+func (s *service) Hit(bagID string) {
+	key := hitKey{
+		bagID:  strings.ToLower(bagID),
+		bucket: s.bucketOf(time.Now()),
+	}
+
+	s.mu.Lock()
+	s.hits[key]++
+	s.mu.Unlock()
+}
+
+// Check demotes cold promoted bags first, then promotes the hottest remote bags while they fit into the budget.
+func (s *service) Check(ctx context.Context) error {
+	log := s.logger.With(slog.String("method", "Check"))
+
+	now := time.Now()
+	counts := s.counts(now)
+
+	promoted, err := s.db.GetPromotedBags(ctx)
+	if err != nil {
+		return err
+	}
+
+	var used uint64
+	isPromoted := make(map[string]bool, len(promoted))
+	for _, b := range promoted {
+		if s.shouldDemote(ctx, b, counts[b.BagID], now, log) && s.demote(ctx, b.BagID, log) {
+			continue
+		}
+
+		isPromoted[b.BagID] = true
+		used += b.Size
+	}
+
+	var candidates []string
+	for bagID, n := range counts {
+		if n >= s.settings.HotThreshold && !isPromoted[bagID] {
+			candidates = append(candidates, bagID)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return counts[candidates[i]] > counts[candidates[j]]
+	})
+
+	for _, bagID := range candidates {
+		size, ok, err := s.promote(ctx, bagID, used, log.With(slog.String("bagID", bagID)))
+		if err != nil {
+			// The daemon is not reachable, try again on the next check
+			log.Error("failed to promote bags", slog.String("error", err.Error()))
+			break
+		}
+
+		if ok {
+			isPromoted[bagID] = true
+			used += size
+		}
+	}
+
+	s.metrics.promotedBags.Set(float64(len(isPromoted)))
+	s.metrics.promotedBytes.Set(float64(used))
+
+	return nil
+}
+
+// Run checks the bags every interval until ctx is done.
+func (s *service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Check(ctx); err != nil {
+				s.logger.Error("failed to check promoted bags", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+func (s *service) shouldDemote(ctx context.Context, b db.PromotedBag, hits uint64, now time.Time, log *slog.Logger) bool {
+	isBanned, err := s.db.HasBan(ctx, b.BagID)
+	if err != nil {
+		log.Error("failed to check ban status", slog.String("bagID", b.BagID), slog.String("error", err.Error()))
+		return false
+	}
+
+	if isBanned {
+		return true
+	}
+
+	return now.Sub(b.PromotedAt) >= s.settings.Window && hits < s.settings.ColdThreshold
+}
+
+// demote removes the bag with its files from the daemon and reports whether it's not promoted anymore.
+// A bag pinned since the promoted bags were listed is left on the daemon.
+func (s *service) demote(ctx context.Context, bagID string, log *slog.Logger) bool {
+	log = log.With(slog.String("bagID", bagID))
+
+	s.bagsLock.Lock()
+	defer s.bagsLock.Unlock()
+
+	isPromoted, err := s.db.IsPromotedBag(ctx, bagID)
+	if err != nil {
+		log.Error("failed to check promoted bag", slog.String("error", err.Error()))
+		s.metrics.actions.WithLabelValues(actionDemote, resultError).Inc()
+		return false
+	}
+
+	if !isPromoted {
+		log.Info("bag was pinned, not demoted")
+		return true
+	}
+
+	err = s.tonstorage.RemoveBag(ctx, bagID, true)
+	if err != nil && !errors.Is(err, tonstorageClient.ErrNotFound) {
+		log.Error("failed to remove bag", slog.String("error", err.Error()))
+		s.metrics.actions.WithLabelValues(actionDemote, resultError).Inc()
+		return false
+	}
+
+	if err = s.db.DeletePromotedBag(ctx, bagID); err != nil {
+		log.Error("failed to delete promoted bag", slog.String("error", err.Error()))
+		s.metrics.actions.WithLabelValues(actionDemote, resultError).Inc()
+		return false
+	}
+
+	log.Info("bag demoted")
+	s.metrics.actions.WithLabelValues(actionDemote, resultOk).Inc()
+
+	return true
+}
+
+// promote downloads the bag to the daemon if it fits into the budget, used is the size of promoted bags.
+// Bags already on the daemon and banned bags are skipped. An error is returned only if the daemon fails.
+func (s *service) promote(ctx context.Context, bagID string, used uint64, log *slog.Logger) (uint64, bool, error) {
+	isBanned, err := s.db.HasBan(ctx, bagID)
+	if err != nil {
+		log.Error("failed to check ban status", slog.String("error", err.Error()))
+		return 0, false, nil
+	}
+
+	if isBanned {
+		return 0, false, nil
+	}
+
+	if _, err = s.tonstorage.GetBag(ctx, bagID); err == nil {
+		return 0, false, nil
+	} else if !errors.Is(err, tonstorageClient.ErrNotFound) {
+		return 0, false, err
+	}
+
+	info, err := s.remote.ListFiles(ctx, bagID)
+	if err != nil {
+		log.Warn("failed to get bag size", slog.String("error", err.Error()))
+		s.metrics.actions.WithLabelValues(actionPromote, resultError).Inc()
+		return 0, false, nil
+	}
+
+	size := info.BagSize
+	if s.settings.BudgetBytes > 0 && used+size > s.settings.BudgetBytes {
+		log.Debug("bag doesn't fit into the storage budget", slog.Uint64("size", size), slog.Uint64("used", used))
+		s.metrics.actions.WithLabelValues(actionPromote, resultOverBudget).Inc()
+		return 0, false, nil
+	}
+
+	// The bag is recorded first, so it's never left on the daemon unmanaged if the gateway stops in between
+	if err = s.db.AddPromotedBag(ctx, db.PromotedBag{BagID: bagID, Size: size}); err != nil {
+		log.Error("failed to add promoted bag", slog.String("error", err.Error()))
+		s.metrics.actions.WithLabelValues(actionPromote, resultError).Inc()
+		return 0, false, nil
+	}
+
+	if err = s.tonstorage.AddBag(ctx, bagID, true); err != nil {
+		s.metrics.actions.WithLabelValues(actionPromote, resultError).Inc()
+		if dErr := s.db.DeletePromotedBag(ctx, bagID); dErr != nil {
+			log.Error("failed to delete promoted bag", slog.String("error", dErr.Error()))
+		}
+
+		return 0, false, err
+	}
+
+	log.Info("bag promoted", slog.Uint64("size", size))
+	s.metrics.actions.WithLabelValues(actionPromote, resultOk).Inc()
+
+	return size, true, nil
+}
+
+// counts returns the number of requests per bag within the window and drops outdated buckets.
+func (s *service) counts(now time.Time) map[string]uint64 {
+	current := s.bucketOf(now)
+	counts := make(map[string]uint64)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, n := range s.hits {
+		if key.bucket <= current-hitBuckets {
+			delete(s.hits, key)
+			continue
+		}
+
+		counts[key.bagID] += n
+	}
+
+	return counts
+}
+
+func (s *service) bucketOf(t time.Time) int64 {
+	return t.UnixNano() / int64(max(s.settings.Window/hitBuckets, time.Second))
+}
+
+func NewService(
+	db promotedDb,
+	tonstorage storage,
+	remote remoteStorage,
+	settings Settings,
+	metrics *Metrics,
+	bagsLock sync.Locker,
+	logger *slog.Logger,
+) Promotion {
+	return &service{
+		db:         db,
+		tonstorage: tonstorage,
+		remote:     remote,
+		settings:   settings,
+		metrics:    metrics,
+		logger:     logger,
+		bagsLock:   bagsLock,
+		hits:       make(map[hitKey]uint64),
+	}
+}
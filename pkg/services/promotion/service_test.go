@@ -0,0 +1,148 @@
+package promotion
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	remotes "mytonstorage-gateway/pkg/clients/remote-ton-storage"
+	tonstorageClient "mytonstorage-gateway/pkg/clients/ton-storage"
+	"mytonstorage-gateway/pkg/models/db"
+	"mytonstorage-gateway/pkg/services/pins"
+)
+
+// fakeDb keeps promoted bags in memory, onList runs after the promoted bags are listed.
+type fakeDb struct {
+	promoted map[string]db.PromotedBag
+	onList   func()
+}
+
+func (d *fakeDb) HasBan(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+func (d *fakeDb) GetPromotedBags(context.Context) ([]db.PromotedBag, error) {
+	bags := make([]db.PromotedBag, 0, len(d.promoted))
+	for _, b := range d.promoted {
+		bags = append(bags, b)
+	}
+
+	if d.onList != nil {
+		d.onList()
+	}
+
+	return bags, nil
+}
+
+func (d *fakeDb) AddPromotedBag(_ context.Context, bag db.PromotedBag) error {
+	d.promoted[bag.BagID] = bag
+	return nil
+}
+
+func (d *fakeDb) IsPromotedBag(_ context.Context, bagID string) (bool, error) {
+	_, ok := d.promoted[bagID]
+	return ok, nil
+}
+
+func (d *fakeDb) DeletePromotedBag(_ context.Context, bagID string) error {
+	delete(d.promoted, bagID)
+	return nil
+}
+
+// fakeStorage is the local daemon.
+type fakeStorage struct {
+	bags map[string]bool
+}
+
+func (s *fakeStorage) GetBag(_ context.Context, bagID string) (*tonstorageClient.BagDetailed, error) {
+	if !s.bags[bagID] {
+		return nil, tonstorageClient.ErrNotFound
+	}
+
+	return &tonstorageClient.BagDetailed{Bag: tonstorageClient.Bag{BagID: bagID}}, nil
+}
+
+func (s *fakeStorage) AddBag(_ context.Context, bagID string, _ bool) error {
+	s.bags[bagID] = true
+	return nil
+}
+
+func (s *fakeStorage) RemoveBag(_ context.Context, bagID string, _ bool) error {
+	delete(s.bags, bagID)
+	return nil
+}
+
+func (s *fakeStorage) ListBags(context.Context) (*tonstorageClient.List, error) {
+	return &tonstorageClient.List{}, nil
+}
+
+type fakeRemote struct{}
+
+func (fakeRemote) ListFiles(context.Context, string) (remotes.BagInfo, error) {
+	return remotes.BagInfo{}, nil
+}
+
+func newTestMetrics() *Metrics {
+	return &Metrics{
+		actions:       prometheus.NewCounterVec(prometheus.CounterOpts{Name: "actions"}, []string{"action", "result"}),
+		promotedBags:  prometheus.NewGauge(prometheus.GaugeOpts{Name: "bags"}),
+		promotedBytes: prometheus.NewGauge(prometheus.GaugeOpts{Name: "bytes"}),
+	}
+}
+
+// newColdBag sets up a bag promoted two windows ago and never requested since.
+func newColdBag() (*fakeDb, *fakeStorage, *service, *sync.Mutex) {
+	bagsDb := &fakeDb{promoted: map[string]db.PromotedBag{
+		"bag": {BagID: "bag", Size: 10, PromotedAt: time.Now().Add(-2 * time.Hour)},
+	}}
+	daemon := &fakeStorage{bags: map[string]bool{"bag": true}}
+	bagsLock := &sync.Mutex{}
+
+	svc := NewService(bagsDb, daemon, fakeRemote{}, Settings{
+		Window:        time.Hour,
+		HotThreshold:  10,
+		ColdThreshold: 1,
+	}, newTestMetrics(), bagsLock, slog.New(slog.DiscardHandler))
+
+	return bagsDb, daemon, svc.(*service), bagsLock
+}
+
+func TestCheckDemotesColdBag(t *testing.T) {
+	bagsDb, daemon, svc, _ := newColdBag()
+
+	if err := svc.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	if daemon.bags["bag"] || len(bagsDb.promoted) != 0 {
+		t.Fatalf("bag on daemon %v, promoted %v, want it demoted", daemon.bags["bag"], bagsDb.promoted)
+	}
+}
+
+func TestCheckKeepsBagPinnedDuringCheck(t *testing.T) {
+	bagsDb, daemon, svc, bagsLock := newColdBag()
+	pinsSvc := pins.NewService(bagsDb, daemon, bagsLock, slog.New(slog.DiscardHandler))
+
+	// The bag is pinned after Check has listed it as promoted
+	bagsDb.onList = func() {
+		if err := pinsSvc.AddPin(context.Background(), "bag", true); err != nil {
+			t.Fatalf("AddPin: %v", err)
+		}
+	}
+
+	if err := svc.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	if !daemon.bags["bag"] {
+		t.Fatal("pinned bag was removed from the daemon")
+	}
+
+	if len(bagsDb.promoted) != 0 {
+		t.Fatalf("promoted %v, want the pinned bag not promoted", bagsDb.promoted)
+	}
+}
@@ -0,0 +1,142 @@
+package quotas
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"mytonstorage-gateway/pkg/models"
+	"mytonstorage-gateway/pkg/models/db"
+)
+
+const (
+	// Usage is counted in windows of windowDuration, hourly and daily quotas
+	// are checked over the last hourWindows and dayWindows windows.
+	windowDuration = 10 * time.Minute
+	hourWindows    = int64(time.Hour / windowDuration)
+	dayWindows     = int64(24 * time.Hour / windowDuration)
+
+	// retention is how long counters are kept in the database
+	retention = 7 * 24 * time.Hour
+
+	subjectIP  = "ip"
+	subjectBag = "bag"
+)
+
+type usageDb interface {
+	AddBandwidthUsage(ctx context.Context, usage []db.BandwidthUsage, hourSince, daySince time.Time) ([]db.BandwidthTotal, error)
+	DeleteBandwidthUsage(ctx context.Context, before time.Time) error
+}
+
+// Limits are caps in bytes, zero means unlimited.
+type Limits struct {
+	IPHourly  uint64
+	IPDaily   uint64
+	BagHourly uint64
+	BagDaily  uint64
+}
+
+// service keeps the counters in the database only, so all gateway instances share the quotas.
+// Requests are not refused while the database is unavailable.
+type service struct {
+	db     usageDb
+	limits Limits
+	logger *slog.Logger
+}
+
+type Quotas interface {
+	Check(ctx context.Context, ip, bagID string) error
+	Add(ctx context.Context, ip, bagID string, n uint64) error
+	Run(ctx context.Context, cleanupInterval time.Duration)
+}
+
+// Check returns an error if the client or the bag has used up any of its quotas.
+func (s *service) Check(ctx context.Context, ip, bagID string) error {
+	return s.add(ctx, ip, bagID, 0)
+}
+
+// Add accounts n bytes served to the client from the bag. An error is returned
+// once any of the quotas is used up, the caller should stop sending then.
+func (s *service) Add(ctx context.Context, ip, bagID string, n uint64) error {
+	if n == 0 {
+		return nil
+	}
+
+	return s.add(ctx, ip, bagID, n)
+}
+
+// add increments the counters of the current window and checks the totals in one query,
+// Check adds zero bytes to read the totals the same way.
+func (s *service) add(ctx context.Context, ip, bagID string, n uint64) error {
+	now := windowOf(time.Now())
+	bagID = strings.ToLower(bagID)
+
+	usage := []db.BandwidthUsage{
+		{SubjectType: subjectIP, Subject: ip, WindowStart: windowStart(now), Bytes: n},
+		{SubjectType: subjectBag, Subject: bagID, WindowStart: windowStart(now), Bytes: n},
+	}
+
+	totals, err := s.db.AddBandwidthUsage(ctx, usage, windowStart(now-hourWindows+1), windowStart(now-dayWindows+1))
+	if err != nil {
+		s.logger.Error("failed to account bandwidth usage",
+			slog.String("ip", ip),
+			slog.String("bagID", bagID),
+			slog.String("error", err.Error()))
+		return nil
+	}
+
+	for _, t := range totals {
+		switch t.SubjectType {
+		case subjectIP:
+			if exceeded(t.Hourly, s.limits.IPHourly) || exceeded(t.Daily, s.limits.IPDaily) {
+				s.logger.Warn("client traffic quota exceeded", slog.String("ip", ip), slog.String("bagID", bagID))
+				return models.NewAppError(models.TooManyRequestsCode, "traffic quota exceeded, please try again later")
+			}
+		case subjectBag:
+			if exceeded(t.Hourly, s.limits.BagHourly) || exceeded(t.Daily, s.limits.BagDaily) {
+				s.logger.Warn("bag traffic quota exceeded", slog.String("ip", ip), slog.String("bagID", bagID))
+				return models.NewAppError(models.TooManyRequestsCode, "bag traffic quota exceeded, please try again later")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Run deletes counters older than retention every cleanupInterval until ctx is done.
+func (s *service) Run(ctx context.Context, cleanupInterval time.Duration) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.db.DeleteBandwidthUsage(ctx, time.Now().Add(-retention)); err != nil {
+				s.logger.Error("failed to delete old bandwidth usage", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+func exceeded(used, limit uint64) bool {
+	return limit > 0 && used >= limit
+}
+
+func windowOf(t time.Time) int64 {
+	return t.Unix() / int64(windowDuration/time.Second)
+}
+
+func windowStart(window int64) time.Time {
+	return time.Unix(window*int64(windowDuration/time.Second), 0).UTC()
+}
+
+func NewService(db usageDb, limits Limits, logger *slog.Logger) Quotas {
+	return &service{
+		db:     db,
+		limits: limits,
+		logger: logger,
+	}
+}
@@ -151,10 +151,11 @@ func (s *service) AddReport(ctx context.Context, report v1.Report) error {
 	}
 
 	dbReport := db.Report{
-		BagID:   report.BagID,
-		Reason:  report.Reason,
-		Sender:  report.Sender,
-		Comment: report.Comment,
+		BagID:    report.BagID,
+		Reason:   report.Reason,
+		Sender:   report.Sender,
+		SenderIP: report.SenderIP,
+		Comment:  report.Comment,
 	}
 
 	if err := s.files.AddReport(ctx, dbReport); err != nil {
@@ -0,0 +1,211 @@
+package thumbnails
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"golang.org/x/sync/singleflight"
+
+	"mytonstorage-gateway/pkg/constants"
+	"mytonstorage-gateway/pkg/models"
+)
+
+const (
+	// maxPixels protects from images which are small files but huge bitmaps
+	maxPixels = 50_000_000
+
+	jpegQuality = 80
+)
+
+// Sizes are the allowed thumbnail sizes in pixels, each one is cached separately
+var Sizes = []int{128, 256, 512}
+
+// formats are the names registered by the imported decoders
+var formats = []string{"jpeg", "png", "gif", "webp"}
+
+type service struct {
+	cacheDir string
+	// sem limits the number of images decoded and resized at once
+	sem    chan struct{}
+	group  singleflight.Group
+	logger *slog.Logger
+}
+
+type Thumbnails interface {
+	Get(ctx context.Context, bagID string, fileIndex uint32, size int, open func() (io.ReadCloser, error)) ([]byte, error)
+}
+
+// Get returns the JPEG thumbnail of the file, at most size pixels on each side.
+// The image is read with open only if the thumbnail is not in the disk cache yet.
+func (s *service) Get(ctx context.Context, bagID string, fileIndex uint32, size int, open func() (io.ReadCloser, error)) ([]byte, error) {
+	if !slices.Contains(Sizes, size) {
+		return nil, models.NewAppError(models.BadRequestErrorCode, "invalid thumbnail size")
+	}
+
+	bagID = strings.ToLower(bagID)
+	path := s.cachePath(bagID, fileIndex, size)
+	if data, err := os.ReadFile(path); err == nil {
+		return data, nil
+	}
+
+	log := s.logger.With(
+		slog.String("method", "Get"),
+		slog.String("bagID", bagID),
+		slog.Uint64("fileIndex", uint64(fileIndex)),
+		slog.Int("size", size),
+	)
+
+	// Concurrent requests for the same thumbnail wait for a single generation
+	v, err, _ := s.group.Do(path, func() (any, error) {
+		src, err := readSource(open)
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case s.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, models.NewAppError(models.TimeoutCode, "")
+		}
+		defer func() { <-s.sem }()
+
+		data, err := thumbnail(src, size)
+		if err != nil {
+			log.Warn("failed to generate thumbnail", slog.String("error", err.Error()))
+			return nil, err
+		}
+
+		if err := store(path, data); err != nil {
+			log.Error("failed to cache thumbnail", slog.String("error", err.Error()))
+		}
+
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]byte), nil
+}
+
+func (s *service) cachePath(bagID string, fileIndex uint32, size int) string {
+	return filepath.Join(s.cacheDir, bagID[:2], bagID, fmt.Sprintf("%d_%d.jpg", fileIndex, size))
+}
+
+func readSource(open func() (io.ReadCloser, error)) ([]byte, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	src, err := io.ReadAll(io.LimitReader(r, constants.MaxFileServeSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(src) > constants.MaxFileServeSize {
+		return nil, models.NewAppError(models.TooLargeCode, "image is too large for a thumbnail")
+	}
+
+	return src, nil
+}
+
+// thumbnail decodes the image and scales it down to fit into size x size, images are never scaled up.
+// Transparent areas are drawn over white, JPEG has no alpha channel.
+func thumbnail(src []byte, size int) ([]byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(src))
+	if err != nil || !slices.Contains(formats, format) {
+		return nil, models.NewAppError(models.BadRequestErrorCode, "unsupported image format")
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, models.NewAppError(models.TooLargeCode, "image is too large for a thumbnail")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return nil, models.NewAppError(models.BadRequestErrorCode, "failed to decode image")
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	xdraw.BiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// store writes the file atomically, readers never see a partially written thumbnail.
+func store(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(f.Name()))
+	}
+
+	return nil
+}
+
+// NewService creates the thumbnails service caching to cacheDir.
+// At most maxConcurrency images are processed at once, zero means one per CPU.
+func NewService(cacheDir string, maxConcurrency int, logger *slog.Logger) (Thumbnails, error) {
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if maxConcurrency <= 0 {
+		maxConcurrency = runtime.NumCPU()
+	}
+
+	return &service{
+		cacheDir: cacheDir,
+		sem:      make(chan struct{}, maxConcurrency),
+		logger:   logger,
+	}, nil
+}
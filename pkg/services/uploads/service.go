@@ -0,0 +1,714 @@
+package uploads
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mytonstorage-gateway/pkg/constants"
+	"mytonstorage-gateway/pkg/models"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
+	"mytonstorage-gateway/pkg/models/db"
+)
+
+const (
+	maxDescriptionLength = 1024
+
+	sessionsDir = "sessions"
+	filesDir    = "files"
+	// bagsDir keeps files of created bags, the daemon seeds them from there, so they are never removed
+	bagsDir = "bags"
+
+	sessionFile = "session.json"
+)
+
+// Settings of uploads, sizes are in bytes.
+type Settings struct {
+	// StagingDir is where files are written, DaemonDir is the same directory as seen by the daemon
+	StagingDir string
+	DaemonDir  string
+	// MaxBagSize caps the size of one bag, zero means unlimited
+	MaxBagSize uint64
+	// DefaultQuota caps the total size of bags created with an access token, zero means unlimited.
+	// TokenQuotas override it per token, format: "hash:bytes".
+	DefaultQuota uint64
+	TokenQuotas  []string
+	// Sessions without new data for SessionTTL are removed with their files
+	SessionTTL time.Duration
+}
+
+type uploadsDb interface {
+	AddUpload(ctx context.Context, upload db.Upload) error
+	GetUploadedBytes(ctx context.Context, tokenHash string) (uint64, error)
+}
+
+type storage interface {
+	CreateBag(ctx context.Context, path, description string) (string, error)
+}
+
+// session is persisted next to its files, so uploads can be resumed after a restart.
+type session struct {
+	ID          string `json:"id"`
+	TokenHash   string `json:"token_hash"`
+	Description string `json:"description"`
+	// Files holds the declared sizes by path
+	Files     map[string]uint64 `json:"files"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+
+	// writing holds the paths being written, a file accepts one writer at a time
+	writing    map[string]bool
+	completing bool
+
+	// received holds the bytes written by path, dirs the directories of the declared files
+	// and size their total declared size, so the state is never read from the disk under mu
+	received map[string]uint64
+	dirs     map[string]bool
+	size     uint64
+
+	// saveMu orders writes of the metadata, they are done without mu held
+	saveMu sync.Mutex
+}
+
+// addFile declares the file of total bytes.
+func (sess *session) addFile(path string, total uint64) {
+	sess.Files[path] = total
+	sess.size += total
+
+	for i := strings.LastIndexByte(path, '/'); i > 0; i = strings.LastIndexByte(path[:i], '/') {
+		sess.dirs[path[:i]] = true
+	}
+}
+
+// conflict returns the declared path that is a file where path needs a directory or vice versa.
+func (sess *session) conflict(path string) (string, bool) {
+	if sess.dirs[path] {
+		return path + "/", true
+	}
+
+	for i := strings.LastIndexByte(path, '/'); i > 0; i = strings.LastIndexByte(path[:i], '/') {
+		if _, ok := sess.Files[path[:i]]; ok {
+			return path[:i], true
+		}
+	}
+
+	return "", false
+}
+
+func newSession(id, tokenHash, description string, files map[string]uint64) *session {
+	sess := &session{
+		ID:          id,
+		TokenHash:   tokenHash,
+		Description: description,
+		Files:       make(map[string]uint64, len(files)),
+		writing:     make(map[string]bool),
+		received:    make(map[string]uint64),
+		dirs:        make(map[string]bool),
+	}
+
+	for path, total := range files {
+		sess.addFile(path, total)
+	}
+
+	return sess
+}
+
+type service struct {
+	db          uploadsDb
+	tonstorage  storage
+	settings    Settings
+	tokenQuotas map[string]uint64
+	logger      *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+type Uploads interface {
+	CreateSession(ctx context.Context, tokenHash, description string) (v1.UploadSession, error)
+	GetSession(ctx context.Context, tokenHash, id string) (v1.UploadSession, error)
+	WriteFile(ctx context.Context, tokenHash, id, path string, offset, total uint64, data io.Reader, length uint64) (v1.UploadFile, error)
+	Complete(ctx context.Context, tokenHash, id string) (v1.UploadResult, error)
+	Abort(ctx context.Context, tokenHash, id string) error
+	Load(ctx context.Context) error
+	Run(ctx context.Context, interval time.Duration)
+}
+
+func (s *service) CreateSession(ctx context.Context, tokenHash, description string) (v1.UploadSession, error) {
+	log := s.logger.With(slog.String("method", "CreateSession"))
+
+	if len(description) > maxDescriptionLength {
+		return v1.UploadSession{}, models.NewAppError(models.BadRequestErrorCode, "description is too long")
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		log.Error("failed to generate session id", slog.String("error", err.Error()))
+		return v1.UploadSession{}, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	now := time.Now()
+	sess := newSession(hex.EncodeToString(b[:]), tokenHash, description, nil)
+	sess.CreatedAt = now
+	sess.UpdatedAt = now
+
+	if err := os.MkdirAll(filepath.Join(s.sessionDir(sess.ID), filesDir), 0o755); err != nil {
+		log.Error("failed to create session directory", slog.String("error", err.Error()))
+		return v1.UploadSession{}, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	if err := s.save(sess); err != nil {
+		log.Error("failed to save session", slog.String("error", err.Error()))
+		_ = os.RemoveAll(s.sessionDir(sess.ID))
+		return v1.UploadSession{}, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	s.mu.Lock()
+	s.sessions[sess.ID] = sess
+	result := s.toSession(sess)
+	s.mu.Unlock()
+
+	log.Info("upload session created", slog.String("id", sess.ID))
+
+	return result, nil
+}
+
+func (s *service) GetSession(ctx context.Context, tokenHash, id string) (v1.UploadSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || sess.TokenHash != tokenHash {
+		return v1.UploadSession{}, models.NewAppError(models.NotFoundErrorCode, "upload session not found")
+	}
+
+	return s.toSession(sess), nil
+}
+
+// WriteFile writes length bytes of data at offset of the file, total is the size of the whole file.
+// Chunks are appended, so offset must be the number of bytes received so far, see GetSession.
+// The size is reserved against the quota of the token on the first chunk.
+func (s *service) WriteFile(ctx context.Context, tokenHash, id, path string, offset, total uint64, data io.Reader, length uint64) (v1.UploadFile, error) {
+	log := s.logger.With(
+		slog.String("method", "WriteFile"),
+		slog.String("id", id),
+		slog.String("path", path),
+		slog.Uint64("offset", offset),
+		slog.Uint64("total", total),
+	)
+
+	path, ok := cleanPath(path)
+	if !ok {
+		return v1.UploadFile{}, models.NewAppError(models.BadRequestErrorCode, "invalid path")
+	}
+
+	if offset+length > total {
+		return v1.UploadFile{}, models.NewAppError(models.BadRequestErrorCode, "chunk exceeds file size")
+	}
+
+	var uploaded uint64
+	if offset == 0 && s.quota(tokenHash) > 0 {
+		var err error
+		if uploaded, err = s.db.GetUploadedBytes(ctx, tokenHash); err != nil {
+			log.Error("failed to get uploaded bytes", slog.String("error", err.Error()))
+			return v1.UploadFile{}, models.NewAppError(models.InternalServerErrorCode, "")
+		}
+	}
+
+	s.mu.Lock()
+	sess, err := s.reserve(tokenHash, id, path, offset, total, uploaded)
+	if err != nil {
+		s.mu.Unlock()
+		return v1.UploadFile{}, err
+	}
+	s.mu.Unlock()
+
+	// received is the size of the file on disk once it's known
+	received := int64(-1)
+	defer func() {
+		s.mu.Lock()
+		if received >= 0 {
+			sess.received[path] = uint64(received)
+		}
+		sess.UpdatedAt = time.Now()
+		s.mu.Unlock()
+
+		// The file is released after the save, so the session can't be completed or removed meanwhile
+		if err := s.save(sess); err != nil {
+			log.Error("failed to save session", slog.String("error", err.Error()))
+		}
+
+		s.mu.Lock()
+		delete(sess.writing, path)
+		s.mu.Unlock()
+	}()
+
+	name := s.filePath(id, path)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		log.Error("failed to create directory", slog.String("error", err.Error()))
+		return v1.UploadFile{}, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		log.Error("failed to open file", slog.String("error", err.Error()))
+		return v1.UploadFile{}, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Error("failed to stat file", slog.String("error", err.Error()))
+		return v1.UploadFile{}, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	received = info.Size()
+	if uint64(info.Size()) != offset {
+		return v1.UploadFile{}, models.NewAppError(models.ConflictCode, fmt.Sprintf("upload offset mismatch, expected %d", info.Size()))
+	}
+
+	if _, err = f.Seek(int64(offset), io.SeekStart); err != nil {
+		log.Error("failed to seek file", slog.String("error", err.Error()))
+		return v1.UploadFile{}, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	// Bytes written before a failure stay, the upload is resumed from them
+	n, err := io.CopyN(f, &ctxReader{ctx: ctx, r: data}, int64(length))
+	received += n
+	if err != nil {
+		log.Error("failed to write file", slog.Int64("written", n), slog.String("error", err.Error()))
+		return v1.UploadFile{}, models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	return v1.UploadFile{
+		Path:     path,
+		Size:     total,
+		Received: offset + uint64(n),
+	}, nil
+}
+
+// reserve checks the chunk against the session and marks the file as being written. Must be called with mu held.
+func (s *service) reserve(tokenHash, id, path string, offset, total, uploaded uint64) (*session, error) {
+	sess, ok := s.sessions[id]
+	if !ok || sess.TokenHash != tokenHash {
+		return nil, models.NewAppError(models.NotFoundErrorCode, "upload session not found")
+	}
+
+	if sess.completing {
+		return nil, models.NewAppError(models.ConflictCode, "upload session is being completed")
+	}
+
+	if sess.writing[path] {
+		return nil, models.NewAppError(models.ConflictCode, "file is being uploaded")
+	}
+
+	if declared, ok := sess.Files[path]; ok {
+		if declared != total {
+			return nil, models.NewAppError(models.ConflictCode, fmt.Sprintf("file size mismatch, expected %d", declared))
+		}
+	} else {
+		if offset != 0 {
+			return nil, models.NewAppError(models.ConflictCode, "upload offset mismatch, expected 0")
+		}
+
+		if err := s.declare(sess, path, total, uploaded); err != nil {
+			return nil, err
+		}
+	}
+
+	sess.writing[path] = true
+
+	return sess, nil
+}
+
+// declare adds the file to the session if it fits into the limits. Must be called with mu held.
+func (s *service) declare(sess *session, path string, total, uploaded uint64) error {
+	if len(sess.Files) >= constants.MaxUploadFiles {
+		return models.NewAppError(models.BadRequestErrorCode, "too many files")
+	}
+
+	if p, ok := sess.conflict(path); ok {
+		return models.NewAppError(models.ConflictCode, "path conflicts with "+p)
+	}
+
+	if s.settings.MaxBagSize > 0 && sess.size+total > s.settings.MaxBagSize {
+		return models.NewAppError(models.TooLargeCode, "bag is too large")
+	}
+
+	// Files of unfinished sessions are counted as uploaded
+	if quota := s.quota(sess.TokenHash); quota > 0 {
+		used := uploaded
+		for _, other := range s.sessions {
+			if other.TokenHash == sess.TokenHash {
+				used += other.size
+			}
+		}
+
+		if used+total > quota {
+			return models.NewAppError(models.TooLargeCode, "upload quota exceeded")
+		}
+	}
+
+	sess.addFile(path, total)
+
+	return nil
+}
+
+// Complete creates the bag from the session files once all of them are uploaded.
+func (s *service) Complete(ctx context.Context, tokenHash, id string) (v1.UploadResult, error) {
+	log := s.logger.With(
+		slog.String("method", "Complete"),
+		slog.String("id", id),
+	)
+
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	if !ok || sess.TokenHash != tokenHash {
+		s.mu.Unlock()
+		return v1.UploadResult{}, models.NewAppError(models.NotFoundErrorCode, "upload session not found")
+	}
+
+	if sess.completing || len(sess.writing) > 0 {
+		s.mu.Unlock()
+		return v1.UploadResult{}, models.NewAppError(models.ConflictCode, "upload session is busy")
+	}
+
+	if len(sess.Files) == 0 {
+		s.mu.Unlock()
+		return v1.UploadResult{}, models.NewAppError(models.BadRequestErrorCode, "upload session has no files")
+	}
+
+	result := s.toSession(sess)
+	if result.Received != result.Size {
+		s.mu.Unlock()
+		return v1.UploadResult{}, models.NewAppError(models.ConflictCode, "upload is not complete")
+	}
+
+	sess.completing = true
+	s.mu.Unlock()
+
+	staged := filepath.Join(s.sessionDir(id), filesDir)
+	target := filepath.Join(s.settings.StagingDir, bagsDir, id)
+
+	bagID, err := s.createBag(ctx, staged, target, sess.Description, log)
+	if err != nil {
+		s.mu.Lock()
+		sess.completing = false
+		s.mu.Unlock()
+
+		return v1.UploadResult{}, err
+	}
+
+	err = s.db.AddUpload(ctx, db.Upload{
+		BagID:       bagID,
+		TokenHash:   tokenHash,
+		Size:        result.Size,
+		FilesCount:  len(result.Files),
+		Description: sess.Description,
+	})
+	if err != nil {
+		// The bag exists already, only the quota accounting is lost
+		log.Error("failed to add upload", slog.String("bagID", bagID), slog.String("error", err.Error()))
+	}
+
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+
+	if err := os.RemoveAll(s.sessionDir(id)); err != nil {
+		log.Error("failed to remove session directory", slog.String("error", err.Error()))
+	}
+
+	log.Info("bag created from upload", slog.String("bagID", bagID), slog.Uint64("size", result.Size))
+
+	return v1.UploadResult{
+		BagID:      bagID,
+		Size:       result.Size,
+		FilesCount: len(result.Files),
+	}, nil
+}
+
+// createBag moves the staged files out of the session directory and asks the daemon to create the bag of them.
+// The files are moved back if the daemon fails.
+func (s *service) createBag(ctx context.Context, staged, target, description string, log *slog.Logger) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		log.Error("failed to create bags directory", slog.String("error", err.Error()))
+		return "", models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	if err := os.Rename(staged, target); err != nil {
+		log.Error("failed to move staged files", slog.String("error", err.Error()))
+		return "", models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	daemonDir := s.settings.DaemonDir
+	if daemonDir == "" {
+		daemonDir = s.settings.StagingDir
+	}
+
+	bagID, err := s.tonstorage.CreateBag(ctx, filepath.Join(daemonDir, bagsDir, filepath.Base(target)), description)
+	if err != nil {
+		log.Error("failed to create bag", slog.String("error", err.Error()))
+		if rErr := os.Rename(target, staged); rErr != nil {
+			log.Error("failed to move staged files back", slog.String("error", rErr.Error()))
+		}
+
+		return "", models.NewAppError(models.InternalServerErrorCode, "failed to create bag")
+	}
+
+	return bagID, nil
+}
+
+// Abort removes the session with its files.
+func (s *service) Abort(ctx context.Context, tokenHash, id string) error {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	if !ok || sess.TokenHash != tokenHash {
+		s.mu.Unlock()
+		return models.NewAppError(models.NotFoundErrorCode, "upload session not found")
+	}
+
+	if sess.completing || len(sess.writing) > 0 {
+		s.mu.Unlock()
+		return models.NewAppError(models.ConflictCode, "upload session is busy")
+	}
+
+	delete(s.sessions, id)
+	s.mu.Unlock()
+
+	if err := os.RemoveAll(s.sessionDir(id)); err != nil {
+		s.logger.Error("failed to remove session directory", slog.String("id", id), slog.String("error", err.Error()))
+		return models.NewAppError(models.InternalServerErrorCode, "")
+	}
+
+	return nil
+}
+
+// Load restores the sessions staged on disk.
+func (s *service) Load(ctx context.Context) error {
+	dir := filepath.Join(s.settings.StagingDir, sessionsDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	sessions := make(map[string]*session, len(entries))
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name(), sessionFile))
+		if err != nil {
+			s.logger.Warn("failed to read upload session", slog.String("id", e.Name()), slog.String("error", err.Error()))
+			continue
+		}
+
+		var stored session
+		if err := json.Unmarshal(data, &stored); err != nil || stored.ID != e.Name() {
+			s.logger.Warn("invalid upload session", slog.String("id", e.Name()))
+			continue
+		}
+
+		sess := newSession(stored.ID, stored.TokenHash, stored.Description, stored.Files)
+		sess.CreatedAt = stored.CreatedAt
+		sess.UpdatedAt = stored.UpdatedAt
+
+		// The files are the source of truth after a restart
+		for path, total := range sess.Files {
+			if info, err := os.Stat(s.filePath(sess.ID, path)); err == nil {
+				sess.received[path] = min(uint64(info.Size()), total)
+			}
+		}
+
+		sessions[sess.ID] = sess
+	}
+
+	s.mu.Lock()
+	for id, sess := range sessions {
+		s.sessions[id] = sess
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Run removes expired sessions every interval until ctx is done.
+func (s *service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.removeExpired(time.Now())
+		}
+	}
+}
+
+func (s *service) removeExpired(now time.Time) {
+	var expired []string
+
+	s.mu.Lock()
+	for id, sess := range s.sessions {
+		if sess.completing || len(sess.writing) > 0 || now.Sub(sess.UpdatedAt) < s.settings.SessionTTL {
+			continue
+		}
+
+		delete(s.sessions, id)
+		expired = append(expired, id)
+	}
+	s.mu.Unlock()
+
+	for _, id := range expired {
+		if err := os.RemoveAll(s.sessionDir(id)); err != nil {
+			s.logger.Error("failed to remove expired upload session", slog.String("id", id), slog.String("error", err.Error()))
+			continue
+		}
+
+		s.logger.Info("expired upload session removed", slog.String("id", id))
+	}
+}
+
+// toSession reports the state of the session. Must be called with mu held.
+func (s *service) toSession(sess *session) v1.UploadSession {
+	result := v1.UploadSession{
+		ID:          sess.ID,
+		Description: sess.Description,
+		Files:       make([]v1.UploadFile, 0, len(sess.Files)),
+		CreatedAt:   uint64(sess.CreatedAt.Unix()),
+		UpdatedAt:   uint64(sess.UpdatedAt.Unix()),
+		ExpiresAt:   uint64(sess.UpdatedAt.Add(s.settings.SessionTTL).Unix()),
+	}
+
+	for path, size := range sess.Files {
+		received := min(sess.received[path], size)
+
+		result.Files = append(result.Files, v1.UploadFile{
+			Path:     path,
+			Size:     size,
+			Received: received,
+		})
+		result.Size += size
+		result.Received += received
+	}
+
+	sort.Slice(result.Files, func(i, j int) bool {
+		return result.Files[i].Path < result.Files[j].Path
+	})
+
+	return result
+}
+
+// save writes the session metadata next to its files. Must be called without mu held,
+// the metadata is copied under it and written after.
+func (s *service) save(sess *session) error {
+	sess.saveMu.Lock()
+	defer sess.saveMu.Unlock()
+
+	s.mu.Lock()
+	data, err := json.Marshal(sess)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Join(s.sessionDir(sess.ID), sessionFile)
+	if err := os.WriteFile(name+".tmp", data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(name+".tmp", name)
+}
+
+func (s *service) sessionDir(id string) string {
+	return filepath.Join(s.settings.StagingDir, sessionsDir, id)
+}
+
+func (s *service) filePath(id, path string) string {
+	return filepath.Join(s.sessionDir(id), filesDir, filepath.FromSlash(path))
+}
+
+func (s *service) quota(tokenHash string) uint64 {
+	if quota, ok := s.tokenQuotas[tokenHash]; ok {
+		return quota
+	}
+
+	return s.settings.DefaultQuota
+}
+
+// cleanPath validates the relative path of an uploaded file.
+func cleanPath(p string) (string, bool) {
+	p = strings.TrimPrefix(p, "/")
+	if p == "" || len(p) > constants.MaxPathLength || strings.ContainsAny(p, "\x00\\") {
+		return "", false
+	}
+
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return "", false
+		}
+	}
+
+	return p, true
+}
+
+// ctxReader stops reading once the request is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
+}
+
+func parseTokenQuotas(quotas []string, logger *slog.Logger) map[string]uint64 {
+	result := make(map[string]uint64)
+
+	for _, q := range quotas {
+		q = strings.TrimSpace(q)
+		if q == "" {
+			continue
+		}
+
+		tokenHash, bytes, ok := strings.Cut(q, ":")
+		size, err := strconv.ParseUint(strings.TrimSpace(bytes), 10, 64)
+		if !ok || err != nil {
+			logger.Warn("invalid upload quota", slog.String("quota", q))
+			continue
+		}
+
+		result[strings.TrimSpace(tokenHash)] = size
+	}
+
+	return result
+}
+
+func NewService(db uploadsDb, tonstorage storage, settings Settings, logger *slog.Logger) Uploads {
+	return &service{
+		db:          db,
+		tonstorage:  tonstorage,
+		settings:    settings,
+		tokenQuotas: parseTokenQuotas(settings.TokenQuotas, logger),
+		logger:      logger,
+		sessions:    make(map[string]*session),
+	}
+}
@@ -0,0 +1,115 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"mytonstorage-gateway/pkg/models"
+	"mytonstorage-gateway/pkg/models/db"
+)
+
+type fakeUploadsDb struct{}
+
+func (fakeUploadsDb) AddUpload(context.Context, db.Upload) error {
+	return nil
+}
+
+func (fakeUploadsDb) GetUploadedBytes(context.Context, string) (uint64, error) {
+	return 0, nil
+}
+
+func newTestService(t *testing.T) Uploads {
+	t.Helper()
+
+	return NewService(fakeUploadsDb{}, nil, Settings{StagingDir: t.TempDir()}, slog.New(slog.DiscardHandler))
+}
+
+func write(t *testing.T, svc Uploads, id, path string, offset, total uint64, data string) error {
+	t.Helper()
+
+	_, err := svc.WriteFile(context.Background(), "token", id, path, offset, total, strings.NewReader(data), uint64(len(data)))
+	return err
+}
+
+func errorCode(err error) int {
+	var appErr *models.AppError
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+
+	return 0
+}
+
+func TestWriteFilePathConflicts(t *testing.T) {
+	svc := newTestService(t)
+
+	sess, err := svc.CreateSession(context.Background(), "token", "")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	if err := write(t, svc, sess.ID, "a/b/c.txt", 0, 1, "c"); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	for _, path := range []string{"a", "a/b", "a/b/c.txt/d"} {
+		if err := write(t, svc, sess.ID, path, 0, 1, "x"); errorCode(err) != models.ConflictCode {
+			t.Errorf("WriteFile(%q) error = %v, want conflict", path, err)
+		}
+	}
+
+	for _, path := range []string{"a/b/d.txt", "a/bb", "ab"} {
+		if err := write(t, svc, sess.ID, path, 0, 1, "x"); err != nil {
+			t.Errorf("WriteFile(%q): %v", path, err)
+		}
+	}
+}
+
+func TestWriteFileTracksReceivedBytes(t *testing.T) {
+	svc := newTestService(t)
+
+	sess, err := svc.CreateSession(context.Background(), "token", "")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	if err := write(t, svc, sess.ID, "f.txt", 0, 6, "abc"); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	// A wrong offset must not change what the session reports as received
+	if err := write(t, svc, sess.ID, "f.txt", 5, 6, "f"); errorCode(err) != models.ConflictCode {
+		t.Fatalf("WriteFile at wrong offset error = %v, want conflict", err)
+	}
+
+	got, err := svc.GetSession(context.Background(), "token", sess.ID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+
+	if got.Size != 6 || got.Received != 3 {
+		t.Fatalf("session size %d received %d, want 6 and 3", got.Size, got.Received)
+	}
+
+	if err := write(t, svc, sess.ID, "f.txt", 3, 6, "def"); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	// Received bytes are restored from the staged files after a restart
+	restored := NewService(fakeUploadsDb{}, nil, svc.(*service).settings, slog.New(slog.DiscardHandler))
+	if err := restored.Load(context.Background()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	got, err = restored.GetSession(context.Background(), "token", sess.ID)
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+
+	if got.Size != 6 || got.Received != 6 {
+		t.Fatalf("restored session size %d received %d, want 6 and 6", got.Size, got.Received)
+	}
+}
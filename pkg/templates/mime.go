@@ -0,0 +1,198 @@
+package htmlTemplates
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	mimeOctetStream = "application/octet-stream"
+
+	// SniffLength is the number of leading bytes needed by SniffContentType
+	SniffLength = 512
+)
+
+// mimeTypes maps lowercase file extensions to media types.
+var mimeTypes = map[string]string{
+	// images
+	"apng": "image/apng",
+	"avif": "image/avif",
+	"bmp":  "image/bmp",
+	"gif":  "image/gif",
+	"heic": "image/heic",
+	"heif": "image/heif",
+	"ico":  "image/vnd.microsoft.icon",
+	"jpeg": "image/jpeg",
+	"jpg":  "image/jpeg",
+	"jfif": "image/jpeg",
+	"png":  "image/png",
+	"svg":  "image/svg+xml",
+	"tif":  "image/tiff",
+	"tiff": "image/tiff",
+	"webp": "image/webp",
+
+	// video
+	"3gp":  "video/3gpp",
+	"avi":  "video/x-msvideo",
+	"flv":  "video/x-flv",
+	"m4v":  "video/mp4",
+	"mkv":  "video/x-matroska",
+	"mov":  "video/quicktime",
+	"mp4":  "video/mp4",
+	"mpeg": "video/mpeg",
+	"mpg":  "video/mpeg",
+	"ogv":  "video/ogg",
+	"webm": "video/webm",
+	"wmv":  "video/x-ms-wmv",
+
+	// audio
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"m4a":  "audio/mp4",
+	"mid":  "audio/midi",
+	"midi": "audio/midi",
+	"mp3":  "audio/mpeg",
+	"oga":  "audio/ogg",
+	"ogg":  "audio/ogg",
+	"opus": "audio/opus",
+	"wav":  "audio/wav",
+	"weba": "audio/webm",
+
+	// text
+	"c":     "text/plain",
+	"cfg":   "text/plain",
+	"conf":  "text/plain",
+	"cpp":   "text/plain",
+	"css":   "text/css",
+	"csv":   "text/csv",
+	"go":    "text/plain",
+	"h":     "text/plain",
+	"hpp":   "text/plain",
+	"htm":   "text/html",
+	"html":  "text/html",
+	"ini":   "text/plain",
+	"java":  "text/plain",
+	"js":    "text/javascript",
+	"log":   "text/plain",
+	"md":    "text/plain", // browsers download text/markdown instead of displaying it
+	"mjs":   "text/javascript",
+	"php":   "text/plain",
+	"py":    "text/plain",
+	"rb":    "text/plain",
+	"rs":    "text/plain",
+	"sh":    "text/plain",
+	"sql":   "text/plain",
+	"toml":  "text/plain",
+	"ts":    "text/plain",
+	"tsv":   "text/tab-separated-values",
+	"tsx":   "text/plain",
+	"txt":   "text/plain",
+	"vtt":   "text/vtt",
+	"xhtml": "application/xhtml+xml",
+	"yaml":  "text/plain",
+	"yml":   "text/plain",
+
+	// documents and data
+	"epub": "application/epub+zip",
+	"json": "application/json",
+	"map":  "application/json",
+	"pdf":  "application/pdf",
+	"wasm": "application/wasm",
+	"xml":  "application/xml",
+	"doc":  "application/msword",
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"odt":  "application/vnd.oasis.opendocument.text",
+	"ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	"ppt":  "application/vnd.ms-powerpoint",
+	"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"rtf":  "application/rtf",
+	"xls":  "application/vnd.ms-excel",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+
+	// fonts
+	"eot":   "application/vnd.ms-fontobject",
+	"otf":   "font/otf",
+	"ttf":   "font/ttf",
+	"woff":  "font/woff",
+	"woff2": "font/woff2",
+
+	// archives and binaries
+	"7z":      "application/x-7z-compressed",
+	"apk":     "application/vnd.android.package-archive",
+	"boc":     mimeOctetStream,
+	"bz2":     "application/x-bzip2",
+	"deb":     "application/vnd.debian.binary-package",
+	"dmg":     "application/x-apple-diskimage",
+	"exe":     "application/vnd.microsoft.portable-executable",
+	"gz":      "application/gzip",
+	"iso":     "application/x-iso9660-image",
+	"jar":     "application/java-archive",
+	"rar":     "application/vnd.rar",
+	"tar":     "application/x-tar",
+	"tgz":     "application/gzip",
+	"torrent": "application/x-bittorrent",
+	"xz":      "application/x-xz",
+	"zip":     "application/zip",
+	"zst":     "application/zstd",
+}
+
+// inlineApplicationTypes are application/* types browsers can display by themselves.
+var inlineApplicationTypes = []string{
+	"application/json",
+	"application/pdf",
+	"application/wasm",
+	"application/xml",
+}
+
+// mimeForExtension returns the registered media type for the extension without the dot.
+func mimeForExtension(ext string) (string, bool) {
+	m, ok := mimeTypes[strings.ToLower(ext)]
+	return m, ok
+}
+
+func isInlineType(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"),
+		strings.HasPrefix(mimeType, "video/"),
+		strings.HasPrefix(mimeType, "audio/"),
+		strings.HasPrefix(mimeType, "text/"),
+		strings.HasPrefix(mimeType, "font/"):
+		return true
+	}
+
+	return slices.Contains(inlineApplicationTypes, mimeType)
+}
+
+func withCharset(mimeType string) string {
+	if strings.HasPrefix(mimeType, "text/") || mimeType == "application/json" ||
+		mimeType == "application/xml" || mimeType == "application/xhtml+xml" {
+		return mimeType + "; charset=utf-8"
+	}
+
+	return mimeType
+}
+
+// sniff detects the media type from the leading bytes of the content.
+// The second result reports markup which is able to run scripts (HTML, XML, SVG).
+func sniff(head []byte) (string, bool) {
+	if len(head) > SniffLength {
+		head = head[:SniffLength]
+	}
+
+	detected := http.DetectContentType(head)
+	mimeType, _, _ := strings.Cut(detected, ";")
+	mimeType = strings.TrimSpace(mimeType)
+
+	switch mimeType {
+	case "text/html", "text/xml":
+		return mimeType, true
+	case "text/plain":
+		if bytes.Contains(bytes.ToLower(head), []byte("<svg")) {
+			return "image/svg+xml", true
+		}
+	}
+
+	return mimeType, false
+}
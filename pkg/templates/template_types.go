@@ -1,5 +1,7 @@
 package htmlTemplates
 
+import "html/template"
+
 type TemplateData struct {
 	Title       string
 	FullPath    string
@@ -7,15 +9,132 @@ type TemplateData struct {
 	Description string
 	PeersCount  int
 	FileCount   int
+	ArchiveHref string
 	ParentDir   *ParentDirData
 	Files       []FileData
+	// Gallery shows the files as a grid of thumbnails, set when most of them are images
+	Gallery bool
+	// BaseHref is the directory URL, relative links of the README are resolved against it
+	BaseHref string
+	Readme   *ReadmeData
+	// DirHref is the directory URL without the listing options, the filter form is sent to it
+	DirHref   string
+	Query     string
+	Sort      string
+	Order     string
+	SortLinks []SortLinkData
+	// Pager is set if the entries don't fit on one page
+	Pager *PagerData
+}
+
+// Listing describes which entries of the directory are shown, Total is the number
+// of entries matching the filter on all pages.
+type Listing struct {
+	Sort  string
+	Order string
+	Query string
+	// Search is the recursive search query, empty for directory listings
+	Search  string
+	Page    int
+	PerPage int
+	Total   int
+}
+
+type SortLinkData struct {
+	Label  string
+	Href   string
+	Active bool
+	Arrow  string
+}
+
+type PagerData struct {
+	Page     int
+	Pages    int
+	Total    int
+	PrevHref string
+	NextHref string
+}
+
+type SearchData struct {
+	Title    string
+	FullPath string
+	Search   string
+	Query    string
+	Sort     string
+	Order    string
+	// DirHref is the searched directory URL
+	DirHref   string
+	Results   []SearchResultData
+	Total     int
+	Truncated bool
+	SortLinks []SortLinkData
+	Pager     *PagerData
+}
+
+type SearchResultData struct {
+	Path          string
+	Href          string
+	Icon          string
+	FormattedSize string
+}
+
+type MarkdownData struct {
+	Title        string
+	FullPath     string
+	BaseHref     string
+	ParentHref   string
+	RawHref      string
+	DownloadHref string
+	Content      template.HTML
+}
+
+type PreviewData struct {
+	Title        string
+	FullPath     string
+	Name         string
+	BagID        string
+	Path         string
+	Size         string
+	Kind         string
+	ParentHref   string
+	MediaHref    string
+	RawHref      string
+	DownloadHref string
+	MimeType     string
+	// Lines of highlighted source, TooLarge is set instead if the file is too large to preview
+	Lines    []PreviewLine
+	TooLarge bool
+}
+
+type PreviewLine struct {
+	Number int
+	HTML   template.HTML
+}
+
+// Readme is a README file found in the listed directory
+type Readme struct {
+	Name    string
+	Content []byte
+}
+
+type ReadmeData struct {
+	Name       string
+	IsMarkdown bool
+	Content    template.HTML
 }
 
 type ContentType struct {
-	Header     string
-	Value      string
+	MimeType   string
 	IsDownload bool
 	IsHtml     bool
+	// IsMarkdown files are rendered to HTML unless the raw file is requested
+	IsMarkdown bool
+	// Preview is the kind of the ?view=preview page, empty if there is none for the file
+	Preview string
+	// NeedsSniffing is set for unknown extensions, the type should be detected from the content
+	NeedsSniffing bool
+	// ForceDownload can't be overridden by the client, set for sniffed markup
+	ForceDownload bool
 }
 
 type ParentDirData struct {
@@ -27,4 +146,6 @@ type FileData struct {
 	Href          string
 	Icon          string
 	FormattedSize string
+	// Thumb is the image preview URL in the gallery
+	Thumb string
 }
@@ -1,11 +1,18 @@
 package htmlTemplates
 
 import (
+	"fmt"
 	"html/template"
+	"net/url"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 
+	"mytonstorage-gateway/pkg/constants"
+	"mytonstorage-gateway/pkg/highlight"
+	"mytonstorage-gateway/pkg/markdown"
+	v1 "mytonstorage-gateway/pkg/models/api/v1"
 	"mytonstorage-gateway/pkg/models/private"
 	"mytonstorage-gateway/pkg/utils"
 )
@@ -18,7 +25,29 @@ var (
 	audioFormats = []string{"mp3", "wav", "ogg", "flac", "aac", "m4a"}
 	textFormats  = []string{"txt", "md", "csv", "json", "xml", "html", "htm", "xhtml", "css", "js", "ts", "py", "go", "java", "c", "cpp", "h", "php", "rb", "sh"}
 
-	htmlFormats = []string{"html", "htm", "xhtml"}
+	htmlFormats     = []string{"html", "htm", "xhtml"}
+	markdownFormats = []string{"md"}
+
+	// thumbnailFormats can be shown in the gallery with thumbnails, SVG is shown as is
+	thumbnailFormats = []string{"jpg", "jpeg", "png", "gif", "webp"}
+)
+
+// Listing options, the same values are accepted by the ?sort and ?order query parameters
+const (
+	listingSortName  = "name"
+	listingSortSize  = "size"
+	listingOrderAsc  = "asc"
+	listingOrderDesc = "desc"
+)
+
+// Gallery thumbnails size in pixels
+const galleryThumbSize = 256
+
+// Preview page kinds
+const (
+	PreviewText  = "text"
+	PreviewVideo = "video"
+	PreviewAudio = "audio"
 )
 
 type htmlTemplates struct {
@@ -27,74 +56,74 @@ type htmlTemplates struct {
 
 type Templates interface {
 	ContentType(filename string) ContentType
-	HtmlFilesListWithTemplate(f private.FolderInfo, path string) (string, error)
+	SniffContentType(head []byte) ContentType
+	HtmlFilesListWithTemplate(f private.FolderInfo, path string, readme *Readme, listing Listing) (string, error)
+	SearchWithTemplate(result v1.SearchResult, listing Listing) (string, error)
+	MarkdownWithTemplate(f private.FolderInfo, path string, content []byte) (string, error)
+	PreviewWithTemplate(f private.FolderInfo, path string, size uint64, content []byte) (string, error)
 }
 
-// ContentType returns the appropriate Content-Type header and value based on the file extension.
-// If the file type is not recognized, it returns a Content-Disposition header to prompt download.
+// ContentType returns the media type and disposition based on the file extension.
+// If the extension is not registered, NeedsSniffing is set and SniffContentType should be used.
 func (t *htmlTemplates) ContentType(filename string) ContentType {
-	ext := strings.ToLower(filepath.Ext(filename))
-	ext = strings.TrimPrefix(ext, ".")
-	if index := slices.IndexFunc(imageFormats, func(s string) bool { return strings.HasSuffix(ext, s) }); index != -1 {
+	ext := strings.TrimPrefix(filepath.Ext(filename), ".")
+	mimeType, ok := mimeForExtension(ext)
+	if !ok {
 		return ContentType{
-			Header:     "Content-Type",
-			Value:      "image/" + imageFormats[index],
-			IsDownload: false,
-			IsHtml:     false,
-		}
-	} else if index := slices.IndexFunc(videoFormats, func(s string) bool { return strings.HasSuffix(ext, s) }); index != -1 {
-		return ContentType{
-			Header:     "Content-Type",
-			Value:      "video/" + videoFormats[index],
-			IsDownload: false,
-			IsHtml:     false,
-		}
-	} else if index := slices.IndexFunc(audioFormats, func(s string) bool { return strings.HasSuffix(ext, s) }); index != -1 {
-		return ContentType{
-			Header:     "Content-Type",
-			Value:      "audio/" + audioFormats[index],
-			IsDownload: false,
-			IsHtml:     false,
-		}
-	} else if index := slices.IndexFunc(textFormats, func(s string) bool { return strings.HasSuffix(ext, s) }); index != -1 {
-		var mimeType string
-		switch textFormats[index] {
-		case "txt", "md":
-			mimeType = "text/plain; charset=utf-8"
-		case "html", "htm", "xhtml":
-			mimeType = "text/html; charset=utf-8"
-		case "css":
-			mimeType = "text/css; charset=utf-8"
-		case "js":
-			mimeType = "application/javascript; charset=utf-8"
-		case "json":
-			mimeType = "application/json; charset=utf-8"
-		case "xml":
-			mimeType = "application/xml; charset=utf-8"
-		case "csv":
-			mimeType = "text/csv; charset=utf-8"
-		default:
-			mimeType = "text/plain; charset=utf-8"
+			MimeType:      mimeOctetStream,
+			IsDownload:    true,
+			NeedsSniffing: true,
 		}
+	}
+
+	return ContentType{
+		MimeType:   withCharset(mimeType),
+		IsDownload: !isInlineType(mimeType),
+		IsHtml:     slices.Contains(htmlFormats, strings.ToLower(ext)),
+		IsMarkdown: slices.Contains(markdownFormats, strings.ToLower(ext)),
+		Preview:    previewKind(strings.ToLower(ext)),
+	}
+}
+
+func previewKind(ext string) string {
+	switch {
+	case slices.Contains(textFormats, ext) || highlight.Supported(ext):
+		return PreviewText
+	case slices.Contains(videoFormats, ext):
+		return PreviewVideo
+	case slices.Contains(audioFormats, ext):
+		return PreviewAudio
+	}
+
+	return ""
+}
 
+// SniffContentType detects the media type from the leading bytes of the file.
+// Markup detected this way is never displayed inline: it is not wrapped into the sandboxed
+// iframe as files with HTML extensions are, so it is always served as a download.
+func (t *htmlTemplates) SniffContentType(head []byte) ContentType {
+	mimeType, isMarkup := sniff(head)
+	if isMarkup {
 		return ContentType{
-			Header:     "Content-Type",
-			Value:      mimeType,
-			IsDownload: false,
-			IsHtml:     slices.Contains(htmlFormats, textFormats[index]),
+			MimeType:      mimeOctetStream,
+			IsDownload:    true,
+			ForceDownload: true,
 		}
 	}
 
 	return ContentType{
-		Header:     "Content-Disposition",
-		Value:      `attachment; filename="` + filename + `"`,
-		IsDownload: true,
-		IsHtml:     false,
+		MimeType:   withCharset(mimeType),
+		IsDownload: !isInlineType(mimeType),
 	}
 }
 
-func (t *htmlTemplates) HtmlFilesListWithTemplate(f private.FolderInfo, path string) (string, error) {
-	f.BagID = strings.ToUpper(f.BagID)
+// HtmlFilesListWithTemplate renders the directory listing, readme is shown under the files if it's not nil.
+// The files are already filtered, sorted and paginated as described by listing.
+func (t *htmlTemplates) HtmlFilesListWithTemplate(f private.FolderInfo, path string, readme *Readme, listing Listing) (string, error) {
+	// TON DNS domains are kept as is
+	if !strings.Contains(f.BagID, ".") {
+		f.BagID = strings.ToUpper(f.BagID)
+	}
 
 	data := TemplateData{
 		Title:       filepath.Join(f.BagID, path),
@@ -103,7 +132,20 @@ func (t *htmlTemplates) HtmlFilesListWithTemplate(f private.FolderInfo, path str
 		Description: f.Description,
 		PeersCount:  f.PeersCount,
 		FileCount:   f.FilesCount,
+		ArchiveHref: filepath.Join(APIBase, f.BagID, path) + "?archive=zip",
 		Files:       make([]FileData, 0, len(f.Files)),
+		BaseHref:    filepath.Join(APIBase, f.BagID, path) + "/",
+		DirHref:     filepath.Join(APIBase, f.BagID, path),
+		Query:       listing.Query,
+		Sort:        listing.Sort,
+		Order:       listing.Order,
+	}
+
+	data.SortLinks = sortLinks(data.DirHref, listing)
+	data.Pager = pager(data.DirHref, listing)
+
+	if readme != nil {
+		data.Readme = renderReadme(*readme)
 	}
 
 	if path != "" {
@@ -117,20 +159,11 @@ func (t *htmlTemplates) HtmlFilesListWithTemplate(f private.FolderInfo, path str
 		data.ParentDir = &ParentDirData{Href: parentHref}
 	}
 
+	data.Gallery = isGallery(f.Files)
+
 	for _, file := range f.Files {
-		icon := "📄"
-		ext := filepath.Ext(file.Name)
-		if file.IsFolder {
-			icon = "📁"
-		} else if slices.Contains(imageFormats, ext) {
-			icon = "🖼️"
-		} else if slices.Contains(videoFormats, ext) {
-			icon = "🎥"
-		} else if slices.Contains(audioFormats, ext) {
-			icon = "🎵"
-		} else if slices.Contains(textFormats, ext) {
-			icon = "📝"
-		}
+		icon := fileIcon(file)
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file.Name), "."))
 
 		var href string
 		if path == "" {
@@ -144,17 +177,270 @@ func (t *htmlTemplates) HtmlFilesListWithTemplate(f private.FolderInfo, path str
 			fileSize = "folder"
 		}
 
+		var thumb string
+		if data.Gallery && !file.IsFolder {
+			if slices.Contains(thumbnailFormats, ext) {
+				thumb = fmt.Sprintf("%s?thumb=%d", href, galleryThumbSize)
+			} else if ext == "svg" {
+				thumb = href
+			}
+		}
+
 		data.Files = append(data.Files, FileData{
 			Name:          file.Name,
 			Href:          href,
 			Icon:          icon,
 			FormattedSize: fileSize,
+			Thumb:         thumb,
 		})
 	}
 
 	return t.renderTemplate("file_list.html", &data)
 }
 
+// SearchWithTemplate renders the recursive search results, they are already sorted and paginated as described by listing.
+func (t *htmlTemplates) SearchWithTemplate(result v1.SearchResult, listing Listing) (string, error) {
+	bagID := result.BagID
+	if !strings.Contains(bagID, ".") {
+		bagID = strings.ToUpper(bagID)
+	}
+
+	data := SearchData{
+		Title:     fmt.Sprintf("%s — search %q", filepath.Join(bagID, result.CommonPath), result.Query),
+		FullPath:  filepath.Join(bagID, result.CommonPath),
+		Search:    result.Query,
+		Query:     listing.Query,
+		Sort:      listing.Sort,
+		Order:     listing.Order,
+		DirHref:   filepath.Join(APIBase, bagID, result.CommonPath),
+		Results:   make([]SearchResultData, 0, len(result.Files)),
+		Total:     result.EntriesCount,
+		Truncated: result.Truncated,
+	}
+
+	data.SortLinks = sortLinks(data.DirHref, listing)
+	data.Pager = pager(data.DirHref, listing)
+
+	for _, file := range result.Files {
+		data.Results = append(data.Results, SearchResultData{
+			Path:          file.Path,
+			Href:          filepath.Join(APIBase, bagID, file.Path),
+			Icon:          fileIcon(file),
+			FormattedSize: utils.FormatSize(file.Size),
+		})
+	}
+
+	return t.renderTemplate("search.html", &data)
+}
+
+func fileIcon(file v1.File) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file.Name), "."))
+	switch {
+	case file.IsFolder:
+		return "📁"
+	case slices.Contains(imageFormats, ext):
+		return "🖼️"
+	case slices.Contains(videoFormats, ext):
+		return "🎥"
+	case slices.Contains(audioFormats, ext):
+		return "🎵"
+	case slices.Contains(textFormats, ext):
+		return "📝"
+	}
+
+	return "📄"
+}
+
+// listingHref returns the directory URL with the listing options, defaults are omitted.
+func listingHref(dir string, l Listing) string {
+	q := url.Values{}
+	if l.Sort != "" && l.Sort != listingSortName {
+		q.Set("sort", l.Sort)
+	}
+	if l.Order != "" && l.Order != listingOrderAsc {
+		q.Set("order", l.Order)
+	}
+	if l.Query != "" {
+		q.Set("q", l.Query)
+	}
+	if l.Search != "" {
+		q.Set("search", l.Search)
+	}
+	if l.Page > 1 {
+		q.Set("page", strconv.Itoa(l.Page))
+	}
+	if l.PerPage > 0 && l.PerPage != constants.ListingPageSize {
+		q.Set("per_page", strconv.Itoa(l.PerPage))
+	}
+
+	if len(q) == 0 {
+		return dir
+	}
+
+	return dir + "?" + q.Encode()
+}
+
+// sortLinks returns the column links, the active column toggles the order, others sort ascending.
+func sortLinks(dir string, l Listing) []SortLinkData {
+	links := make([]SortLinkData, 0, 2)
+	for _, column := range []struct{ sort, label string }{
+		{listingSortName, "Name"},
+		{listingSortSize, "Size"},
+	} {
+		link := l
+		link.Sort = column.sort
+		link.Order = listingOrderAsc
+		link.Page = 1
+
+		data := SortLinkData{Label: column.label}
+		if l.Sort == column.sort {
+			data.Active = true
+			data.Arrow = "▲"
+			if l.Order == listingOrderDesc {
+				data.Arrow = "▼"
+			} else {
+				link.Order = listingOrderDesc
+			}
+		}
+
+		data.Href = listingHref(dir, link)
+		links = append(links, data)
+	}
+
+	return links
+}
+
+// pager returns nil if all entries fit on one page.
+func pager(dir string, l Listing) *PagerData {
+	if l.PerPage <= 0 || l.Total <= l.PerPage {
+		return nil
+	}
+
+	p := &PagerData{
+		Page:  l.Page,
+		Pages: (l.Total + l.PerPage - 1) / l.PerPage,
+		Total: l.Total,
+	}
+
+	if l.Page > 1 {
+		prev := l
+		prev.Page = min(l.Page-1, p.Pages)
+		p.PrevHref = listingHref(dir, prev)
+	}
+	if l.Page < p.Pages {
+		next := l
+		next.Page = l.Page + 1
+		p.NextHref = listingHref(dir, next)
+	}
+
+	return p
+}
+
+// isGallery reports whether most of the files in the directory are images, folders are not counted.
+func isGallery(files []v1.File) bool {
+	var total, images int
+	for _, file := range files {
+		if file.IsFolder {
+			continue
+		}
+
+		total++
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file.Name), "."))
+		if slices.Contains(imageFormats, ext) {
+			images++
+		}
+	}
+
+	return images >= 2 && images*2 > total
+}
+
+// MarkdownWithTemplate renders the markdown file at path to a page with links to the raw file.
+func (t *htmlTemplates) MarkdownWithTemplate(f private.FolderInfo, path string, content []byte) (string, error) {
+	if !strings.Contains(f.BagID, ".") {
+		f.BagID = strings.ToUpper(f.BagID)
+	}
+
+	href := filepath.Join(APIBase, f.BagID, path)
+	dir := filepath.Dir(path)
+	if dir == "." {
+		dir = ""
+	}
+
+	data := MarkdownData{
+		Title:        filepath.Base(path),
+		FullPath:     filepath.Join(f.BagID, path),
+		BaseHref:     filepath.Join(APIBase, f.BagID, dir) + "/",
+		ParentHref:   filepath.Join(APIBase, f.BagID, dir),
+		RawHref:      href + "?raw=1",
+		DownloadHref: href + "?download=1",
+		Content:      template.HTML(markdown.Render(content)),
+	}
+
+	return t.renderTemplate("markdown.html", &data)
+}
+
+// PreviewWithTemplate renders the preview page of the file: highlighted source with line numbers
+// for text files and a player for media. Content is nil for media and for text files too large to preview.
+func (t *htmlTemplates) PreviewWithTemplate(f private.FolderInfo, path string, size uint64, content []byte) (string, error) {
+	bagID := f.BagID
+	if !strings.Contains(f.BagID, ".") {
+		f.BagID = strings.ToUpper(f.BagID)
+	}
+
+	href := filepath.Join(APIBase, f.BagID, path)
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+
+	data := PreviewData{
+		Title:        filepath.Base(path),
+		FullPath:     filepath.Join(f.BagID, path),
+		Name:         filepath.Base(path),
+		BagID:        bagID,
+		Path:         path,
+		Size:         utils.FormatSize(size),
+		Kind:         previewKind(ext),
+		ParentHref:   filepath.Join(APIBase, f.BagID, filepath.Dir(path)),
+		MediaHref:    href,
+		RawHref:      href + "?raw=1",
+		DownloadHref: href + "?download=1",
+	}
+
+	if mimeType, ok := mimeForExtension(ext); ok {
+		data.MimeType = mimeType
+	}
+
+	if data.Kind == PreviewText && content == nil {
+		data.TooLarge = true
+	} else if data.Kind == PreviewText {
+		lines := highlight.Lines(string(content), ext)
+		data.Lines = make([]PreviewLine, len(lines))
+		for i, line := range lines {
+			data.Lines[i] = PreviewLine{
+				Number: i + 1,
+				HTML:   template.HTML(line),
+			}
+		}
+	}
+
+	return t.renderTemplate("preview.html", &data)
+}
+
+// renderReadme renders markdown READMEs, other ones are shown as preformatted text.
+func renderReadme(r Readme) *ReadmeData {
+	ext := strings.TrimPrefix(filepath.Ext(r.Name), ".")
+	if slices.Contains(markdownFormats, strings.ToLower(ext)) {
+		return &ReadmeData{
+			Name:       r.Name,
+			IsMarkdown: true,
+			Content:    template.HTML(markdown.Render(r.Content)),
+		}
+	}
+
+	return &ReadmeData{
+		Name:    r.Name,
+		Content: template.HTML("<pre>" + template.HTMLEscapeString(string(r.Content)) + "</pre>"),
+	}
+}
+
 func (t *htmlTemplates) renderTemplate(templateName string, data any) (string, error) {
 	var buf strings.Builder
 	err := t.templates.ExecuteTemplate(&buf, templateName, data)
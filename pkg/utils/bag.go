@@ -0,0 +1,17 @@
+package utils
+
+// ValidateBagID reports whether bagID is a hex encoded 32 byte bag ID, in any letter case.
+func ValidateBagID(bagID string) bool {
+	if len(bagID) != 64 {
+		return false
+	}
+
+	for i := range 64 {
+		c := bagID[i]
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,24 @@
+-- Human-readable names of bags served at /g/<slug>, see pkg/services/aliases
+CREATE TABLE IF NOT EXISTS files.aliases (
+    slug TEXT PRIMARY KEY,
+    bagid TEXT NOT NULL,
+    path TEXT NOT NULL DEFAULT '',
+    admin TEXT NOT NULL DEFAULT '',
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Previous targets of aliases, a row is added when an alias is repointed or deleted
+CREATE TABLE IF NOT EXISTS files.aliases_history (
+    id BIGSERIAL PRIMARY KEY,
+    slug TEXT NOT NULL,
+    bagid TEXT NOT NULL,
+    path TEXT NOT NULL,
+    admin TEXT NOT NULL,
+    comment TEXT NOT NULL,
+    set_at TIMESTAMPTZ NOT NULL,
+    replaced_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS aliases_history_slug_idx ON files.aliases_history (slug, replaced_at DESC);
@@ -0,0 +1,10 @@
+-- Bytes served per client IP and per bag, see pkg/services/quotas
+CREATE TABLE IF NOT EXISTS files.bandwidth_usage (
+    subject_type TEXT NOT NULL, -- ip or bag
+    subject TEXT NOT NULL,
+    window_start TIMESTAMPTZ NOT NULL,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (subject_type, subject, window_start)
+);
+
+CREATE INDEX IF NOT EXISTS bandwidth_usage_window_start_idx ON files.bandwidth_usage (window_start);
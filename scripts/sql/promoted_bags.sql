@@ -0,0 +1,6 @@
+-- Remote bags downloaded to the local daemon because they are requested often, see pkg/services/promotion
+CREATE TABLE IF NOT EXISTS files.promoted_bags (
+    bagid TEXT PRIMARY KEY,
+    size BIGINT NOT NULL DEFAULT 0,
+    promoted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,8 @@
+-- Rate limiter counters shared by gateway instances, see pkg/repositories/ratelimit
+CREATE UNLOGGED TABLE IF NOT EXISTS files.rate_limits (
+    key TEXT PRIMARY KEY,
+    hits INTEGER NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limits_expires_at_idx ON files.rate_limits (expires_at);
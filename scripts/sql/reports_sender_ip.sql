@@ -0,0 +1,2 @@
+-- Client IP of the report sender, resolved behind trusted proxies
+ALTER TABLE files.reports ADD COLUMN IF NOT EXISTS sender_ip INET;
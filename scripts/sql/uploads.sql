@@ -0,0 +1,11 @@
+-- Bags created from uploads through the gateway, used bytes are counted per access token, see pkg/services/uploads
+CREATE TABLE IF NOT EXISTS files.uploads (
+    bagid TEXT PRIMARY KEY,
+    token_hash TEXT NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    files_count INTEGER NOT NULL DEFAULT 0,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS uploads_token_hash_idx ON files.uploads (token_hash);